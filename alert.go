@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/robfig/jl/structure"
+)
+
+// alerter rings the terminal bell, sends a desktop notification or runs a
+// command for the entries matching any of its filters.
+type alerter struct {
+	filters []structure.Filter
+	bell    bool
+	notify  bool
+	command string
+
+	running sync.WaitGroup
+}
+
+// check alerts about the entry if it matches, raw is its JSON.
+func (a *alerter) check(entry *structure.Entry, raw []byte) {
+	if !a.matches(entry) {
+		return
+	}
+	if a.bell {
+		os.Stderr.WriteString("\a")
+	}
+	if a.notify {
+		a.background(func() { notify(entry) })
+	}
+	if a.command != "" {
+		a.background(func() { a.run(raw) })
+	}
+}
+
+func (a *alerter) background(alert func()) {
+	a.running.Add(1)
+	go func() {
+		defer a.running.Done()
+		alert()
+	}()
+}
+
+// wait waits for the notifications and commands still running.
+func (a *alerter) wait() {
+	a.running.Wait()
+}
+
+func (a *alerter) matches(entry *structure.Entry) bool {
+	for _, filter := range a.filters {
+		if filter(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs the alert command with the entry JSON on its stdin.
+func (a *alerter) run(raw []byte) {
+	cmd := exec.Command("sh", "-c", a.command)
+	input := make([]byte, 0, len(raw)+1)
+	cmd.Stdin = bytes.NewReader(append(append(input, raw...), '\n'))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "alert command failed: %v\n", err)
+	}
+}
+
+// notify sends a desktop notification of the entry.
+func notify(entry *structure.Entry) {
+	title := "jl"
+	if entry.Severity != "" {
+		title += ": " + entry.Severity
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", entry.Message, title)
+		cmd = exec.Command("osascript", "-e", script)
+	default:
+		cmd = exec.Command("notify-send", title, entry.Message)
+	}
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "desktop notification failed: %v\n", err)
+	}
+}
+
+// alerts builds the alerter from the alert options, nil without --alert.
+func alerts(opts options) *alerter {
+	if len(opts.alert) == 0 {
+		return nil
+	}
+	a := &alerter{notify: opts.alertNotify, command: opts.alertCmd}
+	a.bell = !a.notify && a.command == "" || opts.alertBell
+	for _, expr := range opts.alert {
+		filter, err := structure.ParseExpression(expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --alert: %v\n", err)
+			os.Exit(1)
+		}
+		a.filters = append(a.filters, filter)
+	}
+	return a
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/robfig/jl/djson"
+	"github.com/robfig/jl/structure"
+)
+
+// check reports the problems of the template of --format, or else shows
+// the sample entries rendered with it and the other formatting options,
+// for jl check.
+func check(opts options) {
+	format := opts.format
+	if format == "" {
+		format = structure.DefaultTemplate
+	}
+	if problems := structure.CheckTemplate(format); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "invalid format: %s\n", problem)
+		}
+		os.Exit(1)
+	}
+	var buf bytes.Buffer
+	formatter := newFormatter(opts, &buf)
+	failed := false
+	for i, sample := range structure.SampleEntries {
+		buf.Reset()
+		entry := &structure.Entry{}
+		djson.Unmarshal([]byte(sample), entry)
+		if err := formatter.Format(entry, []byte(sample), nil, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "sample %d: %v\n  %s\n", i+1, err, sample)
+			failed = true
+			continue
+		}
+		os.Stdout.Write(buf.Bytes())
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
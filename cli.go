@@ -1,12 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docopt/docopt-go"
 	"github.com/mattn/go-isatty"
+	"github.com/robfig/jl/stream"
+	"github.com/robfig/jl/structure"
 )
 
 var usage = `jl - JSON Logs
@@ -19,36 +25,477 @@ will output the entry in a human readable way. Anything else
 is forwarded as is.
 
 Usage:
-  jl [options] [FILE...]
+  jl agg [options] [--time-layout <layout>]... [--rename <field=alias>]...
+     [--truncate-field <field=int>]... [--field-color <field=color>]...
+     [--color-rule <rule>]... [--unit <field=unit>]... [--where <condition>]...
+     [--grep-v <regexp>]... [--follow-id <field=id>]...
+     [--filter <expression>]... [--alert <expression>]... [--top <field>]...
+     [--percentiles <field>]... [--count-distinct <field>]...
+     [--key <name=path>]... [--redact <field>]... [--sum <field>]...
+     [--avg <field>]... [--min <field>]... [--max <field>]... [FILE...]
+  jl convert [options] --to <format> [--time-layout <layout>]...
+     [--key <name=path>]... [--redact <field>]... [--where <condition>]...
+     [--grep-v <regexp>]... [--filter <expression>]... [FILE...]
+  jl check [options] [--time-layout <layout>]... [--rename <field=alias>]...
+     [--truncate-field <field=int>]... [--field-color <field=color>]...
+     [--color-rule <rule>]... [--unit <field=unit>]...
+     [--key <name=path>]...
+  jl (listen <addr> | k8s <resource>) [options] [--time-layout <layout>]...
+     [--rename <field=alias>]... [--truncate-field <field=int>]...
+     [--field-color <field=color>]... [--color-rule <rule>]...
+     [--unit <field=unit>]... [--where <condition>]...
+     [--grep-v <regexp>]... [--follow-id <field=id>]...
+     [--filter <expression>]... [--alert <expression>]... [--top <field>]...
+     [--percentiles <field>]... [--count-distinct <field>]...
+     [--key <name=path>]... [--redact <field>]...
+  jl [cat | tail | stats] [options] [--time-layout <layout>]...
+     [--rename <field=alias>]... [--truncate-field <field=int>]...
+     [--field-color <field=color>]... [--color-rule <rule>]...
+     [--unit <field=unit>]... [--where <condition>]...
+     [--grep-v <regexp>]... [--follow-id <field=id>]...
+     [--filter <expression>]... [--alert <expression>]... [--top <field>]...
+     [--percentiles <field>]... [--count-distinct <field>]...
+     [--key <name=path>]... [--redact <field>]... [FILE...]
+
+Commands:
+  cat       Format the files, or stdin, which is the default
+  tail      Follow the files as they grow, like --follow
+  stats     Count the lines and entries per severity, like --stats
+  listen    Format the lines sent over TCP to the address, ex: ":5170",
+            by any number of clients, labeled with their host
+  agg       Aggregate the entries per group, see Aggregation Options
+  convert   Write the entries as JSON, logfmt or CSV, see Convert Options
+  check     Check the template of --format, reporting unknown functions and
+            fields, and show sample entries formatted with it and the
+            formatting options, ex: jl check --format "{{.Message}}"
+  k8s       Follow the logs of a Kubernetes resource, ex: "deploy/api",
+            running kubectl logs with the arguments given after --, ex:
+            "jl k8s deploy/api -- -n prod". The options are shared by
+            all the commands
 
 Options:
   -h, --help    Show this screen.
   --version     Show version.
+  --no-config   Don't read the configuration files
+  --profile <name>
+                Use the settings of a profile of the configuration
+                files, ex: "access-logs", over the others (defaults to
+                the JL_PROFILE environment variable)
+
+Filtering Options:
+  --level <severity>
+                    Hide entries less severe than this, ex: "warn".
+                    Entries without a known severity are shown
+  --errors          Show only ERROR and worse entries, each preceded by
+                    the lines of the same request or logger before it
+  --error-context <n>
+                    How many lines of context to show before each
+                    error [default: 5]
+  --only <severities>
+                    Show only entries of these severities, ex:
+                    "error,fatal" (comma separated list)
+  --not <severities>
+                    Hide entries of these severities, ex: "debug,trace"
+                    (comma separated list)
+  --logger <patterns>
+                    Show only entries of these loggers and the loggers
+                    beneath them, ex: "com.acme.payment.*" (comma
+                    separated list of globs)
+  --where <condition>
+                    Show only entries of which a field matches, ex:
+                    "status>=500" or "http.method=GET". Operators are
+                    =, !=, >, >=, <, <=, ~ (regexp) and !~ (can be
+                    repeated, all have to match)
+  --grep <regexp>   Show only entries of which the message matches
+  --grep-v <regexp> Hide entries of which the message matches, ex:
+                    "health check" (can be repeated)
+  --hl <regexp>     Highlight the matches in messages and field values
+                    without filtering, the matches of --grep are too
+  --grep-fields     Let --grep and --grep-v also match fields as
+                    key=value
+  --redact <field>  Replace the value of a field with [REDACTED] before
+                    the entries are filtered and shown, ex: "password"
+                    or "request.headers.Authorization" (can be repeated)
+  --follow          Keep reading the files as they grow, like tail -f,
+                    and the files created matching --glob
+  --glob <pattern>  Read the files matching the pattern as well, ex:
+                    "/var/log/app/*.json", quoted for jl to match it
+  --since <time>    Show only entries logged since this time, ex:
+                    "2024-05-01T12:00:00Z", "2024-05-01" or "15m" ago.
+                    Times without a zone are read in --tz or UTC
+  --until <time>    Show only entries logged until this time
+  --sorted          Stop reading at the first entry after --until,
+                    for input sorted by time
+  --follow-id <field=id>
+                    Show the entries of a request, ex:
+                    "request_id=abc123", and all the entries sharing a
+                    trace or request ID with them (can be repeated)
+  --follow-related  Show all the entries sharing a trace or request ID
+                    with the entries matching the other filters
+  --sample <fraction>
+                    Show a random fraction of the matching entries, ex:
+                    0.01 for 1%
+  --every <n>       Show every nth matching entry, ex: 3 for the 3rd, the
+                    6th and so on
+  --max-rate <rate> Show at most this many lines, ex: "200/s" or
+                    "1000/m", summarizing the lines suppressed above it
+  -A, --after-context <n>
+                    Show n lines after each matching entry
+  -B, --before-context <n>
+                    Show n lines before each matching entry
+  -C, --context <n> Show n lines before and after each matching entry,
+                    with "--" between groups that aren't adjacent
+  --group           Write the entries of each request or trace together
+                    under a header, once no more of them came for a
+                    while (see --group-window)
+  --group-by <fields>
+                    Group by these fields instead of the trace and
+                    request IDs, or aggregate by them with jl agg
+                    (comma separated list)
+  --group-window <duration>
+                    How long to wait for more entries of a request
+                    [default: 2s]
+  --uniq            Show only the first entry of each distinct message,
+                    ignoring the numbers, IDs and quoted strings in it,
+                    and count them all at the end
+  --gap <duration>  Mark where more than this time passed between two
+                    entries, ex: "30s", showing when the service was
+                    silent
+  --bursts          Mark where entries are logged at a much higher rate
+                    than before, like retry storms and crash loops
+  --burst-window <duration>
+                    The window of time the rate is counted in
+                    [default: 10s]
+  --burst-factor <factor>
+                    How many times the trailing average rate a burst
+                    is [default: 5]
+  --dedupe          Collapse consecutive duplicate entries, ignoring
+                    their timestamp, into one line with a ×N counter
+  --filter <expression>
+                    Show only entries matching the expression, ex:
+                    'level=="error" && (status>=500 || duration>2000)'.
+                    Supports ==, !=, >, >=, <, <=, =~, !~, &&, ||, !
+                    and parentheses, a field on its own tests whether
+                    it's set (can be repeated)
+  --and             Show entries matching all of the filters, which is
+                    the default
+  --or              Show entries matching any of the filters
+  --filter-stats    Report how many entries each filter dropped at the
+                    end, on stderr
+
+Aggregation Options:
+  With jl agg, entries are aggregated per value of the --group-by fields,
+  ex: "jl agg --group-by status --count --avg duration_ms"
+  --sum <field>     Sum the values of the field per group
+  --avg <field>     Average the values of the field per group
+  --min <field>     The least value of the field per group
+  --max <field>     The greatest value of the field per group
+
+Convert Options:
+  With jl convert, entries are written in a machine format instead of the
+  template, their time, level and msg first and then their other fields,
+  ex: "jl convert --from bunyan --to logfmt"
+  --from <format>   Read the lines with a parser of --parser, or as JSON
+                    logs of a logging library of --preset, ex: "logfmt"
+                    or "bunyan" [default: json]
+  --to <format>     Write "json", "logfmt" or "csv", with the time, level
+                    and msg columns and those of --include-fields, or
+                    else of the fields of the first entry
+
+Alerting Options:
+  --alert <expression>
+                    Alert about entries matching the expression, ex:
+                    'level=="fatal"', whether they are shown or not. It
+                    rings the terminal bell unless another alert is
+                    chosen (can be repeated)
+  --alert-bell      Ring the terminal bell, along with the other alerts
+  --alert-notify    Send a desktop notification
+  --alert-cmd <command>
+                    Run the shell command with the entry JSON on stdin
 
 Output Options:
+  --interactive     Browse the entries in a full-screen view following the
+                    stream, one line each. The arrow keys, PgUp, PgDn, g
+                    and G select an entry, Enter expands it into its
+                    JSON and stack trace. Space pauses the view while
+                    the entries arriving are kept, and resumes following
+                    the stream. & filters the entries as you
+                    type, with terms like "level:warn status>=500
+                    timeout -healthcheck", / searches them, n and N
+                    move to the next and previous match. m marks an
+                    entry and ' moves to the next one marked, their
+                    JSON is written on stdout when q quits. y copies the
+                    JSON of the entry selected to the clipboard, Y its
+                    lines as shown. o opens a panel with the tree of its
+                    fields and the entries sharing its trace ID, Tab
+                    moves to it and Enter collapses a node. e, w, i
+                    and d hide or show the errors, warnings, infos and
+                    debug messages, the status bar shows those shown
+  --split           Show each file in its own pane with --interactive,
+                    stacked or side by side with |. Tab moves to the
+                    next pane, the others select the entries at the time
+                    of the one selected and have their own filters
+  -q, --quiet       Don't show the entries, exit with status 1 when none
+                    matched the filters
+  --count           Show how many entries matched the filters in total
+                    and per severity at the end, or with jl agg count
+                    the entries of each group
+  --error-rate <window>
+                    Write the number and rate of errors within this
+                    window, ex: "1m", every 10 seconds while following
+                    a stream
+  --summary <format>
+                    Write a summary of the run on stderr at the end or
+                    when interrupted: the lines read, parse failures,
+                    entries per severity, time span and top errors, as
+                    "text" or "json"
+  --metrics-listen <addr>
+                    Serve counters of the lines read, parse errors and
+                    entries matching the filters by severity for
+                    Prometheus at /metrics on this address, ex: ":9090"
+  --stats           Show counts of the lines, JSON or not, and of the
+                    entries per severity instead of the entries
+  --stats-by-file   Show the counts of --stats for each file
+  --histogram <bucket>
+                    Show a sparkline of the entries per severity over
+                    time instead of the entries, with a bar per bucket
+                    of time, ex: "1m" or "1h"
+  --top <field>     Rank the most frequent values of the field instead
+                    of showing the entries, ex: "user_id" (can be
+                    repeated)
+  --top-n <n>       How many values --top ranks [default: 10]
+  --percentiles <field>
+                    Show the p50, p90, p99 and max of a numeric field
+                    instead of the entries, ex: "duration_ms" (can be
+                    repeated)
+  --percentiles-by <field>
+                    Show the percentiles per value of this field, ex:
+                    "route"
+  --count-distinct <field>
+                    Show the approximate number of distinct values of
+                    the field instead of the entries, ex: "session_id"
+                    (can be repeated)
+  --report-format <format>
+                    Write the tables of jl agg, --stats, --histogram,
+                    of --top, --percentiles and --count-distinct as
+                    "text", "json" with an object per line, or "csv"
+                    [default: text]
+  --output <format> Write the entries as "text" with the format, or as
+                    "json", "logfmt", "csv" or an "html" page, without
+                    the markers of the text [default: text]
   --color           Force colorized output
+  --theme <name>    Color the output with a theme of the configuration
+                    files, or "light" for light backgrounds
   --no-color        Don't colorize output
+  --strict          Exit with status 1 when any line isn't JSON or its
+                    entry violates --schema, listing the lines on
+                    stderr at the end, ex: to check the logs in CI
+  --schema <fields>
+                    The fields the entries must have, implies --strict.
+                    Each can be of a type: string, number, bool, object
+                    or array, ex: "time,msg,status:number"
+  --pipefail        Exit with status 1 when reading the input fails, and
+                    quietly with status 141 once the output is closed,
+                    ex: by head, terminating the command run. With the
+                    shell's "set -o pipefail", the status of producer
+                    in "producer | jl" isn't masked by jl's own
+  --tee <file>      Write the input as is to the file as well, ex:
+                    "raw.log"
   --skip-prefix     Skip printing truncated bytes before the JSON
   --skip-suffix     Skip printing truncated bytes after the JSON
 
 Formatting Options:
+  --parser <name>   Read the entries in the lines as "json", "logfmt",
+                    "cri" for the logs of containers, like in Kubernetes,
+                    or "syslog" [default: json]
+  --preset <library>
+                    Read the timestamp, severity, message, caller and
+                    error of entries under the keys of a logging
+                    library and hide the fields it adds: zap, logrus,
+                    zerolog, slog, bunyan, pino or log15
+  --key <name=path>
+                    Read the timestamp, severity, message, logger,
+                    caller or error of entries under a dotted path, over
+                    the keys of the preset, ex: "timestamp=meta.time"
+                    (can be repeated)
+  --format <template>
+                    Go template used for the line, ex: "{{.Severity}}
+                    {{.Message}}" (defaults to the timestamp, severity
+                    and message). Other fields are available with
+                    {{field "http.status"}} or {{index .Fields "http"}},
+                    and {{.Source}} labels the entries of each file when
+                    several are read
+  --template <name>
+                    Use a template of the configuration files instead of
+                    the format, they include each other with
+                    {{template "name" .}}
+  --on-missing <mode>
+                    When the template outputs a field absent from an
+                    entry "ignore" it, "fail" or "annotate" the line,
+                    fields checked with {{if}} may be absent
+                    [default: ignore]
   --skip-fields     Don't output misc json keys as fields
   --max-field-length <int>
                     Any field, exceeding the given length (including
                     field name) will be ommitted from output. Use 0
                     to remove the length limit [default: 30]
+  --truncate-values <int>
+                    Cut field values at this length instead of
+                    omitting fields exceeding --max-field-length
+  --truncate-field <field=int>
+                    Cut the value of a single field at the given length,
+                    ex: "url=80" (can be repeated)
+  --align-fields    Line up the values of fields across lines
+  --wrap-fields     Wrap fields onto indented lines to fit the terminal
+  --truncate        Cut lines at the width of the terminal
+  --field-color <field=color>
+                    Color a field, ex: "request_id=cyan" or
+                    "user_id=magenta+bold" (can be repeated)
+  --color-rule <rule>
+                    Color a field based on its value, ex:
+                    "status>=500:red" or "duration_ms>1000:yellow". Add
+                    ":line" to color the whole line, ex: "env=prod:bold:
+                    line". Operators are =, !=, >, >=, <, <=, ~ (regexp)
+                    and !~ (can be repeated)
+  --max-depth <int> Show fields of nested objects up to this depth as
+                    dotted fields, use 0 for no limit [default: 1]
+  --max-array-length <int>
+                    Arrays up to this length are shown as fields, longer
+                    arrays are printed after a newline [default: 5]
+  --trailer-format <format>
+                    Render objects and arrays printed after a newline as
+                    "json" or "yaml" [default: json]
+  --separate-errors
+                    Show the "error" field among the other fields
+                    instead of appending it to the message
+  --highlight-syntax
+                    Highlight JSON and SQL embedded in messages
+  --trace-ids       Shorten trace and span IDs and color them per
+                    trace
+  --trace-url <template>
+                    Link trace IDs to a trace viewer, {trace_id} and
+                    {span_id} are replaced, ex: "http://localhost:16686/
+                    trace/{trace_id}"
+  --caller          Show where an entry was logged from at the end of
+                    the line, using the "caller", "source" or "file"
+                    and "line" keys
+  --hyperlinks      Make the caller clickable in supporting terminals
+  --caller-url <template>
+                    URL the caller links to, {file} and {line} are
+                    replaced, ex: "https://github.com/acme/app/blob/
+                    main/{file}#L{line}" (defaults to a file:// URL)
+  --stack-highlight <packages>
+                    Highlight stacktrace frames containing any of these
+                    packages or paths (comma separated list)
+  --stack-head <int>
+                    Number of stacktrace frames shown before collapsing
+                    the rest, use 0 with --stack-tail 0 to show all
+                    frames [default: 10]
+  --stack-tail <int>
+                    Number of frames shown at the end of a collapsed
+                    stacktrace [default: 3]
+  --stack-hide <patterns>
+                    Hide stacktrace frames matching these globs, ex:
+                    "runtime.*" (comma separated list)
   --include-fields <fields>, -f <fields>
                     Always include these json keys as fields, no matter
-                    the length (comma separated list)
+                    the length (comma separated list of dotted paths,
+                    which can be globs like "http.*")
   --exclude-fields <fields>
                     Always exclude these json keys (comma separated
-                    list)
+                    list of dotted paths or globs like "*_id")
+  --include-fields-re <regexp>
+                    Always include json keys of which the dotted path
+                    matches this regular expression
+  --exclude-fields-re <regexp>
+                    Always exclude json keys of which the dotted path
+                    matches this regular expression
   --obj-fields <fields>
                     If present and a JSON object, printed in entirety
                     after a newline.
+  --flatten <fields>
+                    Show the keys of these objects as top level fields
+                    (comma separated list) [default: labels]
+  --on-collision <mode>
+                    When a flattened key exists at the top level,
+                    "prefix" it with the object name, "overwrite" the
+                    top level key or "warn" and prefix [default: prefix]
+  --field-order <fields>
+                    Show these fields first in this order, followed by
+                    the others alphabetically (comma separated list of
+                    dotted paths or globs)
+  --rename <field=alias>
+                    Display a field under a different name, ex:
+                    "http.request.method=method" (can be repeated)
+  --unit <field=unit>
+                    Display a numeric field in human units, ex:
+                    "size=bytes" shows 1536 as 1.5KiB and "latency=ns"
+                    shows 93000000 as 93ms. Units are bytes, ns, us, ms
+                    and s (can be repeated)
+  --severity-width <int>
+                    Width of the severity column [default: 7]
+  --severity-align <side>
+                    Pad the severity column on the "left" or "right"
+                    side [default: right]
+  --truncate-severity
+                    Shorten severities longer than the column width,
+                    a width of 3 uses codes like INF, WRN and ERR
+  --icons           Prefix lines with an icon per severity
+  --icons-only      Prefix lines with an icon instead of the severity
+  --tz <zone>       Convert timestamps to the given time zone, ex:
+                    "Local" or "America/New_York"
+  --utc             Convert timestamps to UTC
+  --time-format <layout>
+                    Go layout used to display timestamps, can also be
+                    a name like "RFC3339" or "Kitchen", or one of
+                    "unix", "unixmilli", "unixmicro" and "unixnano"
+                    [default: 2006-01-02 15:04:05]
+  --time-layout <layout>
+                    Additional Go layout to parse timestamps with, ex:
+                    "02/Jan/2006:15:04:05 -0700" (can be repeated)
+  --relative <to>   Show timestamps relative to "now" or to the "start"
+                    of the stream
+  --elapsed         Show the time passed since the previous entry
+  --elapsed-threshold <duration>
+                    Highlight elapsed times exceeding this duration
+                    [default: 1s]
 
 You can add any option to the JL_OPTS environment variable, ex:
   export JL_OPTS="--no-color"
+or set it in the variable named after it, "1" or "true" for flags, ex:
+  export JL_EXCLUDE_FIELDS=pid,hostname JL_THEME=light JL_ICONS=1
+The options which can be repeated take a value per line, ex:
+  export JL_WHERE="status>=500
+  method=POST"
+
+Defaults are read from ~/.config/jl/config.yaml, then from the nearest
+.jl.yaml of the current directory or its parents, ex:
+  format: "{{.Severity}} {{.Message}}"
+  preset: zap
+  exclude-fields: [pid, hostname]
+  include-fields: [request_id]
+  obj-fields: [record]
+  field-colors: {request_id: cyan}
+  keys: {timestamp: meta.time, logger: log.name}
+  color-rules: ["status>=500:red"]
+  severities: {notice: info}
+  theme: dark
+  template: short
+  templates:
+    short: "{{.Severity}} {{.Message}}"
+    request: '{{template "short" .}} {{field "status"}}'
+  themes:
+    dark: {info: hiblue, message: hiwhite+bold}
+  colors: {caller: gray}
+  profiles:
+    access-logs: {format: "{{field \"status\"}} {{.Message}}", theme: dark}
+The options given override them, and the settings of the profile chosen
+with --profile override the others. On SIGHUP, ex: "kill -HUP <pid>", jl
+reloads them between two lines, keeping its place in the files followed.
+
+To run a command and format both its stdout and stderr, the lines of
+stderr marked with ┃, exiting with its status, give it after "--", ex:
+  jl --level warn -- go test ./... -json
 
 Example:
   $ echo '{"level": "info", "msg": "Hello!", "size": 42}' | jl
@@ -57,21 +504,593 @@ Example:
 
 var version = "v1.5.0"
 
-func cli() (files []string, color, showPrefix, showSuffix, showFields bool, includeFields string, excludeFields string, objFields string, maxFieldLength int) {
-	argv := append(os.Args[1:], strings.Split(os.Getenv("JL_OPTS"), " ")...)
+type options struct {
+	files         []string
+	command       []string
+	tee           string
+	convert       bool
+	check         bool
+	to            string
+	pipefail      bool
+	strict        bool
+	schema        string
+	follow        bool
+	listen        string
+	glob          string
+	color         bool
+	showPrefix    bool
+	showSuffix    bool
+	format        string
+	template      string
+	parser        string
+	output        string
+	templates     map[string]string
+	preset        string
+	keys          map[string]string
+	onMissing     string
+	showFields    bool
+	includeFields string
+	excludeFields string
+	objFields     string
+	fieldOrder    string
+	flatten       string
+	onCollision   string
+
+	includeFieldsRe string
+	excludeFieldsRe string
+	maxFieldLength  int
+	rename          map[string]string
+	units           map[string]string
+
+	alignFields    bool
+	wrapFields     bool
+	maxArrayLength int
+	maxDepth       int
+	trailerFormat  string
+	separateErrors bool
+	highlight      bool
+	traceIDs       bool
+	traceURL       string
+	caller         bool
+	hyperlinks     bool
+	callerURL      string
+	stackHighlight string
+	stackHead      int
+	stackTail      int
+	stackHide      string
+	truncate       bool
+	truncateValues int
+	truncateFields map[string]int
+	fieldColors    map[string]string
+	colorRules     []string
+	theme          string
+	colors         map[string]string
+
+	// themes are the themes of the configuration, elementColors the colors
+	// of the theme chosen and those given over them, and severities the
+	// severities read as others, which are set for all the formatters.
+	themes        map[string]map[string]string
+	elementColors map[string]string
+	severities    map[string]string
+
+	severityWidth    int
+	severityAlign    string
+	truncateSeverity bool
+	icons            bool
+	iconsOnly        bool
+
+	timezone    string
+	relative    string
+	timeFormat  string
+	timeLayouts []string
+
+	elapsed          bool
+	elapsedThreshold time.Duration
+
+	level        string
+	errors       bool
+	errorContext string
+	only         string
+	not          string
+	logger       string
+	where        []string
+	redact       []string
+	filter       []string
+	or           bool
+	filterStats  bool
+
+	grep       string
+	grepV      []string
+	grepFields bool
+	hl         string
+
+	since  string
+	until  string
+	sorted bool
+
+	followID      []string
+	followRelated bool
+
+	sample string
+	every  string
+
+	maxRate string
+
+	interactive bool
+	split       bool
+	quiet       bool
+	count       bool
+	stats       bool
+	statsByFile bool
+	errorRate   string
+	summary     string
+
+	metricsListen string
+	histogram     string
+	top           []string
+	topN          int
+
+	percentiles   []string
+	percentilesBy string
+
+	agg           bool
+	aggregates    []structure.Aggregate
+	countDistinct []string
+	reportFormat  string
+
+	alert       []string
+	alertBell   bool
+	alertNotify bool
+	alertCmd    string
+	dedupe      bool
+	uniq        bool
+	gap         time.Duration
+	bursts      bool
+	burstWindow time.Duration
+	burstFactor float64
+
+	group       bool
+	groupBy     string
+	groupWindow time.Duration
+
+	afterContext  string
+	beforeContext string
+	context       string
+
+	// noConfig and profile choose the configuration applied to the options
+	// given, kept to apply it again when it's reloaded.
+	noConfig bool
+	profile  string
+	given    *options
+}
+
+func cli() (opts options) {
+	argv := os.Args[1:]
+	for i, arg := range argv {
+		if arg == "--" {
+			argv, opts.command = argv[:i:i], argv[i+1:]
+			break
+		}
+	}
+	argv = append(argv, strings.Fields(os.Getenv("JL_OPTS"))...)
+	env, err := envArgs(argv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	argv = append(argv, env...)
 	arguments, err := docopt.Parse(usage, argv, true, "jl "+version, false)
 	if err != nil {
 		panic(err)
 	}
 	isTTY := isatty.IsTerminal(os.Stdout.Fd())
-	color = !arguments["--no-color"].(bool) && (arguments["--color"].(bool) || isTTY)
-	showPrefix = !arguments["--skip-prefix"].(bool)
-	showSuffix = !arguments["--skip-suffix"].(bool)
-	showFields = !arguments["--skip-fields"].(bool)
-	maxFieldLength, _ = strconv.Atoi(arguments["--max-field-length"].(string))
-	includeFields, _ = arguments["--include-fields"].(string)
-	excludeFields, _ = arguments["--exclude-fields"].(string)
-	objFields, _ = arguments["--obj-fields"].(string)
-	files = arguments["FILE"].([]string)
+	opts.interactive = arguments["--interactive"].(bool)
+	opts.split = arguments["--split"].(bool)
+	opts.color = !arguments["--no-color"].(bool) && (arguments["--color"].(bool) || isTTY || opts.interactive)
+	opts.level, _ = arguments["--level"].(string)
+	opts.errors = arguments["--errors"].(bool)
+	opts.errorContext, _ = arguments["--error-context"].(string)
+	opts.only, _ = arguments["--only"].(string)
+	opts.not, _ = arguments["--not"].(string)
+	opts.logger, _ = arguments["--logger"].(string)
+	opts.where, _ = arguments["--where"].([]string)
+	opts.redact, _ = arguments["--redact"].([]string)
+	opts.filter, _ = arguments["--filter"].([]string)
+	opts.or = arguments["--or"].(bool) && !arguments["--and"].(bool)
+	opts.filterStats = arguments["--filter-stats"].(bool)
+	opts.grep, _ = arguments["--grep"].(string)
+	opts.grepV, _ = arguments["--grep-v"].([]string)
+	opts.grepFields = arguments["--grep-fields"].(bool)
+	opts.hl, _ = arguments["--hl"].(string)
+	opts.since, _ = arguments["--since"].(string)
+	opts.until, _ = arguments["--until"].(string)
+	opts.sorted = arguments["--sorted"].(bool)
+	opts.followID, _ = arguments["--follow-id"].([]string)
+	opts.followRelated = arguments["--follow-related"].(bool)
+	opts.sample, _ = arguments["--sample"].(string)
+	opts.every, _ = arguments["--every"].(string)
+	opts.maxRate, _ = arguments["--max-rate"].(string)
+	opts.dedupe = arguments["--dedupe"].(bool)
+	opts.quiet = arguments["--quiet"].(bool)
+	opts.count = arguments["--count"].(bool)
+	opts.stats = arguments["--stats"].(bool) || arguments["stats"].(bool)
+	opts.statsByFile = arguments["--stats-by-file"].(bool)
+	opts.histogram, _ = arguments["--histogram"].(string)
+	opts.errorRate, _ = arguments["--error-rate"].(string)
+	opts.summary, _ = arguments["--summary"].(string)
+	opts.metricsListen, _ = arguments["--metrics-listen"].(string)
+	opts.top, _ = arguments["--top"].([]string)
+	opts.percentiles, _ = arguments["--percentiles"].([]string)
+	opts.percentilesBy, _ = arguments["--percentiles-by"].(string)
+	opts.agg, _ = arguments["agg"].(bool)
+	opts.convert, _ = arguments["convert"].(bool)
+	opts.check, _ = arguments["check"].(bool)
+	opts.to, _ = arguments["--to"].(string)
+	for _, function := range []string{"sum", "avg", "min", "max"} {
+		fields, _ := arguments["--"+function].([]string)
+		for _, field := range fields {
+			opts.aggregates = append(opts.aggregates, structure.Aggregate{Func: function, Field: field})
+		}
+	}
+	opts.countDistinct, _ = arguments["--count-distinct"].([]string)
+	opts.reportFormat = arguments["--report-format"].(string)
+	switch opts.reportFormat {
+	case "text", "json", "csv":
+	default:
+		fmt.Fprintf(os.Stderr, "invalid --report-format: %q, expected text, json or csv\n", opts.reportFormat)
+		os.Exit(1)
+	}
+	opts.topN, err = strconv.Atoi(arguments["--top-n"].(string))
+	if err != nil || opts.topN < 1 {
+		fmt.Fprintf(os.Stderr, "invalid --top-n: %q, expected a positive number\n", arguments["--top-n"])
+		os.Exit(1)
+	}
+	opts.alert, _ = arguments["--alert"].([]string)
+	opts.alertBell = arguments["--alert-bell"].(bool)
+	opts.alertNotify = arguments["--alert-notify"].(bool)
+	opts.alertCmd, _ = arguments["--alert-cmd"].(string)
+	opts.uniq = arguments["--uniq"].(bool)
+	opts.bursts = arguments["--bursts"].(bool)
+	opts.burstWindow, err = time.ParseDuration(arguments["--burst-window"].(string))
+	if err != nil || opts.burstWindow <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid burst window: %q\n", arguments["--burst-window"])
+		os.Exit(1)
+	}
+	opts.burstFactor, err = strconv.ParseFloat(arguments["--burst-factor"].(string), 64)
+	if err != nil || opts.burstFactor <= 1 {
+		fmt.Fprintf(os.Stderr, "invalid burst factor: %q, expected a number above 1\n", arguments["--burst-factor"])
+		os.Exit(1)
+	}
+	if gap, ok := arguments["--gap"].(string); ok {
+		opts.gap, err = time.ParseDuration(gap)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid gap: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	opts.group = arguments["--group"].(bool) || arguments["--group-by"] != nil
+	opts.groupBy, _ = arguments["--group-by"].(string)
+	opts.groupWindow, err = time.ParseDuration(arguments["--group-window"].(string))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid group window: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.groupWindow <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid group window: %v, expected a positive duration\n", opts.groupWindow)
+		os.Exit(1)
+	}
+	opts.afterContext, _ = arguments["--after-context"].(string)
+	opts.beforeContext, _ = arguments["--before-context"].(string)
+	opts.context, _ = arguments["--context"].(string)
+	opts.showPrefix = !arguments["--skip-prefix"].(bool)
+	opts.showSuffix = !arguments["--skip-suffix"].(bool)
+	opts.format, _ = arguments["--format"].(string)
+	opts.preset, _ = arguments["--preset"].(string)
+	opts.keys = make(map[string]string)
+	keys, _ := arguments["--key"].([]string)
+	for _, key := range keys {
+		name, path, ok := strings.Cut(key, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid key: %q, expected name=path\n", key)
+			os.Exit(1)
+		}
+		opts.keys[name] = path
+	}
+	opts.onMissing, _ = arguments["--on-missing"].(string)
+	opts.showFields = !arguments["--skip-fields"].(bool)
+	opts.maxFieldLength, _ = strconv.Atoi(arguments["--max-field-length"].(string))
+	opts.includeFields, _ = arguments["--include-fields"].(string)
+	opts.excludeFields, _ = arguments["--exclude-fields"].(string)
+	opts.objFields, _ = arguments["--obj-fields"].(string)
+	opts.fieldOrder, _ = arguments["--field-order"].(string)
+	opts.flatten, _ = arguments["--flatten"].(string)
+	opts.onCollision, _ = arguments["--on-collision"].(string)
+	opts.includeFieldsRe, _ = arguments["--include-fields-re"].(string)
+	opts.excludeFieldsRe, _ = arguments["--exclude-fields-re"].(string)
+	opts.rename = make(map[string]string)
+	renames, _ := arguments["--rename"].([]string)
+	for _, rename := range renames {
+		field, alias, ok := strings.Cut(rename, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid rename: %q, expected field=alias\n", rename)
+			os.Exit(1)
+		}
+		opts.rename[field] = alias
+	}
+	opts.units = make(map[string]string)
+	units, _ := arguments["--unit"].([]string)
+	for _, unit := range units {
+		field, name, ok := strings.Cut(unit, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid unit: %q, expected field=unit\n", unit)
+			os.Exit(1)
+		}
+		opts.units[field] = name
+	}
+	opts.alignFields = arguments["--align-fields"].(bool)
+	opts.wrapFields = arguments["--wrap-fields"].(bool)
+	opts.separateErrors = arguments["--separate-errors"].(bool)
+	opts.highlight = arguments["--highlight-syntax"].(bool)
+	opts.traceIDs = arguments["--trace-ids"].(bool)
+	opts.traceURL, _ = arguments["--trace-url"].(string)
+	opts.caller = arguments["--caller"].(bool)
+	opts.hyperlinks = arguments["--hyperlinks"].(bool)
+	opts.callerURL, _ = arguments["--caller-url"].(string)
+	opts.stackHighlight, _ = arguments["--stack-highlight"].(string)
+	opts.stackHead, _ = strconv.Atoi(arguments["--stack-head"].(string))
+	opts.stackTail, _ = strconv.Atoi(arguments["--stack-tail"].(string))
+	opts.stackHide, _ = arguments["--stack-hide"].(string)
+	opts.trailerFormat, _ = arguments["--trailer-format"].(string)
+	opts.maxDepth, _ = strconv.Atoi(arguments["--max-depth"].(string))
+	opts.maxArrayLength, _ = strconv.Atoi(arguments["--max-array-length"].(string))
+	opts.truncate = arguments["--truncate"].(bool)
+	truncateValues, _ := arguments["--truncate-values"].(string)
+	opts.truncateValues, _ = strconv.Atoi(truncateValues)
+	opts.truncateFields = make(map[string]int)
+	truncates, _ := arguments["--truncate-field"].([]string)
+	for _, truncate := range truncates {
+		field, length, ok := strings.Cut(truncate, "=")
+		opts.truncateFields[field], err = strconv.Atoi(length)
+		if !ok || field == "" || err != nil {
+			fmt.Fprintf(os.Stderr, "invalid truncate field: %q, expected field=length\n", truncate)
+			os.Exit(1)
+		}
+	}
+	opts.fieldColors = make(map[string]string)
+	fieldColors, _ := arguments["--field-color"].([]string)
+	for _, fieldColor := range fieldColors {
+		field, color, ok := strings.Cut(fieldColor, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid field color: %q, expected field=color\n", fieldColor)
+			os.Exit(1)
+		}
+		opts.fieldColors[field] = color
+	}
+	opts.colorRules, _ = arguments["--color-rule"].([]string)
+	opts.severityWidth, _ = strconv.Atoi(arguments["--severity-width"].(string))
+	opts.severityAlign, _ = arguments["--severity-align"].(string)
+	opts.truncateSeverity = arguments["--truncate-severity"].(bool)
+	opts.icons = arguments["--icons"].(bool)
+	opts.iconsOnly = arguments["--icons-only"].(bool)
+	opts.timezone, _ = arguments["--tz"].(string)
+	if arguments["--utc"].(bool) {
+		if opts.timezone != "" {
+			fmt.Fprintf(os.Stderr, "invalid --utc: can't be used with --tz %q\n", opts.timezone)
+			os.Exit(1)
+		}
+		opts.timezone = "UTC"
+	}
+	opts.relative, _ = arguments["--relative"].(string)
+	opts.timeFormat, _ = arguments["--time-format"].(string)
+	opts.timeLayouts, _ = arguments["--time-layout"].([]string)
+	opts.elapsed = arguments["--elapsed"].(bool)
+	opts.elapsedThreshold, err = time.ParseDuration(arguments["--elapsed-threshold"].(string))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid elapsed threshold: %v\n", err)
+		os.Exit(1)
+	}
+	opts.theme, _ = arguments["--theme"].(string)
+	opts.template, _ = arguments["--template"].(string)
+	opts.parser = arguments["--parser"].(string)
+	opts.output = arguments["--output"].(string)
+	if from := arguments["--from"].(string); opts.convert && from != "json" {
+		if _, ok := stream.Lookup(from); ok {
+			opts.parser = from
+		} else {
+			// Logs of a library are JSON read with its preset.
+			opts.preset = from
+		}
+	}
+	if _, ok := stream.Lookup(opts.parser); !ok {
+		fmt.Fprintf(os.Stderr, "unknown parser: %q, expected one of %s\n", opts.parser, strings.Join(stream.Parsers(), ", "))
+		os.Exit(1)
+	}
+	opts.tee, _ = arguments["--tee"].(string)
+	opts.pipefail = arguments["--pipefail"].(bool)
+	opts.strict = arguments["--strict"].(bool)
+	opts.schema, _ = arguments["--schema"].(string)
+	if opts.schema != "" {
+		opts.strict = true
+	}
+	opts.files = arguments["FILE"].([]string)
+	opts.follow = arguments["--follow"].(bool) || arguments["tail"].(bool)
+	opts.listen, _ = arguments["<addr>"].(string)
+	if resource, ok := arguments["<resource>"].(string); ok {
+		opts.command = append([]string{"kubectl", "logs", "--follow", "--all-containers", resource}, opts.command...)
+	}
+	opts.glob, _ = arguments["--glob"].(string)
+	if opts.glob != "" && !opts.follow {
+		// Without following, the files matching are read like the others.
+		matches, err := filepath.Glob(opts.glob)
+		if err != nil || len(matches) == 0 {
+			fmt.Fprintf(os.Stderr, "no file matches --glob %q\n", opts.glob)
+			os.Exit(1)
+		}
+		opts.files = append(opts.files, matches...)
+	}
+	opts.noConfig = arguments["--no-config"].(bool)
+	opts.profile, _ = arguments["--profile"].(string)
+	given := opts.clone()
+	opts.given = &given
+	if err := configure(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if err := install(opts, options{}); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 	return
 }
+
+// configure applies the configuration files to the options given, unless
+// --no-config is, along with the template, colors and preset chosen. The
+// colors and severities it sets in opts are installed apart, once the
+// options are known to be valid.
+func configure(opts *options) error {
+	if !opts.noConfig {
+		cfg, err := loadConfig(configPaths())
+		if opts.profile != "" && err == nil {
+			err = cfg.use(opts.profile)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid configuration: %v", err)
+		}
+		cfg.apply(opts)
+	}
+	if err := useTemplate(opts, opts.template); err != nil {
+		return fmt.Errorf("invalid --template: %v", err)
+	}
+	colors, err := themeColors(opts.theme, opts.colors, opts.themes)
+	if err != nil {
+		return fmt.Errorf("invalid colors: %v", err)
+	}
+	opts.elementColors = colors
+	if opts.preset != "" {
+		preset, ok := presets[opts.preset]
+		if !ok {
+			return fmt.Errorf("unknown preset: %q, expected one of %s", opts.preset, strings.Join(presetNames(), ", "))
+		}
+		if opts.severities == nil {
+			opts.severities = map[string]string{}
+		}
+		for from, to := range preset.severities {
+			opts.severities[from] = to
+		}
+	}
+	return nil
+}
+
+// install sets the colors and the severities of opts for all the
+// formatters, in place of those of previous. Neither is changed when the
+// colors are invalid.
+func install(opts, previous options) error {
+	structure.SetSeverities(opts.severities)
+	if err := structure.SetColors(opts.elementColors); err != nil {
+		structure.SetSeverities(previous.severities)
+		return fmt.Errorf("invalid colors: %v", err)
+	}
+	return nil
+}
+
+// clone returns a copy of the options which the configuration can be
+// applied to without changing them.
+func (opts options) clone() options {
+	fieldColors := make(map[string]string, len(opts.fieldColors))
+	for field, color := range opts.fieldColors {
+		fieldColors[field] = color
+	}
+	opts.fieldColors = fieldColors
+	keys := make(map[string]string, len(opts.keys))
+	for name, path := range opts.keys {
+		keys[name] = path
+	}
+	opts.keys = keys
+	opts.colorRules = opts.colorRules[:len(opts.colorRules):len(opts.colorRules)]
+	return opts
+}
+
+// usageOption is an option of the usage, by its names, ex: "-A" and
+// "--after-context". repeatable options can be given several times.
+type usageOption struct {
+	names      []string
+	long       string
+	value      bool
+	repeatable bool
+}
+
+// optionSpec matches the names of an option at the start of its line in
+// the usage, ex: "-A, --after-context <n>".
+var optionSpec = regexp.MustCompile(`^  (-[a-zA-Z], )?(--[a-z][a-z-]*)( <[^>]+>)?( |$)`)
+
+// usageOptions returns the options of the usage, those described in the
+// option sections: their descriptions are indented further, so the lines
+// of a description starting with "-" are none of them.
+func usageOptions() []usageOption {
+	var options []usageOption
+	for _, line := range strings.Split(usage, "\n") {
+		m := optionSpec.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		option := usageOption{long: m[2], value: m[3] != ""}
+		if m[1] != "" {
+			option.names = append(option.names, strings.TrimSuffix(m[1], ", "))
+		}
+		option.names = append(option.names, option.long)
+		option.repeatable = strings.Contains(usage, "["+option.long+m[3]+"]...")
+		options = append(options, option)
+	}
+	return options
+}
+
+// envArgs returns the options set in environment variables named after
+// them, ex: JL_EXCLUDE_FIELDS for --exclude-fields, which aren't among the
+// args given. Flags are set by values like "1" or "true", the options
+// which can be repeated by a value per line.
+func envArgs(args []string) ([]string, error) {
+	var env []string
+	for _, option := range usageOptions() {
+		if option.long == "--help" || option.long == "--version" || given(args, option.names) {
+			continue
+		}
+		variable := "JL_" + strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(option.long, "--"), "-", "_"))
+		text, ok := os.LookupEnv(variable)
+		if !ok || text == "" {
+			continue
+		}
+		switch {
+		case option.repeatable:
+			for _, value := range strings.Split(text, "\n") {
+				if value != "" {
+					env = append(env, option.long+"="+value)
+				}
+			}
+			continue
+		case option.value:
+			env = append(env, option.long+"="+text)
+			continue
+		}
+		set, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q, expected 1, true, 0 or false", variable, text)
+		}
+		if set {
+			env = append(env, option.long)
+		}
+	}
+	return env, nil
+}
+
+// given reports whether any of the names of an option is among args.
+func given(args []string, names []string) bool {
+	for _, arg := range args {
+		for _, name := range names {
+			if arg == name || strings.HasPrefix(arg, name+"=") ||
+				(!strings.HasPrefix(name, "--") && strings.HasPrefix(arg, name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
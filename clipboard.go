@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// clipboardCommands copy their stdin to the clipboard of the system, the
+// first one found is used.
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// copyToClipboard copies text to the clipboard with the command of the
+// system, or through the terminal with an OSC 52 escape sequence when none
+// works, as over SSH. It returns how it was copied.
+func copyToClipboard(tty io.Writer, text string) (string, error) {
+	for _, command := range clipboardCommands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err == nil {
+			return command[0], nil
+		}
+	}
+	_, err := fmt.Fprintf(tty, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return "the terminal", err
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfig is the name of the configuration file of a project, looked
+// up from the current directory to the root.
+const projectConfig = ".jl.yaml"
+
+// config holds the defaults read from the configuration files, the options
+// given on the command line override them. The profiles chosen with
+// --profile override some of them in turn.
+type config struct {
+	profile  `yaml:",inline"`
+	Profiles map[string]yaml.Node         `yaml:"profiles"`
+	Themes   map[string]map[string]string `yaml:"themes"`
+
+	// Templates are the templates chosen with --template by name, which
+	// include each other with {{template "name" .}}.
+	Templates map[string]string `yaml:"templates"`
+}
+
+// profile holds the settings of the configuration which can be overridden
+// by a profile, a template, fields and colors for a kind of logs.
+type profile struct {
+	Format        string            `yaml:"format"`
+	Template      string            `yaml:"template"`
+	Preset        string            `yaml:"preset"`
+	IncludeFields []string          `yaml:"include-fields"`
+	ExcludeFields []string          `yaml:"exclude-fields"`
+	ObjFields     []string          `yaml:"obj-fields"`
+	FieldColors   map[string]string `yaml:"field-colors"`
+	ColorRules    []string          `yaml:"color-rules"`
+
+	// Keys reads the timestamp, severity, message, logger, caller or error
+	// under other paths, ex: "timestamp: meta.time".
+	Keys map[string]string `yaml:"keys"`
+
+	// Severities reads some severities as others, ex: "notice: info".
+	Severities map[string]string `yaml:"severities"`
+
+	// Colors sets the colors of the severities and of the elements of the
+	// output, over those of the theme chosen among the themes.
+	Colors map[string]string `yaml:"colors"`
+	Theme  string            `yaml:"theme"`
+}
+
+// configPaths returns the configuration files read in order, those read
+// later overriding the ones before: the one of the user, then the one of
+// the project.
+func configPaths() []string {
+	var paths []string
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		paths = append(paths, filepath.Join(dir, "jl", "config.yaml"))
+	}
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			path := filepath.Join(dir, projectConfig)
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return paths
+}
+
+// loadConfig reads the configuration files which exist among paths, the
+// values of each overriding those of the previous ones and its maps merged
+// with theirs.
+func loadConfig(paths []string) (*config, error) {
+	cfg := &config{}
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// use overrides the settings of the configuration with those of the
+// profile named name.
+func (cfg *config) use(name string) error {
+	node, ok := cfg.Profiles[name]
+	if !ok {
+		var names []string
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q, none is configured", name)
+		}
+		return fmt.Errorf("unknown profile %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	if err := node.Decode(&cfg.profile); err != nil {
+		return fmt.Errorf("profile %s: %v", name, err)
+	}
+	return nil
+}
+
+// themes are the colors of the elements of the output by name of theme,
+// the configuration can add others.
+var themes = map[string]map[string]string{
+	// light suits terminals with a light background.
+	"light": {
+		"info":          "blue",
+		"warning":       "magenta",
+		"error":         "red+bold",
+		"fatal":         "red+bold+reverse",
+		"message":       "blue+bold",
+		"elapsed":       "magenta+bold",
+		"repeat":        "magenta",
+		"gap":           "magenta",
+		"stack.user":    "magenta",
+		"stack.library": "gray",
+	},
+}
+
+// apply sets the options not given from the configuration, along with the
+// severities it maps and its themes.
+func (cfg *config) apply(opts *options) {
+	if opts.template == "" && opts.format == "" {
+		opts.template = cfg.Template
+	}
+	if opts.format == "" {
+		opts.format = cfg.Format
+	}
+	opts.templates = cfg.Templates
+	if opts.preset == "" {
+		opts.preset = cfg.Preset
+	}
+	if opts.theme == "" {
+		opts.theme = cfg.Theme
+	}
+	opts.colors = cfg.Colors
+	if opts.includeFields == "" {
+		opts.includeFields = strings.Join(cfg.IncludeFields, ",")
+	}
+	if opts.excludeFields == "" {
+		opts.excludeFields = strings.Join(cfg.ExcludeFields, ",")
+	}
+	if opts.objFields == "" {
+		opts.objFields = strings.Join(cfg.ObjFields, ",")
+	}
+	for field, color := range cfg.FieldColors {
+		if _, ok := opts.fieldColors[field]; !ok {
+			opts.fieldColors[field] = color
+		}
+	}
+	for name, path := range cfg.Keys {
+		if _, ok := opts.keys[name]; !ok {
+			opts.keys[name] = path
+		}
+	}
+	// The first rule matching is applied, the ones given win.
+	opts.colorRules = append(opts.colorRules, cfg.ColorRules...)
+	opts.severities = make(map[string]string, len(cfg.Severities))
+	for from, to := range cfg.Severities {
+		opts.severities[from] = to
+	}
+	opts.themes = cfg.Themes
+}
+
+// useTemplate sets the format to the template named name of templates,
+// unless it's empty.
+func useTemplate(opts *options, name string) error {
+	if name == "" {
+		return nil
+	}
+	text, ok := opts.templates[name]
+	if !ok {
+		var names []string
+		for name := range opts.templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown template %q, none is configured", name)
+		}
+		return fmt.Errorf("unknown template %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	opts.format = text
+	return nil
+}
+
+// themeColors returns the colors of the theme named name, among the
+// themes of the configuration and the others, unless it's empty, and then
+// the colors given over them.
+func themeColors(name string, given map[string]string, configured map[string]map[string]string) (map[string]string, error) {
+	colors := map[string]string{}
+	if name != "" {
+		theme, ok := configured[name]
+		if !ok {
+			theme, ok = themes[name]
+		}
+		if !ok {
+			var names []string
+			for name := range themes {
+				names = append(names, name)
+			}
+			for name := range configured {
+				if _, ok := themes[name]; !ok {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+		for element, spec := range theme {
+			colors[element] = spec
+		}
+	}
+	for element, spec := range given {
+		colors[element] = spec
+	}
+	return colors, nil
+}
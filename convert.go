@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/robfig/jl/stream"
+	"github.com/robfig/jl/structure"
+)
+
+// convert writes the entries of the input matching the filters in the
+// format of --to, for jl convert. The lines which aren't entries are
+// written as entries with only a message.
+func convert(opts options) {
+	converter, err := structure.NewConverter(os.Stdout, opts.to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --to: %v\n", err)
+		os.Exit(1)
+	}
+	formatter := newFormatter(opts, io.Discard)
+	converter.Keys = formatter.Keys
+	if opts.includeFields != "" {
+		converter.Columns = strings.Split(opts.includeFields, ",")
+	}
+	filter := filters(opts).Match
+	pipeline := stages(opts)
+
+	r, err := openFiles(opts.files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open file: %v\n", err)
+		os.Exit(1)
+	}
+	parser, _ := stream.Lookup(opts.parser)
+	s := stream.NewParsed(r, parser)
+	for line := range s.Lines() {
+		entry, ok := readEntry(formatter, pipeline, line)
+		if !ok || !filter(entry) {
+			continue
+		}
+		if err := converter.Write(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := s.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// readEntry returns the entry of a line, one with only a message when it
+// has none, or false when a stage dropped it.
+func readEntry(formatter *structure.Formatter, stages *structure.Chain, line *stream.Line) (*structure.Entry, bool) {
+	entry, ok := decodeEntry(formatter, line)
+	if !ok {
+		return &structure.Entry{Message: string(line.Raw)}, true
+	}
+	if stages != nil && !runStages(stages, formatter, entry, line) {
+		return nil, false
+	}
+	return entry, true
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/robfig/jl/structure"
+)
+
+// detailColor shows the keys in the detail panel, branchColor the objects
+// and arrays which can be collapsed.
+var (
+	detailColor = color.New(color.FgBlue)
+	branchColor = color.New(color.FgBlue, color.Bold)
+)
+
+// detail is the panel beside the panes showing the fields of the entry
+// selected in the focused one as a tree, while they keep streaming.
+type detail struct {
+	open    bool
+	focused bool
+
+	// width and height are the size of the panel, with its title.
+	width  int
+	height int
+
+	// record is the entry shown, cursor the node the keys act on and top
+	// the first line shown. The paths collapsed are kept across entries.
+	record    *record
+	cursor    int
+	top       int
+	collapsed map[string]bool
+}
+
+// node is a line of the tree of fields, a branch when it's an object or
+// an array which can be collapsed.
+type node struct {
+	path   string
+	text   string
+	branch bool
+}
+
+// show shows the entry of r, from the start of its tree when it changed.
+func (d *detail) show(r *record) {
+	if r != d.record {
+		d.record, d.cursor, d.top = r, 0, 0
+	}
+}
+
+// nodes returns the lines of the tree of the fields of the entry shown,
+// preceded by the IDs it shares with other entries of p.
+func (d *detail) nodes(p *pane) []node {
+	r := d.record
+	if r == nil || r.out == nil {
+		return []node{{text: "no entry selected"}}
+	}
+	if r.out.raw {
+		return []node{{text: "not JSON: " + string(r.out.line.Raw)}}
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(r.out.line.JSON, &fields); err != nil {
+		return []node{{text: "invalid JSON: " + err.Error()}}
+	}
+	var nodes []node
+	for _, key := range structure.CorrelationKeys {
+		value, ok := structure.Lookup(fields, key)
+		if !ok {
+			continue
+		}
+		id := fmt.Sprintf("%v", value)
+		text := fmt.Sprintf("related %s=%s  %d entries", key, id, p.related(key, id))
+		nodes = append(nodes, node{text: selectedColor.Sprint(text)})
+	}
+	if len(nodes) > 0 {
+		nodes = append(nodes, node{})
+	}
+	return d.tree(nodes, "", 0, fields)
+}
+
+// tree appends the nodes of value, the key and value of each field of the
+// objects, its lines for multi-line strings like stack traces.
+func (d *detail) tree(nodes []node, path string, depth int, value interface{}) []node {
+	indent := strings.Repeat("  ", depth)
+	var keys []string
+	children := map[string]interface{}{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			keys = append(keys, key)
+			children[key] = child
+		}
+		sort.Strings(keys)
+	case []interface{}:
+		for i, child := range v {
+			key := fmt.Sprintf("[%d]", i)
+			keys = append(keys, key)
+			children[key] = child
+		}
+	}
+	for _, key := range keys {
+		child := children[key]
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		switch v := child.(type) {
+		case map[string]interface{}, []interface{}:
+			collapsed := d.collapsed[childPath]
+			sign, size := "▾ ", len(keysOf(v))
+			if collapsed {
+				sign = "▸ "
+			}
+			text := indent + branchColor.Sprint(sign+key) + detailColor.Sprintf(" (%d)", size)
+			nodes = append(nodes, node{path: childPath, text: text, branch: true})
+			if !collapsed {
+				nodes = d.tree(nodes, childPath, depth+1, v)
+			}
+		case string:
+			lines := strings.Split(strings.TrimRight(v, "\n"), "\n")
+			nodes = append(nodes, node{path: childPath, text: indent + "  " + detailColor.Sprint(key+": ") + lines[0]})
+			for _, line := range lines[1:] {
+				nodes = append(nodes, node{path: childPath, text: indent + "    " + strings.ReplaceAll(line, "\t", "    ")})
+			}
+		default:
+			text := "null"
+			if child != nil {
+				b, _ := json.Marshal(child)
+				text = string(b)
+			}
+			nodes = append(nodes, node{path: childPath, text: indent + "  " + detailColor.Sprint(key+": ") + text})
+		}
+	}
+	return nodes
+}
+
+// keysOf returns the keys of an object, or the indexes of an array.
+func keysOf(value interface{}) []string {
+	var keys []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	case []interface{}:
+		for i := range v {
+			keys = append(keys, fmt.Sprint(i))
+		}
+	}
+	return keys
+}
+
+// related counts the entries of the pane with the value id for key.
+func (p *pane) related(key, id string) int {
+	n := 0
+	for _, r := range p.records {
+		if r.out == nil || r.out.entry.Fields == nil {
+			continue
+		}
+		if value, ok := structure.Lookup(r.out.entry.Fields, key); ok && fmt.Sprintf("%v", value) == id {
+			n++
+		}
+	}
+	return n
+}
+
+// move moves the cursor n nodes down, or up when n is negative.
+func (d *detail) move(p *pane, n int) {
+	d.cursor += n
+	if last := len(d.nodes(p)) - 1; d.cursor > last {
+		d.cursor = last
+	}
+	if d.cursor < 0 {
+		d.cursor = 0
+	}
+}
+
+// toggle collapses the object or array under the cursor, or expands it.
+func (d *detail) toggle(p *pane) {
+	nodes := d.nodes(p)
+	if d.cursor >= len(nodes) || !nodes[d.cursor].branch {
+		return
+	}
+	if d.collapsed == nil {
+		d.collapsed = map[string]bool{}
+	}
+	path := nodes[d.cursor].path
+	d.collapsed[path] = !d.collapsed[path]
+}
+
+// render returns the lines of the panel, its title highlighted when it
+// has the focus and the node under the cursor marked in the margin.
+func (d *detail) render(p *pane) []string {
+	nodes := d.nodes(p)
+	if d.cursor >= len(nodes) {
+		d.cursor = len(nodes) - 1
+	}
+	rows := d.height - 1
+	if d.cursor >= d.top+rows {
+		d.top = d.cursor - rows + 1
+	}
+	if d.cursor < d.top {
+		d.top = d.cursor
+	}
+	title := fit(" fields", d.width)
+	if d.focused {
+		title = "\x1b[7m" + title + "\x1b[0m"
+	} else {
+		title = "\x1b[2m" + title + "\x1b[0m"
+	}
+	lines := []string{title}
+	for i := 0; i < rows; i++ {
+		n := d.top + i
+		if n >= len(nodes) {
+			lines = append(lines, fit("", d.width))
+			continue
+		}
+		margin := " "
+		if d.focused && n == d.cursor {
+			margin = selectedColor.Sprint("▌")
+		}
+		lines = append(lines, fit(margin+nodes[n].text, d.width))
+	}
+	return lines
+}
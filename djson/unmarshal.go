@@ -37,16 +37,65 @@ func process(data []byte, val interface{}, elem reflect.Type, i int) {
 				continue
 			}
 		}
-		value := reflect.ValueOf(result.Value())
-		fieldValue := reflect.ValueOf(val).Elem().FieldByIndex(field.Index)
-		if fieldValue.Kind() == reflect.Ptr {
-			if fieldValue.IsNil() {
-				fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+		set(val, field, result.Value())
+	}
+}
+
+// UnmarshalFields is like Unmarshal for JSON already decoded into fields,
+// reading the same keys without parsing it again.
+func UnmarshalFields(fields map[string]interface{}, val interface{}) {
+	elem := reflect.TypeOf(val).Elem()
+	for i := 0; i < elem.NumField(); i++ {
+		processFields(fields, val, elem, i)
+	}
+}
+
+func processFields(fields map[string]interface{}, val interface{}, elem reflect.Type, i int) {
+	defer func() {
+		_ = recover()
+	}()
+	field := elem.FieldByIndex([]int{i})
+	keys, ok := field.Tag.Lookup("djson")
+	if !ok {
+		return
+	}
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		value, ok := lookup(fields, key)
+		if !ok {
+			if value, ok = fields[key]; !ok {
+				continue
 			}
-			fieldValue.Elem().Set(convert(value, fieldValue.Elem()))
-		} else {
-			fieldValue.Set(convert(value, fieldValue))
 		}
+		set(val, field, value)
+	}
+}
+
+// lookup returns the value at the dotted path key of fields, like gjson.
+func lookup(fields map[string]interface{}, key string) (interface{}, bool) {
+	var value interface{} = fields
+	for _, part := range strings.Split(key, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func set(val interface{}, field reflect.StructField, v interface{}) {
+	value := reflect.ValueOf(v)
+	fieldValue := reflect.ValueOf(val).Elem().FieldByIndex(field.Index)
+	if fieldValue.Kind() == reflect.Ptr {
+		if fieldValue.IsNil() {
+			fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+		}
+		fieldValue.Elem().Set(convert(value, fieldValue.Elem()))
+	} else {
+		fieldValue.Set(convert(value, fieldValue))
 	}
 }
 
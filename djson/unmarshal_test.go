@@ -2,6 +2,7 @@ package djson_test
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
 
@@ -140,3 +141,30 @@ func TestDoubleNestedType(t *testing.T) {
 		t.Error("failed to set .Level from nested path")
 	}
 }
+
+func TestUnmarshalFields(t *testing.T) {
+	t.Parallel()
+	type entry struct {
+		Timestamp *time.Time `djson:"time,ts"`
+		Raw       string     `djson:"time,ts"`
+		Level     string     `djson:"level,log.level"`
+		Message   string     `djson:"msg,message"`
+	}
+	for _, in := range []string{
+		`{"msg": "Hi", "level": "info", "time": "2017-11-07T15:34:32Z"}`,
+		`{"message": "Hi", "log": {"level": "warning"}, "ts": 1565361391.4279764}`,
+		`{"message": "Hi", "log.level": "debug", "level": "info"}`,
+		`{"msg": null, "level": 3}`,
+	} {
+		var expect, got entry
+		djson.Unmarshal([]byte(in), &expect)
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(in), &fields); err != nil {
+			t.Fatalf("failed to decode %s: %v", in, err)
+		}
+		djson.UnmarshalFields(fields, &got)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("%s:\n\tnot match: %+v\n\t   expect: %+v", in, got, expect)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// brokenPipeStatus is the exit status of a program killed by SIGPIPE in
+// shells, jl exits with it when its output is closed with --pipefail.
+const brokenPipeStatus = 128 + 13
+
+// forwardedSignals are passed on to the command run. An interrupt from the
+// terminal is sent to the command along with jl, which keeps formatting
+// its output until it exits.
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// command is a command run in exec mode, its stdout and stderr are read
+// merged line by line.
+type command struct {
+	*merger
+	cmd    *exec.Cmd
+	done   chan struct{}
+	status int
+}
+
+// startCommand runs the command of args.
+func startCommand(args []string) (*command, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := &command{merger: newMerger(), cmd: cmd, done: make(chan struct{})}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	signal.Ignore(os.Interrupt)
+	go func() {
+		for sig := range signals {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.copy(stdout, "stdout")
+	}()
+	go func() {
+		defer wg.Done()
+		c.copy(stderr, "stderr")
+	}()
+	go func() {
+		wg.Wait()
+		c.status = exitStatus(cmd.Wait())
+		signal.Stop(signals)
+		close(signals)
+		c.end()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// stderr reports whether the next line of the output came from stderr, it
+// must be called once for each line read.
+func (c *command) stderr() bool {
+	return c.origin() == "stderr"
+}
+
+// stop terminates the command.
+func (c *command) stop() {
+	_ = c.cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// wait waits for the command to exit and returns its exit status.
+func (c *command) wait() int {
+	<-c.done
+	return c.status
+}
+
+// exitStatus returns the exit status of the command from the error of its
+// wait, 128 plus the signal like shells when it was killed by one.
+func exitStatus(err error) int {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		if err != nil {
+			return 1
+		}
+		return 0
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
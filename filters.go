@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/jl/structure"
+)
+
+// filters builds the chain of filters deciding which entries are shown
+// from the filtering options.
+func filters(opts options) *structure.Chain {
+	chain := &structure.Chain{Any: opts.or}
+	if opts.level != "" {
+		filter, err := structure.MinSeverity(opts.level)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --level: %v\n", err)
+			os.Exit(1)
+		}
+		chain.Add("--level "+opts.level, filter)
+	}
+	if opts.errors {
+		chain.Add("--errors", structure.Errors())
+	}
+	if opts.only != "" {
+		chain.Add("--only "+opts.only, structure.OnlySeverities(strings.Split(opts.only, ",")))
+	}
+	if opts.not != "" {
+		chain.Add("--not "+opts.not, structure.ExceptSeverities(strings.Split(opts.not, ",")))
+	}
+	if opts.logger != "" {
+		chain.Add("--logger "+opts.logger, structure.Logger(strings.Split(opts.logger, ",")))
+	}
+	for _, where := range opts.where {
+		condition, err := structure.ParseCondition(where)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --where: %v\n", err)
+			os.Exit(1)
+		}
+		chain.Add("--where "+where, structure.Where(condition))
+	}
+	if opts.grep != "" {
+		re, err := regexp.Compile(opts.grep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --grep: %v\n", err)
+			os.Exit(1)
+		}
+		chain.Add("--grep "+opts.grep, structure.Grep(re, opts.grepFields))
+	}
+	for _, grep := range opts.grepV {
+		re, err := regexp.Compile(grep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --grep-v: %v\n", err)
+			os.Exit(1)
+		}
+		chain.Add("--grep-v "+grep, structure.Not(structure.Grep(re, opts.grepFields)))
+	}
+	if opts.since != "" || opts.until != "" {
+		since, until := timeRange(opts)
+		chain.Add("--since/--until", structure.TimeRange(since, until))
+	}
+	for _, expr := range opts.filter {
+		filter, err := structure.ParseExpression(expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --filter: %v\n", err)
+			os.Exit(1)
+		}
+		chain.Add("--filter "+expr, filter)
+	}
+
+	// Following requests and sampling apply to the entries matching the
+	// filters above, whether they are combined with AND or OR.
+	top := chain
+	switch {
+	case len(opts.followID) > 0 || opts.followRelated:
+		top = &structure.Chain{}
+		top.Nest("--follow", chain, follow(opts, chain.Match))
+	case opts.or:
+		top = &structure.Chain{}
+		top.Nest("--or", chain, chain.Match)
+	}
+	if opts.sample != "" {
+		fraction, err := strconv.ParseFloat(opts.sample, 64)
+		if err != nil || fraction <= 0 || fraction > 1 {
+			fmt.Fprintf(os.Stderr, "invalid --sample: %q, expected a fraction like 0.01\n", opts.sample)
+			os.Exit(1)
+		}
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		top.Add("--sample "+opts.sample, structure.Sample(fraction, random.Float64))
+	}
+	if opts.every != "" {
+		n, err := strconv.Atoi(opts.every)
+		if err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "invalid --every: %q, expected a positive number\n", opts.every)
+			os.Exit(1)
+		}
+		top.Add("--every "+opts.every, structure.Every(n))
+	}
+	return top
+}
+
+// stages builds the chain of stages changing the entries as soon as they're
+// read, before anything else sees them, the fields of --redact hidden. It
+// is nil when there are none.
+func stages(opts options) *structure.Chain {
+	if len(opts.redact) == 0 {
+		return nil
+	}
+	chain := &structure.Chain{}
+	for _, field := range opts.redact {
+		chain.Use("--redact "+field, structure.Redact(field))
+	}
+	return chain
+}
+
+// follow extends filter to the entries sharing a correlation ID with the
+// entries it matches, which have to match a --follow-id too.
+func follow(opts options, filter structure.Filter) structure.Filter {
+	keys := append([]string{}, structure.CorrelationKeys...)
+	if len(opts.followID) > 0 {
+		var ids []structure.Filter
+		for _, id := range opts.followID {
+			condition, err := structure.ParseCondition(id)
+			if err != nil || condition.Op != "=" {
+				fmt.Fprintf(os.Stderr, "invalid --follow-id: %q, expected <field>=<id>\n", id)
+				os.Exit(1)
+			}
+			ids = append(ids, structure.Where(condition))
+			keys = append(keys, condition.Field)
+		}
+		filter = structure.All(filter, structure.Any(ids...))
+	}
+	return structure.Follow(filter, keys)
+}
+
+// timeRange parses the --since and --until bounds.
+func timeRange(opts options) (since, until time.Time) {
+	now := time.Now()
+	var loc *time.Location
+	if opts.timezone != "" {
+		loc, _ = time.LoadLocation(opts.timezone)
+	}
+	var err error
+	if opts.since != "" {
+		if since, err = structure.ParseTimeBound(opts.since, now, loc); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --since: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if opts.until != "" {
+		if until, err = structure.ParseTimeBound(opts.until, now, loc); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --until: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	return since, until
+}
+
+// errorContext returns how many lines of the same request or logger to show
+// before each error with --errors.
+func errorContext(opts options) int {
+	if !opts.errors {
+		return 0
+	}
+	n, err := strconv.Atoi(opts.errorContext)
+	if err != nil || n < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --error-context: %q, expected a number\n", opts.errorContext)
+		os.Exit(1)
+	}
+	return n
+}
+
+// contextLines returns how many lines to show before and after each
+// matching entry, -A and -B taking precedence over -C.
+func contextLines(opts options) (before, after int) {
+	parse := func(flag, value string) int {
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "invalid %s: %q, expected a number\n", flag, value)
+			os.Exit(1)
+		}
+		return n
+	}
+	before = parse("--context", opts.context)
+	after = before
+	if opts.beforeContext != "" {
+		before = parse("--before-context", opts.beforeContext)
+	}
+	if opts.afterContext != "" {
+		after = parse("--after-context", opts.afterContext)
+	}
+	return before, after
+}
+
+// highlight returns the pattern of which the matches are highlighted, the
+// --hl pattern and the --grep one.
+func highlight(opts options) *regexp.Regexp {
+	var patterns []string
+	for _, pattern := range []string{opts.hl, opts.grep} {
+		if pattern != "" {
+			patterns = append(patterns, "(?:"+pattern+")")
+		}
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	re, err := regexp.Compile(strings.Join(patterns, "|"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --hl: %v\n", err)
+		os.Exit(1)
+	}
+	return re
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often the files followed are checked for new lines,
+// and the glob for new files.
+const pollInterval = 250 * time.Millisecond
+
+// follower reads files as they grow like tail -f, along with the files
+// created which match a glob, merging their lines. They are labeled with
+// the name of their file when there may be several.
+type follower struct {
+	*merger
+	glob     string
+	labels   bool
+	width    int
+	followed map[string]bool
+}
+
+// followFiles follows the files, stdin for "-", and those matching the
+// glob unless it's empty.
+func followFiles(files []string, glob string) (*follower, error) {
+	f := &follower{merger: newMerger(), glob: glob, followed: make(map[string]bool)}
+	var paths []string
+	for _, file := range files {
+		if file != "" {
+			paths = append(paths, file)
+		}
+	}
+	if glob != "" {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", glob, err)
+		}
+		paths = append(paths, matches...)
+	}
+	f.labels = glob != "" || len(paths) > 1
+	if f.labels {
+		f.width = labelWidth(eachFile(paths))
+	}
+	for _, path := range paths {
+		if f.followed[path] {
+			continue
+		}
+		f.followed[path] = true
+		if path == "-" {
+			go f.copy(os.Stdin, f.label(path))
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		go f.tail(file, path)
+	}
+	if glob != "" {
+		go f.watch()
+	}
+	return f, nil
+}
+
+// label returns the label of the lines of the file at path.
+func (f *follower) label(path string) string {
+	if !f.labels {
+		return ""
+	}
+	return sourceLabel(path)
+}
+
+// watch follows the files created which match the glob.
+func (f *follower) watch() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		matches, _ := filepath.Glob(f.glob)
+		for _, path := range matches {
+			if f.followed[path] {
+				continue
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.followed[path] = true
+			go f.tail(file, path)
+		}
+	}
+}
+
+// tail reads the lines of file as they are written, reopening path when it
+// was rotated and reading it again from the start when truncated.
+func (f *follower) tail(file *os.File, path string) {
+	label := f.label(path)
+	r := bufio.NewReader(file)
+	var partial []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			if f.writeLine(partial, label) != nil {
+				file.Close()
+				return
+			}
+			partial = nil
+			continue
+		}
+		if err != io.EOF {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", path, err)
+			file.Close()
+			return
+		}
+		time.Sleep(pollInterval)
+		if next, ok := reopen(file, path); ok {
+			file = next
+			r.Reset(file)
+			partial = nil
+		}
+	}
+}
+
+// reopen returns the file at path to read next when it's no longer file,
+// or file read from the start when it was truncated.
+func reopen(file *os.File, path string) (*os.File, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	current, err := file.Stat()
+	if err != nil {
+		return nil, false
+	}
+	if os.SameFile(info, current) {
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil || info.Size() >= offset {
+			return nil, false
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, false
+		}
+		return file, true
+	}
+	next, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	file.Close()
+	return next, true
+}
@@ -7,11 +7,12 @@ require (
 	github.com/fatih/color v1.6.0
 	github.com/mattn/go-isatty v0.0.8
 	github.com/tidwall/gjson v1.9.3
+	golang.org/x/sys v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.2 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
-	golang.org/x/sys v0.1.0 // indirect
 )
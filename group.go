@@ -0,0 +1,78 @@
+package main
+
+import (
+	"time"
+
+	"github.com/robfig/jl/structure"
+)
+
+// grouper holds back the lines of requests until no more of them came for
+// a while, to write them together under a header.
+type grouper struct {
+	keys   []string
+	window time.Duration
+
+	groups map[string]*group
+	order  []*group
+}
+
+type group struct {
+	id      string
+	outputs []*output
+	seen    time.Time
+
+	first, last *time.Time
+}
+
+func newGrouper(keys []string, window time.Duration) *grouper {
+	return &grouper{keys: keys, window: window, groups: make(map[string]*group)}
+}
+
+// add holds back out in the group of its correlation ID, it returns false
+// when out has none.
+func (g *grouper) add(out *output, now time.Time) bool {
+	id, ok := structure.CorrelationID(out.entry.Fields, g.keys)
+	if !ok {
+		return false
+	}
+	grp, ok := g.groups[id]
+	if !ok {
+		grp = &group{id: id}
+		g.groups[id] = grp
+		g.order = append(g.order, grp)
+	}
+	grp.outputs = append(grp.outputs, out)
+	grp.seen = now
+	if ts := out.entry.Timestamp; ts != nil {
+		if grp.first == nil {
+			grp.first = ts
+		}
+		grp.last = ts
+	}
+	return true
+}
+
+// done removes and returns the groups no lines came for during the window,
+// or all groups when now is zero.
+func (g *grouper) done(now time.Time) []*group {
+	var done, pending []*group
+	for _, grp := range g.order {
+		if now.IsZero() || now.Sub(grp.seen) >= g.window {
+			done = append(done, grp)
+			delete(g.groups, grp.id)
+		} else {
+			pending = append(pending, grp)
+		}
+	}
+	g.order = pending
+	return done
+}
+
+// header renders the line written above the lines of the group.
+func (grp *group) header() string {
+	var elapsed time.Duration
+	if grp.first != nil {
+		elapsed = grp.last.Sub(*grp.first)
+	}
+	return structure.GroupHeader(grp.id, len(grp.outputs), elapsed)
+}
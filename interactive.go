@@ -0,0 +1,664 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/robfig/jl/stream"
+	"github.com/robfig/jl/structure"
+)
+
+// renderInterval is how often the interactive view is redrawn when new
+// lines arrive.
+const renderInterval = 50 * time.Millisecond
+
+// view is the full-screen interactive mode, showing the entries of each
+// source in a pane, stacked or side by side.
+type view struct {
+	mu    sync.Mutex
+	panes []*pane
+	focus int
+	side  bool
+	dirty bool
+
+	// detail shows the fields of the entry selected in the focused pane.
+	detail detail
+
+	// hidden are the classes of severities hidden in all the panes, by
+	// the key toggling them.
+	hidden map[string]bool
+
+	tty    *os.File
+	width  int
+	height int
+
+	// prompt is the line being typed at the bottom of the view, message
+	// is shown there until the next key.
+	prompt  *prompt
+	message string
+}
+
+// prompt is a line of text typed at the bottom of the view, change is
+// called as it's edited and done once it's entered or canceled.
+type prompt struct {
+	label  string
+	text   string
+	err    string
+	change func(text string) error
+	done   func(text string, ok bool)
+}
+
+func newView() *view {
+	return &view{}
+}
+
+// addPane adds a pane showing the entries of the source named name.
+func (v *view) addPane(name string) *pane {
+	p := &pane{v: v, name: name, follow: true}
+	v.panes = append(v.panes, p)
+	return p
+}
+
+// finish marks the end of the input of p.
+func (v *view) finish(p *pane) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	p.done, v.dirty = true, true
+}
+
+// run shows the view on the terminal until it's quit.
+func (v *view) run() error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	restore, err := rawMode(tty)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	v.tty = tty
+
+	// Switching to the alternate screen leaves the terminal as it was when
+	// quitting.
+	_, _ = tty.WriteString("\x1b[?1049h\x1b[?25l")
+	defer tty.WriteString("\x1b[?25h\x1b[?1049l")
+
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+	keys := make(chan string)
+	go readKeys(tty, keys)
+	ticker := time.NewTicker(renderInterval)
+	defer ticker.Stop()
+
+	v.resize()
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || !v.key(key) {
+				return nil
+			}
+		case <-resize:
+			v.resize()
+		case <-ticker.C:
+		}
+		v.mu.Lock()
+		if v.dirty {
+			v.render()
+			v.dirty = false
+		}
+		v.mu.Unlock()
+	}
+}
+
+func (v *view) resize() {
+	width, height, err := terminalSize(v.tty)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err == nil && width > 0 && height > 0 {
+		v.width, v.height = width, height
+	} else {
+		v.width, v.height = 80, 24
+	}
+	v.arrange()
+}
+
+// arrange sizes the panes to share the screen above the status bar, each
+// under its title when there are several, left of the detail panel when
+// it's open.
+func (v *view) arrange() {
+	n := len(v.panes)
+	rows := v.height - 1
+	width := v.width
+	if v.detail.open {
+		v.detail.width = v.width * 2 / 5
+		v.detail.height = rows
+		width -= v.detail.width + 1
+	}
+	if n == 1 {
+		v.panes[0].width, v.panes[0].height = width, rows
+	}
+	for i, p := range v.panes {
+		switch {
+		case n == 1:
+		case v.side:
+			p.width = (width - (n - 1)) / n
+			if i == n-1 {
+				p.width = width - (n-1)*(p.width+1)
+			}
+			p.height = rows - 1
+		default:
+			height := rows / n
+			if i == n-1 {
+				height = rows - (n-1)*height
+			}
+			p.width, p.height = width, height-1
+		}
+		if p.height < 1 {
+			p.height = 1
+		}
+	}
+	v.dirty = true
+}
+
+// key handles a key pressed, it returns false to quit.
+func (v *view) key(key string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.dirty = true
+	v.message = ""
+	if v.prompt != nil {
+		v.edit(key)
+		return true
+	}
+	p := v.panes[v.focus]
+	if v.detail.focused && v.detailKey(p, key) {
+		return true
+	}
+	switch key {
+	case "q", "ctrl+c":
+		return false
+	case "tab":
+		v.next()
+	case "e", "w", "i", "d":
+		if v.hidden == nil {
+			v.hidden = map[string]bool{}
+		}
+		v.hidden[key] = !v.hidden[key]
+		for _, p := range v.panes {
+			p.changed()
+		}
+	case "o":
+		v.detail.open = !v.detail.open
+		v.detail.focused = false
+		v.arrange()
+	case "|":
+		v.side = !v.side
+		v.arrange()
+	case "&":
+		v.editFilter(p)
+	case "/":
+		v.editSearch(p)
+	case "n":
+		v.message = p.next(1)
+	case "N":
+		v.message = p.next(-1)
+	case "enter":
+		if p.selected != nil {
+			p.expand(p.selected, !p.selected.expanded)
+		}
+	case "m":
+		if p.selected != nil && p.selected.out != nil {
+			p.selected.marked = !p.selected.marked
+		}
+	case "y", "Y":
+		if p.selected != nil {
+			v.copy(p.selected.text(key == "Y"), key == "Y")
+		}
+	case "'":
+		v.message = p.nextMark(1)
+	case "\"":
+		v.message = p.nextMark(-1)
+	case "j", "down":
+		p.move(1)
+	case "k", "up":
+		p.move(-1)
+	case "ctrl+d":
+		p.moveLines(p.height / 2)
+	case "ctrl+u":
+		p.moveLines(-p.height / 2)
+	case "f", "pgdown", "ctrl+f":
+		p.moveLines(p.height)
+	case "b", "pgup", "ctrl+b":
+		p.moveLines(-p.height)
+	case "g", "home":
+		p.first()
+	case "G", "end":
+		p.pause(false)
+	case " ":
+		for _, other := range v.panes {
+			other.pause(!p.paused)
+		}
+	}
+	v.sync(p)
+	return true
+}
+
+// next moves the focus to the next pane, or to the detail panel after the
+// last one when it's open.
+func (v *view) next() {
+	switch {
+	case v.detail.focused:
+		v.detail.focused, v.focus = false, 0
+	case v.detail.open && v.focus == len(v.panes)-1:
+		v.detail.focused = true
+	default:
+		v.focus = (v.focus + 1) % len(v.panes)
+	}
+}
+
+// detailKey handles a key pressed while the detail panel has the focus,
+// moving in the tree of the entry of p and collapsing its nodes. It
+// returns false for the keys acting on the pane.
+func (v *view) detailKey(p *pane, key string) bool {
+	d := &v.detail
+	switch key {
+	case "j", "down":
+		d.move(p, 1)
+	case "k", "up":
+		d.move(p, -1)
+	case "ctrl+d", "f", "pgdown", "ctrl+f":
+		d.move(p, d.height-1)
+	case "ctrl+u", "b", "pgup", "ctrl+b":
+		d.move(p, 1-d.height)
+	case "g", "home":
+		d.cursor = 0
+	case "G", "end":
+		d.move(p, len(d.nodes(p)))
+	case "enter":
+		d.toggle(p)
+	default:
+		return false
+	}
+	return true
+}
+
+// copy copies the text of the selected entry to the clipboard, its JSON or
+// its lines when rendered.
+func (v *view) copy(text string, rendered bool) {
+	what := "JSON"
+	if rendered {
+		what = "lines"
+	}
+	how, err := copyToClipboard(v.tty, text)
+	if err != nil {
+		v.message = fmt.Sprintf("failed to copy the %s: %v", what, err)
+		return
+	}
+	v.message = fmt.Sprintf("copied the %s with %s", what, how)
+}
+
+// sync selects in the other panes the entries at the time of the one
+// selected in p, or follows their streams along with it.
+func (v *view) sync(p *pane) {
+	if len(v.panes) == 1 {
+		return
+	}
+	p.layout()
+	for _, other := range v.panes {
+		switch {
+		case other == p:
+		case p.follow:
+			other.pause(false)
+		case p.selected != nil && p.selected.timestamp() != nil:
+			other.selectAt(*p.selected.timestamp())
+		}
+	}
+}
+
+// editFilter prompts for the query filtering the entries of p, applied as
+// it's typed and reverted when canceled.
+func (v *view) editFilter(p *pane) {
+	previous := p.query
+	v.prompt = &prompt{
+		label:  "filter: ",
+		text:   p.query,
+		change: p.setQuery,
+		done: func(text string, ok bool) {
+			if !ok {
+				_ = p.setQuery(previous)
+			}
+		},
+	}
+}
+
+// editSearch prompts for the pattern to search in p, highlighted as it's
+// typed and moved to once entered.
+func (v *view) editSearch(p *pane) {
+	previous := p.pattern
+	v.prompt = &prompt{
+		label:  "/",
+		change: p.setSearch,
+		done: func(text string, ok bool) {
+			switch {
+			case !ok:
+				_ = p.setSearch(previous)
+			case p.search != nil:
+				v.message = p.next(0)
+			}
+		},
+	}
+}
+
+// edit handles a key pressed while typing in the prompt.
+func (v *view) edit(key string) {
+	p := v.prompt
+	switch key {
+	case "enter", "esc", "ctrl+c":
+		v.prompt = nil
+		p.done(p.text, key == "enter" && p.err == "")
+		return
+	case "backspace":
+		if _, size := utf8.DecodeLastRuneInString(p.text); size > 0 {
+			p.text = p.text[:len(p.text)-size]
+		}
+	case "ctrl+u":
+		p.text = ""
+	default:
+		if utf8.RuneCountInString(key) != 1 {
+			return
+		}
+		p.text += key
+	}
+	p.err = ""
+	if err := p.change(p.text); err != nil {
+		p.err = err.Error()
+	}
+}
+
+// render draws the panes, under their titles when there are several, and
+// the status bar.
+func (v *view) render() {
+	var screen []string
+	if len(v.panes) == 1 {
+		screen = v.panes[0].render()
+	} else if v.side {
+		var titles []string
+		columns := make([][]string, len(v.panes))
+		for i, p := range v.panes {
+			titles = append(titles, v.title(i))
+			columns[i] = p.render()
+		}
+		screen = append(screen, strings.Join(titles, " "))
+		for row := range columns[0] {
+			cells := make([]string, len(columns))
+			for i := range columns {
+				cells[i] = columns[i][row]
+			}
+			screen = append(screen, strings.Join(cells, "\x1b[0m│"))
+		}
+	} else {
+		for i, p := range v.panes {
+			screen = append(screen, v.title(i))
+			screen = append(screen, p.render()...)
+		}
+	}
+	if v.detail.open {
+		p := v.panes[v.focus]
+		p.layout()
+		v.detail.show(p.selected)
+		for i, line := range v.detail.render(p) {
+			if i < len(screen) {
+				screen[i] += "\x1b[0m│" + line
+			}
+		}
+	}
+	var b bytes.Buffer
+	for i, line := range screen {
+		fmt.Fprintf(&b, "\x1b[%d;1H\x1b[2K%s\x1b[0m", i+1, line)
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H\x1b[2K\x1b[7m%s\x1b[0m", v.height, v.status())
+	_, _ = v.tty.Write(b.Bytes())
+}
+
+// title returns the title of the i-th pane, its name and information,
+// highlighted when it has the focus.
+func (v *view) title(i int) string {
+	p := v.panes[i]
+	title := fit(" "+p.name+p.info(), p.width)
+	if i == v.focus && !v.detail.focused {
+		return "\x1b[7m" + title + "\x1b[0m"
+	}
+	return "\x1b[2m" + title + "\x1b[0m"
+}
+
+// status returns the status bar: the prompt when typing, or the message,
+// the information about the pane when it's the only one, and help.
+func (v *view) status() string {
+	if p := v.prompt; p != nil {
+		line := " " + p.label + p.text + "█"
+		if p.err != "" {
+			line += "  " + p.err
+		}
+		return fit(line, v.width)
+	}
+	status := " " + v.levels()
+	if len(v.panes) == 1 {
+		status += v.panes[0].info()
+	}
+	if v.message != "" {
+		status += "  " + v.message
+	}
+	help := "q:quit  space:pause  ⏎:expand  o:fields  m:mark  &:filter  /:search "
+	if len(v.panes) > 1 {
+		help = "tab:pane  |:layout  " + help
+	}
+	padding := v.width - utf8.RuneCountInString(status) - utf8.RuneCountInString(help)
+	if padding < 1 {
+		return fit(status, v.width)
+	}
+	return status + strings.Repeat(" ", padding) + help
+}
+
+// severityKeys are the keys toggling the classes of severities, from the
+// most severe.
+var severityKeys = []string{"e", "w", "i", "d"}
+
+// levels returns the state of the severity toggles, the key of the classes
+// shown in capitals and "-" for those hidden.
+func (v *view) levels() string {
+	var levels string
+	for _, key := range severityKeys {
+		if v.hidden[key] {
+			levels += "-"
+		} else {
+			levels += strings.ToUpper(key)
+		}
+	}
+	return levels
+}
+
+// severityKey returns the key toggling the class of the severity: errors,
+// warnings, infos or debug messages. It returns false for unknown ones.
+func severityKey(severity string) (string, bool) {
+	level, ok := structure.SeverityLevel(severity)
+	switch {
+	case !ok:
+		return "", false
+	case level >= 50:
+		return "e", true
+	case level >= 40:
+		return "w", true
+	case level >= 30:
+		return "i", true
+	default:
+		return "d", true
+	}
+}
+
+// escapeKeys are the names of the keys sent as escape sequences.
+var escapeKeys = map[string]string{
+	"[A": "up", "[B": "down", "[C": "right", "[D": "left",
+	"[5~": "pgup", "[6~": "pgdown",
+	"[H": "home", "[1~": "home", "OH": "home",
+	"[F": "end", "[4~": "end", "OF": "end",
+}
+
+// readKeys sends the names of the keys read from the terminal to keys,
+// closing it when the terminal is.
+func readKeys(tty *os.File, keys chan<- string) {
+	buf := make([]byte, 256)
+	for {
+		n, err := tty.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+// parseKeys returns the names of the keys in b: the character typed, or
+// names like "up", "enter" or "ctrl+c".
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			key, size := "esc", 1
+			for seq, name := range escapeKeys {
+				if bytes.HasPrefix(b[1:], []byte(seq)) {
+					key, size = name, 1+len(seq)
+					break
+				}
+			}
+			keys = append(keys, key)
+			b = b[size:]
+			continue
+		}
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r == '\r' || r == '\n':
+			keys = append(keys, "enter")
+		case r == '\t':
+			keys = append(keys, "tab")
+		case r == 127 || r == 8:
+			keys = append(keys, "backspace")
+		case r > 0 && r < 27:
+			keys = append(keys, "ctrl+"+string(rune('a'+r-1)))
+		default:
+			keys = append(keys, string(r))
+		}
+		b = b[size:]
+	}
+	return keys
+}
+
+// interact shows the entries of the files in the interactive view, those
+// of each file in its own pane with --split, until it's quit.
+func interact(opts options) {
+	v := newView()
+	var run *command
+	if len(opts.command) > 0 {
+		var err error
+		run, err = startCommand(opts.command)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to run command: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	follow := startFollowing(opts, run)
+	t := openTee(opts.tee)
+	sources := [][]string{opts.files}
+	if opts.split && run == nil && follow == nil {
+		sources = eachFile(opts.files)
+	}
+	for _, files := range sources {
+		name := sourceName(files)
+		if run != nil {
+			name = strings.Join(opts.command, " ")
+		}
+		p := v.addPane(name)
+
+		// The entries of the files of a pane are labeled when there are
+		// several, reading them one after the other.
+		var r io.Reader
+		var merged *merger
+		width := 0
+		if parts := eachFile(files); run == nil && follow == nil && len(parts) > 1 {
+			merged = readFiles(parts)
+			r, width = merged, labelWidth(parts)
+		} else {
+			var err error
+			if r, err = open(run, follow, files); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to open file: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if follow != nil {
+			width = follow.width
+		}
+		formatter := newFormatter(opts, p, structure.WithWarnings(p), structure.WithSourceWidth(width))
+		proc := newProcessor(opts, formatter, filters(opts).Match, p)
+		proc.pane = p
+		if run != nil {
+			proc.stderr = run.stderr
+		}
+		if follow != nil {
+			proc.origin = follow.origin
+		}
+		if merged != nil {
+			proc.origin, proc.files, proc.labels = merged.origin, true, true
+		}
+		if t != nil {
+			r = t.reader(r)
+		}
+		parser, _ := stream.Lookup(opts.parser)
+		s := stream.NewParsed(r, parser)
+		go func() {
+			proc.run(s)
+			v.finish(p)
+		}()
+	}
+	if err := v.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start interactive mode: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The entries marked are written once quitting, to be saved by
+	// redirecting stdout.
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, p := range v.panes {
+		for _, line := range p.marked() {
+			if _, err := fmt.Printf("%s\n", line); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write the marked entries: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// sourceName names the files read, stdin when there are none.
+func sourceName(files []string) string {
+	var names []string
+	for _, file := range files {
+		if file != "" && file != "-" {
+			names = append(names, file)
+		}
+	}
+	if len(names) == 0 {
+		return "stdin"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/robfig/jl/stream"
+	"github.com/robfig/jl/structure"
+)
+
+const checkout = `{"time": "2024-05-01T12:00:00Z", "level": "info", "msg": "server started", "port": 8080}
+{"time": "2024-05-01T12:00:01Z", "level": "debug", "msg": "cart loaded", "request_id": "r1"}
+{"time": "2024-05-01T12:00:02Z", "level": "info", "msg": "charging card", "request_id": "r1"}
+{"time": "2024-05-01T12:00:03Z", "level": "error", "msg": "payment declined", "request_id": "r1", "status": 402}
+{"time": "2024-05-01T12:02:30Z", "level": "warn", "msg": "slow response", "request_id": "r2", "duration_ms": 1250}
+`
+
+func TestMain(m *testing.M) {
+	color.NoColor = true
+	os.Exit(m.Run())
+}
+
+// testView returns a view of width and height with a pane of the entries
+// of each source, read to their end.
+func testView(t *testing.T, width, height int, sources ...string) *view {
+	t.Helper()
+	t.Setenv("JL_OPTS", "")
+	args := os.Args
+	os.Args = []string{"jl", "--interactive", "--no-color", "--no-config"}
+	opts := cli()
+	os.Args = args
+
+	v := newView()
+	for i, source := range sources {
+		p := v.addPane("source " + string(rune('a'+i)))
+		formatter := newFormatter(opts, p, structure.WithWarnings(p))
+		proc := newProcessor(opts, formatter, filters(opts).Match, p)
+		proc.pane = p
+		parser, _ := stream.Lookup(opts.parser)
+		proc.run(stream.NewParsed(strings.NewReader(source), parser))
+		v.finish(p)
+	}
+	v.width, v.height = width, height
+	v.arrange()
+	for _, p := range v.panes {
+		p.render()
+	}
+	return v
+}
+
+// press presses the keys in the view, failing when one quits it.
+func press(t *testing.T, v *view, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if !v.key(key) {
+			t.Fatalf("quit pressing %q", key)
+		}
+	}
+}
+
+// screen returns the lines of the pane without their trailing spaces.
+func screen(p *pane) []string {
+	var lines []string
+	for _, line := range p.render() {
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return lines
+}
+
+// selected returns the message of the entry selected in p.
+func selected(p *pane) string {
+	p.layout()
+	if p.selected == nil {
+		return ""
+	}
+	return p.selected.entry.Message
+}
+
+func TestParseKeys(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input string
+		keys  []string
+	}{
+		{"j", []string{"j"}},
+		{"jk/", []string{"j", "k", "/"}},
+		{"\r", []string{"enter"}},
+		{"\t", []string{"tab"}},
+		{"\x7f", []string{"backspace"}},
+		{"\x03\x04", []string{"ctrl+c", "ctrl+d"}},
+		{"\x1b[A\x1b[B", []string{"up", "down"}},
+		{"\x1b[5~\x1b[6~", []string{"pgup", "pgdown"}},
+		{"\x1bOH\x1b[4~", []string{"home", "end"}},
+		{"\x1b", []string{"esc"}},
+		{"é", []string{"é"}},
+	}
+	for _, test := range tests {
+		if keys := parseKeys([]byte(test.input)); !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("parseKeys(%q) = %q, expected %q", test.input, keys, test.keys)
+		}
+	}
+}
+
+func TestPaneFollows(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	p := v.panes[0]
+	expected := []string{
+		" [2024-05-01 12:00:02]    INFO: charging card [request_id=r1]",
+		" [2024-05-01 12:00:03]   ERROR: payment declined [request_id=r1 status=402]",
+		"▌[2024-05-01 12:02:30] WARNING: slow response [duration_ms=1250 request_id=r2]",
+	}
+	if lines := screen(p); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q", lines, expected)
+	}
+	if info := p.info(); info != " 5/5  end of input" {
+		t.Errorf("info = %q", info)
+	}
+}
+
+func TestPaneMoves(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	p := v.panes[0]
+	tests := []struct {
+		key      string
+		selected string
+		top      int
+		follow   bool
+	}{
+		{"k", "payment declined", 2, false},
+		{"up", "charging card", 2, false},
+		{"k", "cart loaded", 1, false},
+		{"g", "server started", 0, false},
+		{"k", "server started", 0, false},
+		{"ctrl+d", "cart loaded", 0, false},
+		{"pgdown", "slow response", 2, false},
+		{"j", "slow response", 2, true},
+		{"home", "server started", 0, false},
+		{"G", "slow response", 2, true},
+	}
+	for _, test := range tests {
+		press(t, v, test.key)
+		p.render()
+		if s := selected(p); s != test.selected || p.top != test.top || p.follow != test.follow {
+			t.Errorf("after %q: selected %q at top %d following %v, expected %q at top %d following %v",
+				test.key, s, p.top, p.follow, test.selected, test.top, test.follow)
+		}
+	}
+}
+
+func TestPaneLayoutCached(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	p := v.panes[0]
+	f := p.layout()
+	press(t, v, "k", "k")
+	if p.layout() != f {
+		t.Errorf("the layout was computed again moving the selection")
+	}
+	press(t, v, "enter")
+	if p.layout() == f {
+		t.Errorf("the layout was kept expanding an entry")
+	}
+	f = p.layout()
+	if i := f.indexOf(p.selected); i != 2 {
+		t.Errorf("index of the selected entry = %d, expected 2", i)
+	}
+	if start, end := f.span(2); start != 2 || end != 8 {
+		t.Errorf("span of the expanded entry = %d-%d, expected 2-8", start, end)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	v := testView(t, 80, 10, checkout)
+	p := v.panes[0]
+	press(t, v, "k", "enter")
+	expected := []string{
+		" [2024-05-01 12:00:02]    INFO: charging card [request_id=r1]",
+		"▌[2024-05-01 12:00:03]   ERROR: payment declined [request_id=r1 status=402]",
+		"▌  {",
+		`▌    "time": "2024-05-01T12:00:03Z",`,
+		`▌    "level": "error",`,
+		`▌    "msg": "payment declined",`,
+		`▌    "request_id": "r1",`,
+		`▌    "status": 402`,
+		"▌  }",
+	}
+	if lines := screen(p); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q", lines, expected)
+	}
+	press(t, v, "enter")
+	if lines := screen(p); lines[5] != "" || !strings.HasPrefix(lines[3], "▌[2024-05-01 12:00:03]") {
+		t.Errorf("the entry wasn't collapsed: %q", lines)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	p := v.panes[0]
+	press(t, v, "g", "/", "r", "1", "enter")
+	if s := selected(p); s != "cart loaded" {
+		t.Errorf("selected %q searching r1, expected cart loaded", s)
+	}
+	tests := []struct {
+		key      string
+		selected string
+		message  string
+	}{
+		{"n", "charging card", ""},
+		{"n", "payment declined", ""},
+		{"n", "cart loaded", "search wrapped"},
+		{"N", "payment declined", "search wrapped"},
+	}
+	for _, test := range tests {
+		press(t, v, test.key)
+		if s := selected(p); s != test.selected || v.message != test.message {
+			t.Errorf("after %q: selected %q with %q, expected %q with %q", test.key, s, v.message, test.selected, test.message)
+		}
+	}
+
+	// A search matching only the JSON expands the entries to show it.
+	press(t, v, "/", "0", "0", ":", "0", "0", "z", "enter")
+	if s := selected(p); s != "server started" || !p.selected.expanded {
+		t.Errorf("selected %q expanded %v searching 00:00z", s, p.selected.expanded)
+	}
+	press(t, v, "/", "n", "o", "p", "e", "enter")
+	if v.message != "pattern not found: nope" {
+		t.Errorf("message = %q searching nope", v.message)
+	}
+
+	// An invalid pattern isn't searched, the previous one is kept.
+	press(t, v, "/", "(", "enter")
+	if v.prompt != nil || p.pattern != "nope" || p.search == nil {
+		t.Errorf("searching %q after an invalid pattern", p.pattern)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	p := v.panes[0]
+	press(t, v, "&")
+	for _, key := range "request_id=r2" {
+		press(t, v, string(key))
+	}
+	if lines := screen(p); len(lines[0]) == 0 || lines[1] != "" {
+		t.Errorf("the filter wasn't applied as typed: %q", lines)
+	}
+	press(t, v, "esc")
+	if p.query != "" || len(p.layout().records) != 5 {
+		t.Errorf("the filter %q wasn't reverted canceling it", p.query)
+	}
+}
+
+func TestPause(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	p := v.panes[0]
+	press(t, v, " ")
+	if !p.paused || p.follow {
+		t.Fatalf("not paused")
+	}
+	line := `{"time": "2024-05-01T12:02:31Z", "level": "info", "msg": "health check"}` + "\n"
+	out := &output{line: &stream.Line{Raw: []byte(line), JSON: []byte(line)}, entry: &structure.Entry{Message: "health check"}}
+	p.begin(out)
+	_, _ = p.Write([]byte("health check\n"))
+	p.end()
+	if n := len(p.layout().records); n != 5 {
+		t.Errorf("%d entries shown while paused, expected 5", n)
+	}
+	if info := p.info(); !strings.Contains(info, "paused +1 new") {
+		t.Errorf("info = %q while paused", info)
+	}
+	press(t, v, "G")
+	if p.paused || selected(p) != "health check" {
+		t.Errorf("paused %v, selected %q once resumed", p.paused, selected(p))
+	}
+}
+
+func TestSplit(t *testing.T) {
+	worker := `{"time": "2024-05-01T12:00:00Z", "level": "info", "msg": "worker started"}
+{"time": "2024-05-01T12:00:02Z", "level": "warn", "msg": "retrying job 7"}
+{"time": "2024-05-01T12:05:00Z", "level": "info", "msg": "worker stopped"}
+`
+	v := testView(t, 81, 25, checkout, worker)
+	a, b := v.panes[0], v.panes[1]
+	if a.width != 81 || a.height != 11 || b.height != 11 {
+		t.Errorf("stacked panes of %dx%d and %dx%d", a.width, a.height, b.width, b.height)
+	}
+	press(t, v, "|")
+	if a.width != 40 || b.width != 40 || a.height != 23 {
+		t.Errorf("panes side by side of %dx%d and %dx%d", a.width, a.height, b.width, b.height)
+	}
+
+	// Selecting an entry in a pane selects the one at its time in the
+	// other.
+	press(t, v, "k", "k")
+	if s := selected(b); s != "retrying job 7" {
+		t.Errorf("selected %q in the other pane, expected retrying job 7", s)
+	}
+	press(t, v, "tab", "g")
+	if v.focus != 1 || selected(a) != "server started" {
+		t.Errorf("focus on %d selecting %q in the first pane", v.focus, selected(a))
+	}
+	press(t, v, "G")
+	if !a.follow || !b.follow {
+		t.Errorf("not following both panes")
+	}
+	press(t, v, "tab")
+	if v.focus != 0 {
+		t.Errorf("focus on %d, expected 0", v.focus)
+	}
+}
+
+func TestMarks(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	p := v.panes[0]
+	press(t, v, "m", "g", "j", "m", "g")
+	if lines := screen(p); lines[0] != "▌[2024-05-01 12:00:00]    INFO: server started [port=8080]" {
+		t.Errorf("first line = %q", lines[0])
+	}
+	tests := []struct {
+		key      string
+		selected string
+	}{
+		{"'", "cart loaded"},
+		{"'", "slow response"},
+		{"'", "cart loaded"},
+		{"\"", "slow response"},
+	}
+	for _, test := range tests {
+		press(t, v, test.key)
+		if s := selected(p); s != test.selected {
+			t.Errorf("after %q: selected %q, expected %q", test.key, s, test.selected)
+		}
+	}
+	if info := p.info(); !strings.HasSuffix(info, "2 marked") {
+		t.Errorf("info = %q", info)
+	}
+	var marked []string
+	for _, line := range p.marked() {
+		marked = append(marked, string(line))
+	}
+	expected := []string{
+		`{"time": "2024-05-01T12:00:01Z", "level": "debug", "msg": "cart loaded", "request_id": "r1"}`,
+		`{"time": "2024-05-01T12:02:30Z", "level": "warn", "msg": "slow response", "request_id": "r2", "duration_ms": 1250}`,
+	}
+	if !reflect.DeepEqual(marked, expected) {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q", marked, expected)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	tty, err := os.CreateTemp(t.TempDir(), "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tty.Close()
+	v.tty = tty
+
+	// Without a clipboard command, the text is copied by the terminal.
+	t.Setenv("PATH", "")
+	press(t, v, "k", "y")
+	if v.message != "copied the JSON with the terminal" {
+		t.Errorf("message = %q", v.message)
+	}
+	press(t, v, "Y")
+	b, err := os.ReadFile(tty.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	json := `{"time": "2024-05-01T12:00:03Z", "level": "error", "msg": "payment declined", "request_id": "r1", "status": 402}`
+	lines := "[2024-05-01 12:00:03]   ERROR: payment declined [request_id=r1 status=402]"
+	expected := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(json)) + "\a" +
+		"\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(lines)) + "\a"
+	if string(b) != expected {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q", b, expected)
+	}
+}
+
+func TestDetail(t *testing.T) {
+	v := testView(t, 100, 12, checkout)
+	p := v.panes[0]
+	press(t, v, "k", "o")
+	if p.width != 59 || v.detail.width != 40 {
+		t.Errorf("pane of width %d beside a panel of %d", p.width, v.detail.width)
+	}
+	press(t, v, "tab")
+	if !v.detail.focused {
+		t.Fatalf("the panel doesn't have the focus")
+	}
+	v.detail.show(p.selected)
+	var texts []string
+	for _, n := range v.detail.nodes(p) {
+		texts = append(texts, strings.TrimSpace(n.text))
+	}
+	expected := []string{
+		"related request_id=r1  3 entries",
+		"",
+		"level: error",
+		"msg: payment declined",
+		"request_id: r1",
+		"status: 402",
+		"time: 2024-05-01T12:00:03Z",
+	}
+	if !reflect.DeepEqual(texts, expected) {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q", texts, expected)
+	}
+
+	// The keys move in the panel while it has the focus, not in the pane.
+	press(t, v, "j", "j", "G")
+	if v.detail.cursor != 6 || selected(p) != "payment declined" {
+		t.Errorf("cursor at %d selecting %q", v.detail.cursor, selected(p))
+	}
+	press(t, v, "tab", "o")
+	if v.detail.open || v.detail.focused || p.width != 100 {
+		t.Errorf("the panel is open %v focused %v beside a pane of width %d", v.detail.open, v.detail.focused, p.width)
+	}
+}
+
+func TestSeverityToggles(t *testing.T) {
+	v := testView(t, 80, 10, checkout)
+	p := v.panes[0]
+	press(t, v, "e", "d")
+	if levels := v.levels(); levels != "-WI-" {
+		t.Errorf("levels = %q", levels)
+	}
+	var shown []string
+	for _, r := range p.layout().records {
+		shown = append(shown, r.entry.Message)
+	}
+	expected := []string{"server started", "charging card", "slow response"}
+	if !reflect.DeepEqual(shown, expected) {
+		t.Errorf("shown %q, expected %q", shown, expected)
+	}
+	press(t, v, "e")
+	if levels, n := v.levels(), len(p.layout().records); levels != "EWI-" || n != 4 {
+		t.Errorf("levels %q showing %d entries", levels, n)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	v := testView(t, 80, 4, checkout)
+	if v.key("q") {
+		t.Errorf("q didn't quit")
+	}
+	press(t, v, "/")
+	if !v.key("q") || v.prompt.text != "q" {
+		t.Errorf("q quit while typing")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+)
+
+// listenWidth is the width of the labels of the clients of jl listen, that
+// of an IPv4 address.
+const listenWidth = len("255.255.255.255")
+
+// listenTCP reads the lines sent over TCP to addr by any number of clients
+// as they come, labeled with the host of each.
+func listenTCP(addr string) (*follower, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	f := &follower{merger: newMerger(), labels: true, width: listenWidth}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+			if err != nil {
+				host = conn.RemoteAddr().String()
+			}
+			go func() {
+				defer conn.Close()
+				f.copy(conn, host)
+			}()
+		}
+	}()
+	return f, nil
+}
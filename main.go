@@ -1,16 +1,18 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
-	"github.com/robfig/jl/djson"
+	"github.com/fatih/color"
 	"github.com/robfig/jl/stream"
 	"github.com/robfig/jl/structure"
 
@@ -18,79 +20,594 @@ import (
 )
 
 func main() {
-	files, color, showPrefix, showSuffix, showFields, includeFields, excludeFields, objFields, maxFieldLength := cli()
-	formatter, err := structure.NewFormatter(os.Stdout, "")
+	opts := cli()
+	// The colors are shared by every formatter, the panes of --split
+	// formatting concurrently.
+	color.NoColor = !opts.color
+	if opts.convert {
+		convert(opts)
+		return
+	}
+	if opts.check {
+		check(opts)
+		return
+	}
+	if opts.interactive {
+		interact(opts)
+		return
+	}
+	var run *command
+	if len(opts.command) > 0 {
+		var err error
+		run, err = startCommand(opts.command)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to run command: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	follow := startFollowing(opts, run)
+	var sources [][]string
+	width := 0
+	if follow != nil {
+		width = follow.width
+	} else if run == nil {
+		sources = eachFile(opts.files)
+		if len(sources) > 1 {
+			width = labelWidth(sources)
+		}
+	}
+
+	formatter := newFormatter(opts, os.Stdout, structure.WithSourceWidth(width))
+	chain := filters(opts)
+	p := newProcessor(opts, formatter, chain.Match, os.Stdout)
+	p.renderer = newRenderer(opts.output, formatter)
+	if opts.metricsListen != "" {
+		p.metrics = newMetrics()
+		serveMetrics(opts.metricsListen, p.metrics)
+	}
+	if run != nil {
+		p.stderr = run.stderr
+	}
+	if opts.pipefail {
+		// The writes to the output closed fail instead of killing jl.
+		signal.Notify(make(chan os.Signal, 1), syscall.SIGPIPE)
+		p.pipefail, p.command = true, run
+	}
+	if follow != nil {
+		p.origin = follow.origin
+	}
+	if run == nil {
+		// SIGHUP is forwarded to the command run instead.
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		p.hangup = hangup
+		p.reload = func() {
+			reloaded, err := reloadOptions(opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to reload the configuration: %v\n", err)
+				return
+			}
+			opts = reloaded
+			formatter = newFormatter(opts, os.Stdout, structure.WithSourceWidth(width))
+			chain = filters(opts)
+			p.formatter, p.filter = formatter, chain.Match
+		}
+	}
+	t := openTee(opts.tee)
+	var files *merger
+	if len(sources) > 1 || opts.statsByFile && sources != nil {
+		// The files are read one after the other, the lines of each
+		// labeled or counted apart.
+		files = readFiles(sources)
+		p.origin, p.files, p.labels = files.origin, true, len(sources) > 1
+		if opts.statsByFile {
+			for _, source := range sources {
+				p.fileStats = append(p.fileStats, newStats(source[0]))
+			}
+		}
+	}
+	if opts.stats || opts.statsByFile {
+		p.stats = newStats("")
+		if len(p.fileStats) > 0 {
+			p.stats = p.fileStats[0]
+		}
+	}
+	var r io.Reader = files
+	if files == nil {
+		var err error
+		if r, err = open(run, follow, opts.files); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if t != nil {
+		r = t.reader(r)
+	}
+	parser, _ := stream.Lookup(opts.parser)
+	s := stream.NewParsed(r, parser)
+	p.run(s)
+	failed := false
+	if err := s.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+		failed = true
+	}
+	if files != nil {
+		files.close()
+	}
+	var statsTable *structure.Table
+	allStats := p.fileStats
+	if len(allStats) == 0 && p.stats != nil {
+		allStats = []*stats{p.stats}
+	}
+	for _, stats := range allStats {
+		switch {
+		case opts.reportFormat == "text":
+			stats.write(os.Stdout)
+		case statsTable == nil:
+			statsTable = stats.table()
+		default:
+			statsTable.Rows = append(statsTable.Rows, stats.table().Rows...)
+		}
+	}
+	if t != nil {
+		t.close()
+	}
+	if closer, ok := p.renderer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+		}
+	}
+	if p.alerter != nil {
+		p.alerter.wait()
+	}
+	if opts.reportFormat != "text" {
+		writeReports(os.Stdout, opts.reportFormat, reports(p, statsTable, opts.topN, formatter.Location))
+	} else {
+		writeTextReports(p, opts.topN, formatter.Location)
+	}
+	if p.summary != nil {
+		writeSummary(p.summary, opts.summary)
+	}
+	if opts.filterStats {
+		for _, line := range chain.Report() {
+			fmt.Fprintln(os.Stderr, line)
+		}
+	}
+	if run != nil {
+		run.close()
+		if status := run.wait(); status != 0 {
+			os.Exit(status)
+		}
+	}
+	if failed && opts.pipefail {
+		os.Exit(1)
+	}
+	if p.validator != nil && p.validator.report(os.Stderr) {
+		os.Exit(1)
+	}
+	if opts.quiet && p.counts.Total() == 0 {
+		os.Exit(1)
+	}
+}
+
+// newFormatter returns the formatter of the entries configured by the
+// formatting options, writing to w, along with the extra options given.
+func newFormatter(opts options, w io.Writer, extra ...structure.Option) *structure.Formatter {
+	options, err := formatterOptions(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	formatter, err := structure.NewFormatter(w, append(options, extra...)...)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "invalid format: %v\n", err)
+		fmt.Fprintln(os.Stderr, formatterError(err))
 		os.Exit(1)
 	}
+	return formatter
+}
+
+// formatterOptions returns the options of the formatter given by the
+// formatting options, each reporting the flag of the value it rejects.
+func formatterOptions(opts options) ([]structure.Option, error) {
+	strict := structure.StrictOff
+	switch opts.onMissing {
+	case "ignore":
+	case "fail":
+		strict = structure.StrictFail
+	case "annotate":
+		strict = structure.StrictAnnotate
+	default:
+		return nil, fmt.Errorf("invalid missing field mode: %q", opts.onMissing)
+	}
+	collision := structure.CollisionPrefix
+	switch opts.onCollision {
+	case "prefix":
+	case "overwrite":
+		collision = structure.CollisionOverwrite
+	case "warn":
+		collision = structure.CollisionWarn
+	default:
+		return nil, fmt.Errorf("invalid collision mode: %q", opts.onCollision)
+	}
+	trailer := structure.TrailerJSON
+	switch opts.trailerFormat {
+	case "json":
+	case "yaml":
+		trailer = structure.TrailerYAML
+	default:
+		return nil, fmt.Errorf("invalid trailer format: %q", opts.trailerFormat)
+	}
+	align := structure.AlignRight
+	switch opts.severityAlign {
+	case "right":
+	case "left":
+		align = structure.AlignLeft
+	default:
+		return nil, fmt.Errorf("invalid severity alignment: %q", opts.severityAlign)
+	}
+	relative := structure.Absolute
+	switch opts.relative {
+	case "":
+	case "now":
+		relative = structure.RelativeToNow
+	case "start":
+		relative = structure.RelativeToStart
+	default:
+		return nil, fmt.Errorf("invalid relative time: %q", opts.relative)
+	}
+	icons := structure.NoIcons
+	if opts.iconsOnly {
+		icons = structure.IconsOnly
+	} else if opts.icons {
+		icons = structure.IconsWithSeverity
+	}
+	keys := presets[opts.preset].keys
+	for name, path := range opts.keys {
+		if err := keys.Set(name, path); err != nil {
+			return nil, fmt.Errorf("invalid --key: %v", err)
+		}
+	}
+	var location *time.Location
+	if opts.timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(opts.timezone); err != nil {
+			return nil, fmt.Errorf("invalid time zone: %v", err)
+		}
+	}
+	wrapWidth, truncateWidth := 0, 0
+	if opts.wrapFields {
+		wrapWidth = terminalWidth()
+	}
+	if opts.truncate {
+		truncateWidth = terminalWidth()
+	}
+	options := []structure.Option{
+		structure.WithTemplate(opts.format),
+		structure.WithTemplates(opts.templates),
+		structure.WithColor(opts.color),
+		structure.WithStrict(strict),
+		structure.WithKeys(keys),
+		structure.WithPrefix(opts.showPrefix),
+		structure.WithSuffix(opts.showSuffix),
+		structure.WithFields(opts.showFields),
+		structure.WithIncludes(opts.includeFields),
+		structure.WithExcludes(strings.Split(opts.excludeFields, ",")...),
+		structure.WithExcludes(presets[opts.preset].excludes...),
+		structure.WithObjFields(strings.Split(opts.objFields, ",")...),
+		structure.WithFlatten(collision, strings.Split(opts.flatten, ",")...),
+		structure.WithWarnings(os.Stderr),
+		structure.WithFieldOrder(splitList(opts.fieldOrder)...),
+		flagOption("--max-field-length", structure.WithMaxFieldLength(opts.maxFieldLength)),
+		flagOption("--include-fields-re", structure.WithIncludeRegexp(opts.includeFieldsRe)),
+		flagOption("--exclude-fields-re", structure.WithExcludeRegexp(opts.excludeFieldsRe)),
+		flagOption("--field-color", structure.WithFieldColors(opts.fieldColors)),
+		flagOption("--color-rule", structure.WithColorRules(opts.colorRules...)),
+		structure.WithAlignFields(opts.alignFields),
+		structure.WithWrapWidth(wrapWidth),
+		structure.WithTruncateWidth(truncateWidth),
+		structure.WithTrailerFormat(trailer),
+		structure.WithCombineErrors(!opts.separateErrors),
+		structure.WithHighlightSyntax(opts.highlight),
+		structure.WithHighlight(highlight(opts)),
+		structure.WithTraceIDs(opts.traceIDs, opts.traceURL),
+		structure.WithCaller(opts.caller, opts.hyperlinks, opts.callerURL),
+		structure.WithStackUserPackages(splitList(opts.stackHighlight)...),
+		flagOption("--stack-head/--stack-tail", structure.WithStack(opts.stackHead, opts.stackTail)),
+		flagOption("--stack-hide", structure.WithStackHide(splitList(opts.stackHide)...)),
+		flagOption("--max-depth", structure.WithMaxDepth(opts.maxDepth)),
+		flagOption("--max-array-length", structure.WithMaxArrayLength(opts.maxArrayLength)),
+		flagOption("--truncate-values", structure.WithTruncateValues(opts.truncateValues)),
+		flagOption("--truncate-field", structure.WithTruncateFields(opts.truncateFields)),
+		structure.WithRename(opts.rename),
+		flagOption("--unit", structure.WithUnits(opts.units)),
+		flagOption("--severity-width", structure.WithSeverity(opts.severityWidth, align, opts.truncateSeverity)),
+		flagOption("--icons", structure.WithIcons(icons)),
+		structure.WithLocation(location),
+		flagOption("--time-format", structure.WithTimeFormat(opts.timeFormat)),
+		structure.WithTimeLayouts(opts.timeLayouts...),
+		structure.WithRelativeTime(relative),
+		flagOption("--elapsed-threshold", structure.WithElapsed(opts.elapsed, opts.elapsedThreshold)),
+	}
+	return options, nil
+}
+
+// flagError is the error of a formatting option given by flag.
+type flagError struct {
+	flag string
+	err  error
+}
+
+func (e *flagError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.flag, e.err)
+}
+
+// flagOption reports the values option rejects as those of flag.
+func flagOption(flag string, option structure.Option) structure.Option {
+	return func(f *structure.Formatter) error {
+		if err := option(f); err != nil {
+			return &flagError{flag, err}
+		}
+		return nil
+	}
+}
 
-	formatter.Colorize = color
-	formatter.ShowPrefix = showPrefix
-	formatter.ShowSuffix = showSuffix
-	formatter.ShowFields = showFields
-	formatter.MaxFieldLength = maxFieldLength
-	formatter.IncludeFields = includeFields
-	formatter.ExcludeFields = append(formatter.ExcludeFields, strings.Split(excludeFields, ",")...)
-	formatter.ObjFields = append(formatter.ObjFields, strings.Split(objFields, ",")...)
+// formatterError returns err of NewFormatter, of the template unless it's
+// one of a flag.
+func formatterError(err error) error {
+	var invalid *flagError
+	if errors.As(err, &invalid) {
+		return err
+	}
+	return fmt.Errorf("invalid format: %v", err)
+}
+
+// splitList returns the elements of a comma separated list, none when
+// it's empty.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
 
-	r, err := openFiles(files)
+// newRenderer returns the renderer of the entries for --output, or nil
+// for the formatter to write them as text.
+func newRenderer(output string, formatter *structure.Formatter) structure.Renderer {
+	switch output {
+	case "text":
+		return nil
+	case "html":
+		h := structure.NewHTMLWriter(os.Stdout)
+		h.Keys = formatter.Keys
+		return h
+	}
+	converter, err := structure.NewConverter(os.Stdout, output)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to open file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "invalid --output: %q, expected text, %s or html\n", output, strings.Join(structure.ConvertFormats, ", "))
 		os.Exit(1)
 	}
-	s := stream.New(r)
-	for line := range s.Lines() {
+	converter.Keys = formatter.Keys
+	return converter
+}
+
+// newProcessor returns the processor of the lines configured by the
+// filtering and output options, writing to w the entries matching filter.
+func newProcessor(opts options, formatter *structure.Formatter, filter structure.Filter, w io.Writer) *processor {
+	p := &processor{formatter: formatter, filter: filter, dedupe: opts.dedupe, stdout: w}
+	p.before, p.after = contextLines(opts)
+	p.related = errorContext(opts)
+	if opts.uniq {
+		p.uniq = newUniq()
+	}
+	p.alerter = alerts(opts)
+	p.quiet, p.count = opts.quiet, opts.count
+	p.stages = stages(opts)
+	p.gap = opts.gap
+	if opts.bursts {
+		p.bursts = structure.NewBurstDetector(opts.burstWindow, opts.burstFactor)
+	}
+	if opts.histogram != "" {
+		bucket, err := time.ParseDuration(opts.histogram)
+		if err != nil || bucket <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid --histogram: %q, expected a duration like 1m\n", opts.histogram)
+			os.Exit(1)
+		}
+		p.histogram = structure.NewHistogram(bucket)
+	}
+	if len(opts.top) > 0 {
+		p.top = structure.NewTop(opts.top)
+	}
+	if opts.errorRate != "" {
+		window, err := time.ParseDuration(opts.errorRate)
+		if err != nil || window < time.Second {
+			fmt.Fprintf(os.Stderr, "invalid --error-rate: %q, expected a duration like 1m\n", opts.errorRate)
+			os.Exit(1)
+		}
+		p.errorRate = structure.NewErrorRate(window)
+	}
+	if opts.summary != "" {
+		if opts.summary != "text" && opts.summary != "json" {
+			fmt.Fprintf(os.Stderr, "invalid summary format: %q\n", opts.summary)
+			os.Exit(1)
+		}
+		p.summary = structure.NewSummary()
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		p.interrupt = interrupt
+	}
+	for _, field := range opts.countDistinct {
+		p.distinct = append(p.distinct, structure.NewDistinct(field))
+	}
+	for _, field := range opts.percentiles {
+		p.latencies = append(p.latencies, structure.NewPercentiles(field, opts.percentilesBy))
+	}
+	p.counts = make(structure.SeverityCounts)
+	if opts.agg {
+		var groupBy []string
+		if opts.groupBy != "" {
+			groupBy = strings.Split(opts.groupBy, ",")
+		}
+		p.agg = structure.NewAggregation(groupBy, opts.count || len(opts.aggregates) == 0, opts.aggregates)
+		p.count = false
+	} else if opts.group {
+		keys := structure.CorrelationKeys
+		if opts.groupBy != "" {
+			keys = strings.Split(opts.groupBy, ",")
+		}
+		p.grouper = newGrouper(keys, opts.groupWindow)
+	}
+	if opts.sorted && opts.until != "" {
+		_, p.until = timeRange(opts)
+	}
+	if opts.strict {
+		p.validator = &validator{}
+		if opts.schema != "" {
+			var err error
+			p.validator.schema, err = structure.ParseSchema(opts.schema)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid --schema: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	if opts.maxRate != "" {
 		var err error
-		entry := &structure.Entry{}
-		if line.JSON != nil && len(line.JSON) > 0 {
-			var unused interface{}
-			err = json.Unmarshal(line.JSON, &unused)
-			djson.Unmarshal(line.JSON, entry)
+		p.limiter, err = structure.ParseRate(opts.maxRate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --max-rate: %v\n", err)
+			os.Exit(1)
 		}
+	}
+	return p
+}
 
-		// unable to parse entry, outputting raw line:
-		if line.JSON == nil || err != nil {
-			writeBytes(line.Raw)
-			writeBytes(structure.NewLine)
-			continue
+// writeSummary writes the summary of the run on stderr, as text or JSON.
+func writeSummary(summary *structure.Summary, format string) {
+	if format == "json" {
+		b, err := summary.JSON()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write summary: %v\n", err)
+			return
+		}
+		fmt.Fprintln(os.Stderr, string(b))
+		return
+	}
+	for _, line := range summary.Text() {
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
+
+// sourceLabel returns the label of the entries of file, its name without
+// directory and extension.
+func sourceLabel(file string) string {
+	if file == "-" {
+		return "stdin"
+	}
+	name := filepath.Base(file)
+	if label := strings.TrimSuffix(name, filepath.Ext(name)); label != "" {
+		return label
+	}
+	return name
+}
+
+// labelWidth returns the width of the widest label of the sources.
+func labelWidth(sources [][]string) int {
+	width := 0
+	for _, files := range sources {
+		if n := utf8.RuneCountInString(sourceLabel(files[0])); n > width {
+			width = n
 		}
+	}
+	return width
+}
 
-		if (entry.Timestamp == nil || entry.Timestamp.IsZero()) && entry.FloatTimestamp > 0 {
-			sec, dec := math.Modf(entry.FloatTimestamp)
-			t := time.Unix(int64(sec), int64(dec*(1e9))).UTC()
-			entry.Timestamp = &t
+// eachFile returns the files to read one at a time, stdin when there are
+// none.
+func eachFile(files []string) [][]string {
+	var sources [][]string
+	for _, file := range files {
+		if file != "" {
+			sources = append(sources, []string{file})
 		}
+	}
+	if len(sources) == 0 {
+		sources = [][]string{{"-"}}
+	}
+	return sources
+}
 
-		// Passing entry to formatter to output:
-		prefix, suffix := split(line.Raw, line.JSON)
-		err = formatter.Format(entry, line.JSON, prefix, suffix)
+// readFiles reads the files of sources one after the other, stdin for "-",
+// the origin of each line being the path of its file.
+func readFiles(sources [][]string) *merger {
+	files := make([]*os.File, len(sources))
+	for i, source := range sources {
+		if source[0] == "-" {
+			files[i] = os.Stdin
+			continue
+		}
+		file, err := os.Open(source[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
-			break
+			fmt.Fprintf(os.Stderr, "failed to open file: %v\n", err)
+			os.Exit(1)
 		}
+		files[i] = file
 	}
+	m := newMerger()
+	go func() {
+		for i, file := range files {
+			m.copy(file, sources[i][0])
+			file.Close()
+		}
+		m.end()
+	}()
+	return m
+}
 
-	if err := s.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+// openTee creates the file the input is copied to, unless path is empty.
+func openTee(path string) *tee {
+	if path == "" {
+		return nil
 	}
+	t, err := newTee(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create the --tee file: %v\n", err)
+		os.Exit(1)
+	}
+	return t
 }
 
-func writeBytes(line []byte) {
-	_, err := os.Stdout.Write(line)
+// startFollowing follows the files with --follow, or the clients of jl
+// listen, unless a command is run.
+func startFollowing(opts options, run *command) *follower {
+	if opts.listen != "" {
+		follow, err := listenTCP(opts.listen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to listen: %v\n", err)
+			os.Exit(1)
+		}
+		return follow
+	}
+	if !opts.follow || run != nil {
+		return nil
+	}
+	follow, err := followFiles(opts.files, opts.glob)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+		fmt.Fprintf(os.Stderr, "failed to follow the files: %v\n", err)
 		os.Exit(1)
 	}
+	return follow
 }
 
-func split(raw, json []byte) (prefix, suffix []byte) {
-	parts := bytes.SplitN(raw, json, 2)
-	prefix = parts[0]
-	if len(parts) >= 2 {
-		suffix = parts[1]
+// open returns the output of the command run or the lines of the files
+// followed, or else the files.
+func open(run *command, follow *follower, files []string) (io.Reader, error) {
+	switch {
+	case run != nil:
+		return run, nil
+	case follow != nil:
+		return follow, nil
 	}
-	return
+	return openFiles(files)
 }
 
 func openFiles(files []string) (io.Reader, error) {
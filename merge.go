@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// merger merges the lines of several readers into one, whole lines at a
+// time, noting where each came from.
+type merger struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+
+	// origins holds where the lines written and not read yet came from,
+	// writing is held while writing a line.
+	mu      sync.Mutex
+	origins []string
+	writing sync.Mutex
+}
+
+func newMerger() *merger {
+	r, w := io.Pipe()
+	return &merger{r: r, w: w}
+}
+
+// Read reads the lines merged.
+func (m *merger) Read(b []byte) (int, error) {
+	return m.r.Read(b)
+}
+
+// origin returns where the next line read came from, it must be called
+// once for each line read.
+func (m *merger) origin() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.origins) == 0 {
+		return ""
+	}
+	origin := m.origins[0]
+	m.origins = m.origins[1:]
+	return origin
+}
+
+// writeLine adds a line from origin, ending it with a newline when it
+// doesn't.
+func (m *merger) writeLine(line []byte, origin string) error {
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	m.writing.Lock()
+	defer m.writing.Unlock()
+	m.mu.Lock()
+	m.origins = append(m.origins, origin)
+	m.mu.Unlock()
+	_, err := m.w.Write(line)
+	return err
+}
+
+// copy adds the lines of r from origin until its end. The reads go on once
+// writing fails, for the writer of r not to block on a full pipe.
+func (m *merger) copy(r io.Reader, origin string) {
+	br := bufio.NewReader(r)
+	failed := false
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 && !failed {
+			failed = m.writeLine(line, origin) != nil
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// end ends the lines merged once they are read.
+func (m *merger) end() {
+	m.w.Close()
+}
+
+// close stops reading the lines, those added next are discarded.
+func (m *merger) close() {
+	m.r.Close()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/robfig/jl/structure"
+)
+
+// metrics counts the lines of the stream, to be scraped by Prometheus.
+type metrics struct {
+	mu          sync.Mutex
+	lines       int
+	nonJSON     int
+	parseErrors int
+	entries     structure.SeverityCounts
+	matched     structure.SeverityCounts
+}
+
+func newMetrics() *metrics {
+	return &metrics{entries: make(structure.SeverityCounts), matched: make(structure.SeverityCounts)}
+}
+
+// line counts a line read, which is an entry unless it's raw, failed
+// tells whether a raw line looked like JSON but couldn't be parsed.
+func (m *metrics) line(entry *structure.Entry, raw, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lines++
+	switch {
+	case failed:
+		m.parseErrors++
+	case raw:
+		m.nonJSON++
+	default:
+		m.entries.Add(entry.Severity)
+	}
+}
+
+// match counts an entry matching the filters.
+func (m *metrics) match(entry *structure.Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.matched.Add(entry.Severity)
+}
+
+// ServeHTTP writes the counters in the Prometheus text format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	counter(w, "jl_lines_total", "Lines read.")
+	fmt.Fprintf(w, "jl_lines_total %d\n", m.lines)
+	counter(w, "jl_non_json_lines_total", "Lines read which aren't JSON.")
+	fmt.Fprintf(w, "jl_non_json_lines_total %d\n", m.nonJSON)
+	counter(w, "jl_parse_errors_total", "Lines which looked like JSON but couldn't be parsed.")
+	fmt.Fprintf(w, "jl_parse_errors_total %d\n", m.parseErrors)
+	counter(w, "jl_entries_total", "Entries read by severity.")
+	writeSeverities(w, "jl_entries_total", m.entries)
+	counter(w, "jl_matched_lines_total", "Lines matching the filters by severity.")
+	writeSeverities(w, "jl_matched_lines_total", m.matched)
+}
+
+func counter(w http.ResponseWriter, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+}
+
+func writeSeverities(w http.ResponseWriter, name string, counts structure.SeverityCounts) {
+	severities := make([]string, 0, len(counts))
+	for severity := range counts {
+		severities = append(severities, severity)
+	}
+	sort.Strings(severities)
+	for _, severity := range severities {
+		label := severity
+		if label == "" {
+			label = "none"
+		}
+		fmt.Fprintf(w, "%s{severity=%q} %d\n", name, label, counts[severity])
+	}
+}
+
+// serveMetrics serves the metrics on addr, ex: ":9090", at /metrics.
+func serveMetrics(addr string, m *metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to serve metrics: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+}
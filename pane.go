@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/robfig/jl/structure"
+)
+
+// maxRecords bounds the number of entries kept in a pane, the oldest ones
+// are dropped past it.
+const maxRecords = 100000
+
+// selectedColor marks the selected entry in the margin, markColor the
+// entries marked.
+var (
+	selectedColor = color.New(color.FgCyan, color.Bold)
+	markColor     = color.New(color.FgYellow, color.Bold)
+)
+
+// pane is a scrollable buffer of the formatted entries of a source in the
+// interactive view, following the end of the stream unless scrolled up.
+// Its fields are guarded by the lock of the view.
+type pane struct {
+	v       *view
+	name    string
+	records []*record
+	current *record
+	partial []byte
+	done    bool
+
+	// width and height are the size of the lines shown, without the title
+	// of the pane.
+	width  int
+	height int
+
+	// top is the first line shown and selected the entry the keys act on,
+	// follow keeps the last one selected as new ones arrive, which it does
+	// again once the selection moves past the end.
+	top      int
+	selected *record
+	follow   bool
+
+	// paused freezes the pane on the first frozen records, the ones
+	// arriving meanwhile are kept for when it resumes.
+	paused bool
+	frozen int
+
+	// filter hides the entries not matching the query typed, search
+	// highlights its matches and is where n and N move to.
+	filter  structure.Filter
+	query   string
+	search  *regexp.Regexp
+	pattern string
+
+	// frame is the layout of the records shown, nil once they changed.
+	frame *frame
+}
+
+// record holds the formatted lines of an entry, or of a marker written
+// between entries when out is nil. entry is the entry as it was before
+// being formatted, which changes its severity and message, for filtering.
+type record struct {
+	out      *output
+	entry    *structure.Entry
+	lines    []string
+	expanded bool
+	marked   bool
+}
+
+// display returns the lines shown for the record, only the first one
+// unless it's expanded: then all of them, with the stack trace, followed
+// by its JSON pretty-printed.
+func (r *record) display() []string {
+	if len(r.lines) == 0 {
+		return nil
+	}
+	if !r.expanded {
+		return r.lines[:1]
+	}
+	return append(append([]string{}, r.lines...), details(r.out)...)
+}
+
+// timestamp returns the time of the entry of r, nil for markers and
+// entries without one.
+func (r *record) timestamp() *time.Time {
+	if r.out == nil {
+		return nil
+	}
+	return r.out.entry.Timestamp
+}
+
+// details returns the JSON of the entry pretty-printed.
+func details(out *output) []string {
+	if out == nil || out.raw {
+		return nil
+	}
+	var b bytes.Buffer
+	if err := json.Indent(&b, out.line.JSON, "  ", "  "); err != nil {
+		return nil
+	}
+	return strings.Split("  "+b.String(), "\n")
+}
+
+// begin attributes the lines written until end to the entry of out.
+func (p *pane) begin(out *output) {
+	p.v.mu.Lock()
+	defer p.v.mu.Unlock()
+	entry := *out.entry
+	p.current = &record{out: out, entry: &entry}
+	p.add(p.current)
+}
+
+func (p *pane) end() {
+	p.v.mu.Lock()
+	defer p.v.mu.Unlock()
+	if len(p.partial) > 0 {
+		p.current.lines = append(p.current.lines, string(p.partial))
+		p.partial = nil
+		p.changed()
+	}
+	p.current = nil
+}
+
+// Write adds the lines written to the entry being written, or as markers
+// between entries.
+func (p *pane) Write(b []byte) (int, error) {
+	p.v.mu.Lock()
+	defer p.v.mu.Unlock()
+	n := len(b)
+	for {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(p.partial) + string(b[:i])
+		p.partial = nil
+		if p.current != nil {
+			p.current.lines = append(p.current.lines, line)
+		} else {
+			p.add(&record{lines: []string{line}})
+		}
+		b = b[i+1:]
+	}
+	p.partial = append(p.partial, b...)
+	p.changed()
+	return n, nil
+}
+
+// add appends r to the buffer, dropping the oldest record when it's full.
+func (p *pane) add(r *record) {
+	if len(p.records) == maxRecords {
+		if p.shows(p.records[0]) {
+			p.top -= len(p.records[0].display())
+		}
+		p.records[0] = nil
+		p.records = p.records[1:]
+		if p.frozen > 0 {
+			p.frozen--
+		}
+	}
+	p.records = append(p.records, r)
+	p.changed()
+}
+
+// row is a line shown in a pane, of the record r.
+type row struct {
+	r    *record
+	text string
+}
+
+// frame is the layout of a pane: the rows shown, the records they're of
+// and the index of the first row of each, by their index in records.
+type frame struct {
+	rows    []row
+	records []*record
+	starts  []int
+	index   map[*record]int
+}
+
+// indexOf returns the index of r in the records shown, -1 when it's not
+// shown.
+func (f *frame) indexOf(r *record) int {
+	if i, ok := f.index[r]; ok {
+		return i
+	}
+	return -1
+}
+
+// span returns the first and the last row of the i-th record.
+func (f *frame) span(i int) (start, end int) {
+	end = len(f.rows) - 1
+	if i+1 < len(f.starts) {
+		end = f.starts[i+1] - 1
+	}
+	return f.starts[i], end
+}
+
+// changed marks the layout of the pane to be computed again, for the
+// records shown or their lines changed.
+func (p *pane) changed() {
+	p.frame = nil
+	p.v.dirty = true
+}
+
+// layout returns the lines of the records matching the filter, computed
+// again only once they changed, selecting the last one when following.
+func (p *pane) layout() *frame {
+	if p.frame == nil {
+		records := p.records
+		if p.paused {
+			records = records[:p.frozen]
+		}
+		f := &frame{index: make(map[*record]int)}
+		for _, r := range records {
+			lines := r.display()
+			if len(lines) == 0 || !p.shows(r) {
+				continue
+			}
+			f.index[r] = len(f.records)
+			f.records = append(f.records, r)
+			f.starts = append(f.starts, len(f.rows))
+			for _, text := range lines {
+				f.rows = append(f.rows, row{r, text})
+			}
+		}
+		p.frame = f
+	}
+	f := p.frame
+	if len(f.rows) == 0 {
+		p.selected = nil
+		return f
+	}
+	if _, shown := f.index[p.selected]; p.follow || !shown {
+		p.selected = p.nearest(f)
+	}
+	return f
+}
+
+// nearest returns the record shown closest after the selected one, which
+// was hidden or dropped, or the last one.
+func (p *pane) nearest(f *frame) *record {
+	if !p.follow && p.selected != nil {
+		after := false
+		for _, r := range p.records {
+			after = after || r == p.selected
+			if _, shown := f.index[r]; after && shown {
+				return r
+			}
+		}
+	}
+	return f.records[len(f.records)-1]
+}
+
+// shows reports whether the lines of r match the filter and their
+// severity isn't hidden, markers between entries are hidden while
+// filtering.
+func (p *pane) shows(r *record) bool {
+	if p.filter == nil && len(p.v.hidden) == 0 {
+		return true
+	}
+	if r.out == nil {
+		return false
+	}
+	if key, ok := severityKey(r.entry.Severity); ok && p.v.hidden[key] {
+		return false
+	}
+	return p.filter == nil || p.filter(r.entry)
+}
+
+// setQuery filters the entries with the query, all of them are shown again
+// when it's empty.
+func (p *pane) setQuery(query string) error {
+	if strings.TrimSpace(query) == "" {
+		p.filter, p.query = nil, ""
+		p.changed()
+		return nil
+	}
+	filter, err := structure.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+	p.filter, p.query = filter, query
+	p.changed()
+	return nil
+}
+
+// setSearch searches the pattern, ignoring case when it has no capitals.
+func (p *pane) setSearch(pattern string) error {
+	p.search, p.pattern = nil, pattern
+	if pattern == "" {
+		return nil
+	}
+	if strings.ToLower(pattern) == pattern {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	p.search = re
+	return nil
+}
+
+// next selects the next entry matching the search after the selected one,
+// or before it when n is negative, the selected one included when n is 0.
+// It wraps around past the last or the first entry, and returns a message
+// when it did or nothing matched.
+func (p *pane) next(n int) string {
+	if p.search == nil {
+		return "no search, type / and a pattern"
+	}
+	f := p.layout()
+	records := f.records
+	step := 1
+	if n < 0 {
+		step = -1
+	}
+	start := f.indexOf(p.selected)
+	if n != 0 {
+		start += step
+	}
+	for k := 0; k < len(records); k++ {
+		i := ((start+k*step)%len(records) + len(records)) % len(records)
+		if !p.matches(records[i]) {
+			continue
+		}
+		p.follow = false
+		p.selected = records[i]
+		if !p.matchesShown(records[i]) {
+			p.expand(records[i], true)
+		}
+		if (step > 0) != (i >= start) {
+			return "search wrapped"
+		}
+		return ""
+	}
+	return "pattern not found: " + p.pattern
+}
+
+// matches reports whether the search matches any line of r, collapsed or
+// not, or its JSON.
+func (p *pane) matches(r *record) bool {
+	if r.out != nil && p.search.Match(r.out.line.Raw) {
+		return true
+	}
+	for _, line := range r.lines {
+		if p.search.MatchString(structure.StripColors(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesShown reports whether the search matches a line shown for r.
+func (p *pane) matchesShown(r *record) bool {
+	for _, line := range r.display() {
+		if p.search.MatchString(structure.StripColors(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextMark selects the next marked entry after the selected one, or
+// before it when n is negative, wrapping around.
+func (p *pane) nextMark(n int) string {
+	f := p.layout()
+	records := f.records
+	step := 1
+	if n < 0 {
+		step = -1
+	}
+	start := f.indexOf(p.selected) + step
+	for k := 0; k < len(records); k++ {
+		i := ((start+k*step)%len(records) + len(records)) % len(records)
+		if records[i].marked {
+			p.follow = false
+			p.selected = records[i]
+			return ""
+		}
+	}
+	return "no marked entry, press m to mark one"
+}
+
+// text returns the JSON of the entry of r, or its line when it isn't JSON,
+// or when rendered its lines as shown without colors.
+func (r *record) text(rendered bool) string {
+	if rendered || r.out == nil {
+		return structure.StripColors(strings.Join(r.display(), "\n"))
+	}
+	if r.out.raw {
+		return string(r.out.line.Raw)
+	}
+	return string(r.out.line.JSON)
+}
+
+// marked returns the JSON of the marked entries, or the lines for those
+// which aren't JSON.
+func (p *pane) marked() [][]byte {
+	var lines [][]byte
+	for _, r := range p.records {
+		if !r.marked || r.out == nil {
+			continue
+		}
+		lines = append(lines, []byte(r.text(false)))
+	}
+	return lines
+}
+
+// move selects the record n records after the selected one, or before it
+// when n is negative, following again past the last one.
+func (p *pane) move(n int) {
+	f := p.layout()
+	records := f.records
+	i := f.indexOf(p.selected) + n
+	p.follow = i >= len(records)
+	if p.paused && p.follow {
+		p.paused = false
+		p.changed()
+	}
+	switch {
+	case len(records) == 0:
+	case i >= len(records):
+		p.selected = records[len(records)-1]
+	case i < 0:
+		p.selected = records[0]
+	default:
+		p.selected = records[i]
+	}
+}
+
+// moveLines selects the record n lines after the selected one, or before
+// it when n is negative.
+func (p *pane) moveLines(n int) {
+	f := p.layout()
+	rows := f.rows
+	i := len(rows)
+	if k := f.indexOf(p.selected); k >= 0 {
+		i, _ = f.span(k)
+	}
+	i += n
+	if i >= len(rows) {
+		p.move(len(rows))
+		return
+	}
+	if i < 0 {
+		i = 0
+	}
+	p.follow = false
+	p.selected = rows[i].r
+}
+
+// first selects the first record.
+func (p *pane) first() {
+	if f := p.layout(); len(f.records) > 0 {
+		p.follow = false
+		p.selected = f.records[0]
+	}
+}
+
+// selectAt selects the last entry at or before t, or the first one when
+// they are all after it.
+func (p *pane) selectAt(t time.Time) {
+	var at *record
+	for _, r := range p.layout().records {
+		ts := r.timestamp()
+		if ts == nil {
+			continue
+		}
+		if ts.After(t) {
+			if at == nil {
+				at = r
+			}
+			break
+		}
+		at = r
+	}
+	if at != nil {
+		p.follow = false
+		p.selected = at
+	}
+}
+
+// pause freezes the pane, or resumes following the stream.
+func (p *pane) pause(paused bool) {
+	if !paused {
+		p.follow, p.paused = true, false
+		p.changed()
+		return
+	}
+	if !p.paused {
+		p.follow, p.paused, p.frozen = false, true, len(p.records)
+		p.changed()
+	}
+}
+
+// expand shows all the lines of r, or only the first one.
+func (p *pane) expand(r *record, expanded bool) {
+	r.expanded = expanded
+	p.changed()
+}
+
+// reveal scrolls the pane to show the selected record, as much of it as
+// fits, or the last lines when following.
+func (p *pane) reveal(f *frame) {
+	rows := f.rows
+	start, end := -1, -1
+	if i := f.indexOf(p.selected); i >= 0 {
+		start, end = f.span(i)
+	}
+	if p.follow {
+		p.top = len(rows) - p.height
+	}
+	if end >= p.top+p.height {
+		p.top = end - p.height + 1
+	}
+	if start >= 0 && start < p.top {
+		p.top = start
+	}
+	if bottom := len(rows) - p.height; p.top > bottom {
+		p.top = bottom
+	}
+	if p.top < 0 {
+		p.top = 0
+	}
+}
+
+// render returns the lines shown, height of them as wide as the pane, the
+// selected entry marked in the margin.
+func (p *pane) render() []string {
+	f := p.layout()
+	rows := f.rows
+	p.reveal(f)
+	lines := make([]string, p.height)
+	for i := range lines {
+		n := p.top + i
+		if n >= len(rows) {
+			lines[i] = fit("", p.width)
+			continue
+		}
+		r := rows[n].r
+		margin := " "
+		switch {
+		case r.marked && (n == 0 || rows[n-1].r != r):
+			margin = markColor.Sprint("•")
+			if r == p.selected {
+				margin = selectedColor.Sprint("•")
+			}
+		case r == p.selected:
+			margin = selectedColor.Sprint("▌")
+		}
+		text := strings.ReplaceAll(rows[n].text, "\t", "    ")
+		if plain := structure.StripColors(text); p.search != nil && p.search.MatchString(plain) {
+			// The colors are dropped from the lines matching, for the
+			// matches to stand out.
+			text = structure.HighlightMatches(p.search, plain)
+		}
+		lines[i] = fit(margin+text, p.width)
+	}
+	return lines
+}
+
+// info returns the position of the selected entry, whether the pane is
+// following the stream or paused, its filter and search.
+func (p *pane) info() string {
+	f := p.layout()
+	info := fmt.Sprintf(" %d/%d", f.indexOf(p.selected)+1, len(f.records))
+	switch {
+	case p.paused:
+		arrived := 0
+		for _, r := range p.records[p.frozen:] {
+			if p.shows(r) && len(r.lines) > 0 {
+				arrived++
+			}
+		}
+		info += fmt.Sprintf("  paused +%d new", arrived)
+	case p.follow && !p.done:
+		info += "  following"
+	case p.done:
+		info += "  end of input"
+	}
+	if p.query != "" {
+		info += "  filter: " + p.query
+	}
+	if p.search != nil {
+		info += "  /" + p.pattern
+	}
+	marked := 0
+	for _, r := range p.records {
+		if r.marked {
+			marked++
+		}
+	}
+	if marked > 0 {
+		info += fmt.Sprintf("  %d marked", marked)
+	}
+	return info
+}
+
+// fit truncates s to width, or pads it with spaces up to it.
+func fit(s string, width int) string {
+	if width < 1 {
+		return ""
+	}
+	s = structure.Truncate(s, width)
+	if n := utf8.RuneCountInString(structure.StripColors(s)); n < width {
+		s += strings.Repeat(" ", width-n)
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/robfig/jl/structure"
+)
+
+// preset configures the keys of the entries of a logging library, the
+// fields it adds which aren't worth showing and its own severities.
+type preset struct {
+	keys       structure.Keys
+	excludes   []string
+	severities map[string]string
+}
+
+// presets are the logging libraries --preset knows, by name.
+var presets = map[string]preset{
+	"zap": {
+		keys:     structure.Keys{Timestamp: "ts", Severity: "level", Message: "msg", Caller: "caller", Error: "error"},
+		excludes: []string{"ts", "level", "msg", "caller", "stacktrace", "errorVerbose"},
+	},
+	"logrus": {
+		keys:     structure.Keys{Timestamp: "time", Severity: "level", Message: "msg", Caller: "file", Error: "error"},
+		excludes: []string{"time", "level", "msg", "file", "func"},
+	},
+	"zerolog": {
+		keys:     structure.Keys{Timestamp: "time", Severity: "level", Message: "message", Caller: "caller", Error: "error"},
+		excludes: []string{"time", "level", "message", "caller", "stack"},
+	},
+	"slog": {
+		keys:     structure.Keys{Timestamp: "time", Severity: "level", Message: "msg", Caller: "source", Error: "err"},
+		excludes: []string{"time", "level", "msg", "source"},
+	},
+	"bunyan": {
+		keys:     structure.Keys{Timestamp: "time", Severity: "level", Message: "msg", Caller: "src", Error: "err"},
+		excludes: []string{"time", "level", "msg", "src", "hostname", "pid", "v"},
+	},
+	"pino": {
+		keys:     structure.Keys{Timestamp: "time", Severity: "level", Message: "msg", Error: "err"},
+		excludes: []string{"time", "level", "msg", "hostname", "pid"},
+	},
+	"log15": {
+		keys:       structure.Keys{Timestamp: "t", Severity: "lvl", Message: "msg"},
+		excludes:   []string{"t", "lvl", "msg"},
+		severities: map[string]string{"dbug": "debug", "eror": "error", "crit": "critical"},
+	},
+}
+
+// presetNames returns the names of the presets, sorted.
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/robfig/jl/djson"
+	"github.com/robfig/jl/stream"
+	"github.com/robfig/jl/structure"
+)
+
+var suppressedColor = color.New(color.FgHiBlack)
+var errorRateColor = color.New(color.FgRed)
+
+// stderrColor marks the lines of the stderr of the command run.
+var stderrColor = color.New(color.FgRed, color.Faint)
+
+// errorRateInterval is how often the error rate is written.
+const errorRateInterval = 10 * time.Second
+
+// timeKeys are ignored when comparing entries for duplicates.
+var timeKeys = []string{"timestamp", "@timestamp", "time", "date", "ts"}
+
+// processor filters the lines of the stream and writes them, formatting
+// the entries.
+type processor struct {
+	formatter *structure.Formatter
+	renderer  structure.Renderer
+	filter    structure.Filter
+	until     time.Time
+	limiter   *structure.RateLimiter
+	dedupe    bool
+	before    int
+	after     int
+	grouper   *grouper
+	uniq      *uniq
+	alerter   *alerter
+	quiet     bool
+	count     bool
+	counts    structure.SeverityCounts
+	stats     *stats
+	histogram *structure.Histogram
+	top       *structure.Top
+	latencies []*structure.Percentiles
+	distinct  []*structure.Distinct
+	agg       *structure.Aggregation
+	errorRate *structure.ErrorRate
+	summary   *structure.Summary
+	metrics   *metrics
+	bursts    *structure.BurstDetector
+	validator *validator
+	interrupt <-chan os.Signal
+	stdout    io.Writer
+	pane      *pane
+
+	// reload is called on each signal of hangup, to reload the
+	// configuration between two lines.
+	hangup <-chan os.Signal
+	reload func()
+
+	// stderr, when set, reports whether each line read came from the
+	// stderr of the command run, in order.
+	stderr func() bool
+
+	// pipefail exits with the status of a broken pipe once the output is
+	// closed, stopping the command run.
+	pipefail bool
+	command  *command
+
+	// source labels the entries read when there are several sources, or
+	// origin names the source of each line read, in order, when they are
+	// read from several at once.
+	source string
+	origin func() string
+
+	// gap is the time between two entries above which it's marked, last
+	// is the timestamp of the last entry written.
+	gap  time.Duration
+	last *time.Time
+
+	pending *output
+
+	// recent holds the lines not matching the filter which may be shown
+	// as context before the next match, afterLeft counts the lines still
+	// to show after the last one.
+	recent    []*output
+	afterLeft int
+	matched   bool
+	skipped   bool
+
+	// related is the number of lines of the same request or logger shown
+	// before each match, recentRelated holds them by request or logger.
+	related       int
+	recentRelated map[string][]*output
+
+	// stages change the entries as soon as they're read, ex: --redact.
+	stages *structure.Chain
+
+	// files marks the origin of each line as the path of the file it was
+	// read from, its entries labeled with the name of the file when labels
+	// is set and counted apart among fileStats with --stats-by-file.
+	files     bool
+	labels    bool
+	fileStats []*stats
+}
+
+// maxRelated bounds the number of requests and loggers of which lines are
+// held on to as context.
+const maxRelated = 10000
+
+// output is a line about to be written, with the entry parsed from it
+// unless it's a raw line.
+type output struct {
+	line  *stream.Line
+	entry *structure.Entry
+	raw   bool
+	key   string
+	shown bool
+
+	// stderr is set for the lines of the stderr of the command run, marked
+	// in the gutter.
+	stderr bool
+}
+
+// process handles a single line, it returns false when no more lines
+// should be read.
+func (p *processor) process(line *stream.Line) bool {
+	stderr := p.stderr != nil && p.stderr()
+	source := p.source
+	if p.origin != nil {
+		source = p.origin()
+	}
+	if p.files {
+		source = p.fileSource(source)
+	}
+	entry, ok := decodeEntry(p.formatter, line)
+
+	// unable to parse entry, outputting raw line, which is filtered
+	// like an entry with only a message:
+	if !ok {
+		if p.validator != nil {
+			p.validator.check(line.Raw, nil, false)
+		}
+		if p.summary != nil {
+			p.summary.AddRaw(line.JSON != nil)
+		}
+		raw := &structure.Entry{Message: string(line.Raw), Source: source}
+		if p.metrics != nil {
+			p.metrics.line(raw, true, line.JSON != nil)
+		}
+		out := &output{line: line, entry: raw, raw: true, key: string(line.Raw), stderr: stderr}
+		if p.filter(raw) {
+			return p.match(out)
+		}
+		return p.reject(out)
+	}
+
+	entry.Source = source
+	if p.stages != nil && !runStages(p.stages, p.formatter, entry, line) {
+		return true
+	}
+	if p.validator != nil {
+		p.validator.check(line.Raw, entry.Fields, true)
+	}
+	if p.alerter != nil {
+		p.alerter.check(entry, line.JSON)
+	}
+	if p.errorRate != nil {
+		p.errorRate.Add(entry, time.Now())
+	}
+	if p.summary != nil {
+		p.summary.Add(entry)
+	}
+	if p.metrics != nil {
+		p.metrics.line(entry, false, false)
+	}
+	if p.bursts != nil && entry.Timestamp != nil {
+		for _, marker := range p.bursts.Add(*entry.Timestamp) {
+			if !p.flushPending() {
+				return false
+			}
+			p.writeBytes([]byte(marker))
+			p.writeBytes(structure.NewLine)
+		}
+	}
+	if !p.until.IsZero() && entry.Timestamp != nil && entry.Timestamp.After(p.until) {
+		return false
+	}
+	out := &output{line: line, entry: entry, key: duplicateKey(entry), stderr: stderr}
+	if !p.filter(entry) {
+		return p.reject(out)
+	}
+	return p.match(out)
+}
+
+// fileSource switches the stats to those of the file at path, when counted
+// apart, and returns the label of its entries.
+func (p *processor) fileSource(path string) string {
+	if p.stats != nil && p.stats.source != path {
+		for _, s := range p.fileStats {
+			if s.source == path {
+				p.stats = s
+				break
+			}
+		}
+	}
+	if !p.labels {
+		return ""
+	}
+	return sourceLabel(path)
+}
+
+// decodeEntry returns the normalized entry of the JSON of a line, decoded
+// once for the entry, its Fields and the formatter, or false when the line
+// has none.
+func decodeEntry(formatter *structure.Formatter, line *stream.Line) (*structure.Entry, bool) {
+	entry := &structure.Entry{}
+	if err := json.Unmarshal(line.JSON, &entry.Fields); err != nil || entry.Fields == nil {
+		return nil, false
+	}
+	djson.UnmarshalFields(entry.Fields, entry)
+	formatter.Normalize(entry, line.JSON)
+	return entry, true
+}
+
+// runStages runs stages on entry, it returns false when they dropped it.
+// The fields they changed are written back to the JSON of the line, which
+// replaces it in the line itself, and the entry is read from them again, so
+// that nothing sees the values they replaced, ex: the message with --redact
+// msg.
+func runStages(stages *structure.Chain, formatter *structure.Formatter, entry *structure.Entry, line *stream.Line) bool {
+	if !stages.Match(entry) {
+		return false
+	}
+	b, err := json.Marshal(entry.Fields)
+	if err != nil {
+		return false
+	}
+	line.JSON = b
+	line.Raw = append(append(append([]byte{}, line.Prefix...), b...), line.Suffix...)
+	*entry = structure.Entry{Fields: entry.Fields, Source: entry.Source}
+	djson.UnmarshalFields(entry.Fields, entry)
+	formatter.Normalize(entry, line.JSON)
+	return true
+}
+
+// match emits a line matching the filter, preceded by the lines kept as
+// its context and a separator when lines were skipped since the last one.
+func (p *processor) match(out *output) bool {
+	p.counts.Add(out.entry.Severity)
+	if p.metrics != nil {
+		p.metrics.match(out.entry)
+	}
+	if p.stats != nil {
+		p.stats.add(out)
+		return true
+	}
+	if p.histogram != nil || p.top != nil || len(p.latencies) > 0 || len(p.distinct) > 0 || p.agg != nil {
+		if p.histogram != nil {
+			p.histogram.Add(out.entry)
+		}
+		if out.raw {
+			// The lines which aren't JSON have no fields to aggregate.
+			return true
+		}
+		if p.top != nil {
+			p.top.Add(out.entry)
+		}
+		for _, percentiles := range p.latencies {
+			percentiles.Add(out.entry)
+		}
+		for _, distinct := range p.distinct {
+			distinct.Add(out.entry)
+		}
+		if p.agg != nil {
+			p.agg.Add(out.entry)
+		}
+		return true
+	}
+	if p.quiet {
+		return true
+	}
+	if p.uniq != nil && !p.uniq.first(out.entry) {
+		return true
+	}
+	context := p.recent
+	if key, ok := relatedKey(out.entry); ok && p.related > 0 {
+		context = mergeContext(p.recentRelated[key], p.recent)
+		delete(p.recentRelated, key)
+	}
+	if p.matched && (p.skipped || p.related > 0 && len(context) > 0) && (p.before > 0 || p.after > 0 || p.related > 0) {
+		if !p.flushPending() {
+			return false
+		}
+		p.writeBytes([]byte(suppressedColor.Sprint("--")))
+		p.writeBytes(structure.NewLine)
+	}
+	for _, line := range context {
+		if !p.emit(line) {
+			return false
+		}
+	}
+	p.recent = p.recent[:0]
+	p.matched = true
+	p.skipped = false
+	p.afterLeft = p.after
+	return p.emit(out)
+}
+
+// mergeContext merges the lines of the same request or logger with the
+// lines right before a match, leaving out the lines already shown.
+func mergeContext(related, recent []*output) []*output {
+	var merged []*output
+	for _, out := range append(related, recent...) {
+		if !out.shown {
+			merged = append(merged, out)
+			out.shown = true
+		}
+	}
+	return merged
+}
+
+// reject shows a line not matching the filter as context after the last
+// match, or keeps it as context for the next one.
+func (p *processor) reject(out *output) bool {
+	if p.afterLeft > 0 {
+		p.afterLeft--
+		return p.emit(out)
+	}
+	p.keepRelated(out)
+	if p.before == 0 {
+		p.skipped = true
+		return true
+	}
+	if len(p.recent) == p.before {
+		p.recent = append(p.recent[:0], p.recent[1:]...)
+		p.skipped = true
+	}
+	p.recent = append(p.recent, out)
+	return true
+}
+
+// emit writes out, or holds on to it when collapsing duplicates until a
+// different line comes by.
+func (p *processor) emit(out *output) bool {
+	if !p.dedupe {
+		return p.write(out)
+	}
+	if p.pending != nil && p.pending.key == out.key {
+		p.pending.entry.Repeats++
+		return true
+	}
+	ok := p.flushPending()
+	out.entry.Repeats = 1
+	p.pending = out
+	return ok
+}
+
+func (p *processor) flushPending() bool {
+	if p.pending == nil {
+		return true
+	}
+	out := p.pending
+	p.pending = nil
+	return p.write(out)
+}
+
+// write writes out, unless it's held back with the other lines of its
+// request.
+func (p *processor) write(out *output) bool {
+	if p.grouper != nil && p.grouper.add(out, time.Now()) {
+		return true
+	}
+	return p.writeOutput(out)
+}
+
+// writeGroups writes the groups of lines of the requests done by now, or
+// of all of them when now is zero.
+func (p *processor) writeGroups(now time.Time) bool {
+	if p.grouper == nil {
+		return true
+	}
+	for _, grp := range p.grouper.done(now) {
+		p.writeBytes([]byte(grp.header()))
+		p.writeBytes(structure.NewLine)
+		for _, out := range grp.outputs {
+			if !p.writeOutput(out) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *processor) writeOutput(out *output) bool {
+	if p.limiter != nil && !p.limiter.Allow(out.entry, time.Now()) {
+		return true
+	}
+	if p.renderer != nil {
+		// The output of --output has no markers, the lines which aren't
+		// entries are rendered as messages.
+		raw := out.line.JSON
+		if out.raw {
+			raw = nil
+		}
+		return p.render(p.renderer, out.entry, raw, out.line)
+	}
+	if ts := out.entry.Timestamp; ts != nil && p.gap > 0 {
+		if p.last != nil && ts.Sub(*p.last) > p.gap {
+			p.writeBytes([]byte(structure.GapMarker(ts.Sub(*p.last))))
+			p.writeBytes(structure.NewLine)
+		}
+		p.last = ts
+	}
+	if p.pane != nil {
+		p.pane.begin(out)
+		defer p.pane.end()
+	}
+	if out.stderr {
+		p.writeBytes([]byte(stderrColor.Sprint("┃") + " "))
+	}
+	line := out.line
+	if out.raw {
+		if out.entry.Source != "" {
+			p.writeBytes([]byte(p.formatter.SourceLabel(out.entry.Source) + " "))
+		}
+		if p.formatter.Highlight != nil {
+			p.writeBytes([]byte(structure.HighlightMatches(p.formatter.Highlight, string(line.Raw))))
+		} else {
+			p.writeBytes(line.Raw)
+		}
+		if out.entry.Repeats > 1 {
+			p.writeBytes([]byte(" " + structure.Repeats(out.entry.Repeats)))
+		}
+		p.writeBytes(structure.NewLine)
+		return true
+	}
+
+	// Passing entry to formatter to output:
+	return p.render(p.formatter, out.entry, line.JSON, line)
+}
+
+// render writes entry with r, it returns false when the output failed.
+func (p *processor) render(r structure.Renderer, entry *structure.Entry, raw json.RawMessage, line *stream.Line) bool {
+	err := r.Format(entry, raw, line.Prefix, line.Suffix)
+	var missing *structure.MissingFieldsError
+	if errors.As(err, &missing) {
+		fmt.Fprintf(os.Stderr, "invalid format: %v\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		if p.pipefail {
+			p.failOutput()
+		}
+		fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// keepRelated holds on to a line not matching the filter as context for the
+// next match of the same request or logger.
+func (p *processor) keepRelated(out *output) {
+	key, ok := relatedKey(out.entry)
+	if !ok || p.related == 0 {
+		return
+	}
+	if p.recentRelated == nil || len(p.recentRelated) >= maxRelated {
+		p.recentRelated = make(map[string][]*output)
+	}
+	recent := append(p.recentRelated[key], out)
+	if len(recent) > p.related {
+		recent = recent[1:]
+	}
+	p.recentRelated[key] = recent
+}
+
+// relatedKey identifies the request, or else the logger, of an entry.
+func relatedKey(entry *structure.Entry) (string, bool) {
+	if id, ok := structure.CorrelationID(entry.Fields, structure.CorrelationKeys); ok {
+		return "id:" + id, true
+	}
+	if name, ok := entry.LoggerName(); ok {
+		return "logger:" + name, true
+	}
+	return "", false
+}
+
+// duplicateKey identifies an entry for collapsing duplicates, ignoring its
+// timestamp.
+func duplicateKey(entry *structure.Entry) string {
+	fields := make(map[string]interface{}, len(entry.Fields))
+	for key, value := range entry.Fields {
+		fields[key] = value
+	}
+	for _, key := range timeKeys {
+		delete(fields, key)
+	}
+	key, _ := json.Marshal(fields)
+	return string(key)
+}
+
+// flush writes the lines held back and the summary of the lines
+// suppressed by the rate limit.
+func (p *processor) flush() {
+	p.flushPending()
+	p.writeGroups(time.Time{})
+	p.summarize()
+	if p.count {
+		summary := fmt.Sprintf("%d matched", p.counts.Total())
+		if len(p.counts) > 0 {
+			summary += " (" + p.counts.String() + ")"
+		}
+		p.writeBytes([]byte(summary))
+		p.writeBytes(structure.NewLine)
+	}
+	if p.uniq != nil {
+		for _, line := range p.uniq.summary() {
+			p.writeBytes([]byte(suppressedColor.Sprint(line)))
+			p.writeBytes(structure.NewLine)
+		}
+	}
+}
+
+// summarize writes the summary of the lines suppressed by the rate limit.
+func (p *processor) summarize() {
+	if p.limiter == nil {
+		return
+	}
+	if summary := p.limiter.Summary(); summary != "" {
+		p.writeBytes([]byte(suppressedColor.Sprint("… " + summary)))
+		p.writeBytes(structure.NewLine)
+	}
+}
+
+// writeErrorRate writes the errors within the window before now, in red
+// when there are any.
+func (p *processor) writeErrorRate(now time.Time) {
+	c := suppressedColor
+	if _, errors := p.errorRate.Counts(now); errors > 0 {
+		c = errorRateColor
+	}
+	p.writeBytes([]byte(c.Sprint("── " + p.errorRate.Summary(now))))
+	p.writeBytes(structure.NewLine)
+}
+
+// run processes the lines of the stream until it ends or is interrupted.
+// Lines held back are written and the suppressed lines summarized
+// periodically.
+func (p *processor) run(s stream.Stream) {
+	var tick, groupTick, limiterTick, errorRateTick <-chan time.Time
+	if p.dedupe {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	if p.grouper != nil {
+		ticker := time.NewTicker(p.grouper.window / 2)
+		defer ticker.Stop()
+		groupTick = ticker.C
+	}
+	if p.limiter != nil {
+		ticker := time.NewTicker(p.limiter.Per)
+		defer ticker.Stop()
+		limiterTick = ticker.C
+	}
+	if p.errorRate != nil {
+		ticker := time.NewTicker(errorRateInterval)
+		defer ticker.Stop()
+		errorRateTick = ticker.C
+	}
+	lines := s.Lines()
+	defer p.flush()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok || !p.process(line) {
+				return
+			}
+		case <-tick:
+			p.flushPending()
+		case now := <-groupTick:
+			if !p.writeGroups(now) {
+				return
+			}
+		case <-limiterTick:
+			p.summarize()
+		case now := <-errorRateTick:
+			p.writeErrorRate(now)
+		case <-p.interrupt:
+			return
+		case <-p.hangup:
+			p.reload()
+		}
+	}
+}
+
+func (p *processor) writeBytes(line []byte) {
+	_, err := p.stdout.Write(line)
+	if err != nil {
+		if p.pipefail {
+			p.failOutput()
+		}
+		fmt.Fprintf(os.Stderr, "broken pipe: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// failOutput exits quietly once the output is closed with --pipefail, with
+// the status of a broken pipe, stopping the command run first.
+func (p *processor) failOutput() {
+	if p.command != nil {
+		p.command.stop()
+	}
+	os.Exit(brokenPipeStatus)
+}
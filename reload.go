@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/robfig/jl/structure"
+)
+
+// reloadOptions applies the configuration files again to the options
+// given, for the configuration to be reloaded on SIGHUP. It returns an
+// error instead of the options the configuration makes invalid, for the
+// options in use to be kept along with their colors and severities.
+func reloadOptions(opts options) (options, error) {
+	if opts.given == nil {
+		return opts, errors.New("no options given")
+	}
+	reloaded := opts.given.clone()
+	reloaded.given = opts.given
+	if err := configure(&reloaded); err != nil {
+		return opts, err
+	}
+	options, err := formatterOptions(reloaded)
+	if err != nil {
+		return opts, err
+	}
+	if _, err := structure.NewFormatter(io.Discard, options...); err != nil {
+		return opts, formatterError(err)
+	}
+	if err := install(reloaded, opts); err != nil {
+		return opts, err
+	}
+	return reloaded, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/robfig/jl/structure"
+)
+
+// reports returns the results of the analysis options as tables, for
+// --report-format json or csv.
+func reports(p *processor, stats *structure.Table, topN int, loc *time.Location) []*structure.Table {
+	var tables []*structure.Table
+	if stats != nil {
+		tables = append(tables, stats)
+	}
+	if p.histogram != nil {
+		tables = append(tables, p.histogram.Table(loc))
+	}
+	if p.top != nil {
+		tables = append(tables, p.top.Tables(topN)...)
+	}
+	for _, percentiles := range p.latencies {
+		tables = append(tables, percentiles.Table())
+	}
+	for _, distinct := range p.distinct {
+		tables = append(tables, distinct.Table())
+	}
+	if p.agg != nil {
+		tables = append(tables, p.agg.Table())
+	}
+	return tables
+}
+
+// writeReports writes the tables as JSON, an object per line, or as CSV,
+// separated by blank lines.
+func writeReports(w io.Writer, format string, tables []*structure.Table) {
+	for i, table := range tables {
+		var err error
+		switch format {
+		case "json":
+			var b []byte
+			if b, err = json.Marshal(table); err == nil {
+				_, err = fmt.Fprintf(w, "%s\n", b)
+			}
+		case "csv":
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			err = table.CSV(w)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write the report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// writeTextReports writes the results of the analysis options as text.
+func writeTextReports(p *processor, topN int, loc *time.Location) {
+	if p.histogram != nil {
+		for _, line := range p.histogram.Lines(loc) {
+			fmt.Println(line)
+		}
+	}
+	if p.top != nil {
+		for _, line := range p.top.Table(topN) {
+			fmt.Println(line)
+		}
+	}
+	for _, percentiles := range p.latencies {
+		for _, line := range percentiles.Lines() {
+			fmt.Println(line)
+		}
+	}
+	for _, distinct := range p.distinct {
+		fmt.Println(distinct)
+	}
+	if p.agg != nil {
+		for _, line := range p.agg.Table().Lines() {
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/robfig/jl/structure"
+)
+
+// stats counts the lines matching the filters, instead of showing them.
+type stats struct {
+	source     string
+	lines      int
+	json       int
+	severities structure.SeverityCounts
+}
+
+func newStats(source string) *stats {
+	return &stats{source: source, severities: make(structure.SeverityCounts)}
+}
+
+func (s *stats) add(out *output) {
+	s.lines++
+	if !out.raw {
+		s.json++
+		s.severities.Add(out.entry.Severity)
+	}
+}
+
+// write writes the counts as a table, with the percentage of the lines.
+func (s *stats) write(w io.Writer) {
+	if s.source != "" {
+		fmt.Fprintf(w, "%s:\n", s.source)
+	}
+	row := func(label string, count int) {
+		percent := 0.0
+		if s.lines > 0 {
+			percent = 100 * float64(count) / float64(s.lines)
+		}
+		fmt.Fprintf(w, "  %-10s %8d %6.1f%%\n", label, count, percent)
+	}
+	row("lines", s.lines)
+	row("json", s.json)
+	row("non-json", s.lines-s.json)
+	for _, severity := range s.severities.Severities() {
+		label := severity
+		if label == "" {
+			label = "no level"
+		}
+		row(label, s.severities[severity])
+	}
+}
+
+// table returns the counts as a table, with the source as first column
+// when counting per file.
+func (s *stats) table() *structure.Table {
+	t := &structure.Table{Name: "stats", Header: []string{"kind", "count"}}
+	row := func(label string, count int) {
+		t.Rows = append(t.Rows, []string{label, strconv.Itoa(count)})
+	}
+	row("lines", s.lines)
+	row("json", s.json)
+	row("non-json", s.lines-s.json)
+	for _, severity := range s.severities.Severities() {
+		row("severity "+severity, s.severities[severity])
+	}
+	if s.source != "" {
+		t.Header = append([]string{"source"}, t.Header...)
+		for i, r := range t.Rows {
+			t.Rows[i] = append([]string{s.source}, r...)
+		}
+	}
+	return t
+}
@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseLogfmt reads a logfmt line as an entry, ex: `level=info msg=hi`.
+func parseLogfmt(raw []byte) (*Line, error) {
+	fields, ok := ParseLogfmt(string(raw))
+	if !ok {
+		return nil, ErrUnstructured
+	}
+	return marshalLine(fields)
+}
+
+// parseCRI reads a line of the logs of a container written by a container
+// runtime, like in Kubernetes: its time, stream, whether it's partial and
+// its content, ex: "2024-05-01T12:00:00.1Z stdout F {"msg":"hi"}". The JSON
+// of the content is its entry, the header its prefix, and else the content
+// is the message of an entry. Partial lines aren't joined.
+func parseCRI(raw []byte) (*Line, error) {
+	parts := strings.SplitN(string(raw), " ", 4)
+	if len(parts) < 3 || (parts[1] != "stdout" && parts[1] != "stderr") || (parts[2] != "P" && parts[2] != "F") {
+		return nil, ErrUnstructured
+	}
+	if _, err := time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return nil, ErrUnstructured
+	}
+	content := ""
+	if len(parts) == 4 {
+		content = parts[3]
+	}
+	if line, err := parseJSON([]byte(content)); err == nil {
+		line.Prefix = append(raw[:len(raw)-len(content):len(raw)-len(content)], line.Prefix...)
+		return line, nil
+	}
+	return marshalLine(map[string]interface{}{"time": parts[0], "stream": parts[1], "msg": content})
+}
+
+// syslogSeverities are the severities of syslog by their code.
+var syslogSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// parseSyslog reads a syslog line, of RFC 5424 like "<165>1 2024-05-01T12:00:00Z
+// host app 42 ID47 - message" or of RFC 3164 like "<34>May  1 12:00:00 host
+// app[42]: message", as an entry with the time, severity, host, app, pid
+// and msg.
+func parseSyslog(raw []byte) (*Line, error) {
+	line := string(raw)
+	end := strings.IndexByte(line, '>')
+	if !strings.HasPrefix(line, "<") || end < 2 {
+		return nil, ErrUnstructured
+	}
+	priority, err := strconv.Atoi(line[1:end])
+	if err != nil || priority < 0 || priority > 191 {
+		return nil, ErrUnstructured
+	}
+	fields := map[string]interface{}{"severity": syslogSeverities[priority%8]}
+	rest := line[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		parts := strings.SplitN(rest[2:], " ", 7)
+		if len(parts) < 6 {
+			return nil, ErrUnstructured
+		}
+		for i, key := range []string{"time", "host", "app", "pid", "msgid", "data"} {
+			if parts[i] != "-" {
+				fields[key] = parts[i]
+			}
+		}
+		if len(parts) == 7 {
+			fields["msg"] = strings.TrimPrefix(parts[6], "\ufeff")
+		}
+		return marshalLine(fields)
+	}
+	if len(rest) < len(time.Stamp) {
+		return nil, ErrUnstructured
+	}
+	if _, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err != nil {
+		return nil, ErrUnstructured
+	}
+	fields["time"] = rest[:len(time.Stamp)]
+	parts := strings.SplitN(strings.TrimPrefix(rest[len(time.Stamp):], " "), " ", 2)
+	fields["host"] = parts[0]
+	if len(parts) == 2 {
+		message := parts[1]
+		if i := strings.Index(message, ": "); i >= 0 && !strings.Contains(message[:i], " ") {
+			tag := message[:i]
+			message = message[i+2:]
+			if open := strings.IndexByte(tag, '['); open >= 0 && strings.HasSuffix(tag, "]") {
+				fields["pid"] = tag[open+1 : len(tag)-1]
+				tag = tag[:open]
+			}
+			fields["app"] = tag
+		}
+		fields["msg"] = message
+	}
+	return marshalLine(fields)
+}
+
+// marshalLine returns a line of which the entry has fields.
+func marshalLine(fields map[string]interface{}) (*Line, error) {
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &Line{JSON: b}, nil
+}
+
+// ParseLogfmt returns the fields of a logfmt line, ex: `level=info
+// msg="user created" id=42`, the unquoted numbers and booleans as such. It
+// returns false when the line has no key=value pair.
+func ParseLogfmt(line string) (map[string]interface{}, bool) {
+	fields := map[string]interface{}{}
+	pairs := 0
+	for i := 0; i < len(line); {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if i >= len(line) || line[i] != '=' {
+			if key != "" {
+				// A key alone is a flag, as in logfmt.
+				fields[key] = true
+			}
+			continue
+		}
+		i++
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			fields[key] = value
+			pairs++
+			i = end + 1
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		fields[key] = logfmtValue(line[start:i])
+		pairs++
+	}
+	if pairs == 0 {
+		return nil, false
+	}
+	return fields, true
+}
+
+// logfmtValue reads an unquoted value of logfmt, as a number or a boolean
+// when it is one.
+func logfmtValue(text string) interface{} {
+	switch text {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if n, err := strconv.ParseFloat(text, 64); err == nil && json.Valid([]byte(text)) {
+		return n
+	}
+	return text
+}
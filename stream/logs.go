@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
-	"text/scanner"
 )
 
 // Line represents a line from the given Reader of a Stream, containing the
@@ -29,15 +28,24 @@ type Stream interface {
 
 type stream struct {
 	reader *bufio.Reader
+	parser Parser
 	result chan *Line
 	stop   chan struct{}
 	err    error
 }
 
-// New will construct a new Stream and start it.
+// New will construct a new Stream and start it, finding the JSON in the
+// lines.
 func New(r io.Reader) Stream {
+	return NewParsed(r, ParserFunc(parseJSON))
+}
+
+// NewParsed constructs a new Stream and starts it, parsing the lines with
+// p, ex: a parser of Lookup.
+func NewParsed(r io.Reader, p Parser) Stream {
 	l := &stream{
 		reader: bufio.NewReaderSize(r, bufio.MaxScanTokenSize),
+		parser: p,
 		result: make(chan *Line),
 		stop:   make(chan struct{}),
 	}
@@ -58,15 +66,14 @@ func (l *stream) run() {
 				break // break on EOF after processing the last line
 			}
 		}
-		json := l.parse(raw)
-		prefix, suffix := split(raw, json)
-		line := &Line{
-			Raw:    make([]byte, len(raw)),
-			Prefix: prefix,
-			Suffix: suffix,
+		line, err := l.parser.Parse(raw)
+		if err != nil || line == nil {
+			line = &Line{}
 		}
+		line.Raw = make([]byte, len(raw))
 		copy(line.Raw, raw)
-		if json != nil {
+		if line.JSON != nil {
+			json := line.JSON
 			line.JSON = make([]byte, len(json))
 			copy(line.JSON, json)
 		}
@@ -80,39 +87,6 @@ func (l *stream) run() {
 	close(l.result)
 }
 
-func (l *stream) parse(raw []byte) json.RawMessage {
-	var s scanner.Scanner
-	s.Init(bytes.NewReader(raw))
-	s.Error = func(s *scanner.Scanner, msg string) {}
-	depth := 0
-	start := -1
-	end := -1
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		if tok == '{' {
-			if depth == 0 {
-				start = s.Position.Offset
-			}
-			depth++
-		}
-		if tok == '}' {
-			depth--
-			if depth == 0 {
-				end = s.Position.Offset + 1
-				break
-			}
-		}
-	}
-	if start != -1 && end != -1 {
-		slice := raw[start:end]
-		var v interface{}
-		err := json.Unmarshal(slice, &v)
-		if err == nil {
-			return slice
-		}
-	}
-	return nil
-}
-
 func (l *stream) Close() {
 	l.stop <- struct{}{}
 	close(l.result)
@@ -122,3 +122,49 @@ func TestLongLine(t *testing.T) {
 		t.Errorf("no error expected on long line, got: %+v", err)
 	}
 }
+
+func parsed(t *testing.T, name, input string) *stream.Line {
+	t.Helper()
+	parser, ok := stream.Lookup(name)
+	if !ok {
+		t.Fatalf("no parser %q", name)
+	}
+	return <-stream.NewParsed(strings.NewReader(input), parser).Lines()
+}
+
+func TestParsers(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		parser, input string
+		json, prefix  string
+	}{
+		{"logfmt", `level=info msg="user \"a\" created" id=42 admin`, `{"admin":true,"id":42,"level":"info","msg":"user \"a\" created"}`, ""},
+		{"logfmt", `not logfmt`, "", ""},
+		{"cri", `2024-05-01T12:00:00.1Z stdout F {"msg": "hi"}`, `{"msg": "hi"}`, "2024-05-01T12:00:00.1Z stdout F "},
+		{"cri", `2024-05-01T12:00:00.1Z stderr P plain`, `{"msg":"plain","stream":"stderr","time":"2024-05-01T12:00:00.1Z"}`, ""},
+		{"syslog", `<165>1 2024-05-01T12:00:00Z host app 42 ID47 - started`, `{"app":"app","host":"host","msg":"started","msgid":"ID47","pid":"42","severity":"notice","time":"2024-05-01T12:00:00Z"}`, ""},
+		{"syslog", `<34>May  1 12:00:00 box su[42]: failed`, `{"app":"su","host":"box","msg":"failed","pid":"42","severity":"critical","time":"May  1 12:00:00"}`, ""},
+		{"syslog", `<34 not syslog`, "", ""},
+	} {
+		line := parsed(t, tc.parser, tc.input)
+		if string(line.Raw) != tc.input || string(line.JSON) != tc.json || string(line.Prefix) != tc.prefix {
+			t.Errorf("%s: %q\n\tgot JSON %s and prefix %q", tc.parser, tc.input, line.JSON, line.Prefix)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	stream.Register("upper", stream.ParserFunc(func(raw []byte) (*stream.Line, error) {
+		if strings.ToUpper(string(raw)) != string(raw) {
+			return nil, stream.ErrUnstructured
+		}
+		return &stream.Line{JSON: json.RawMessage(`{"level": "warn"}`)}, nil
+	}))
+	if line := parsed(t, "upper", "ALERT"); string(line.JSON) != `{"level": "warn"}` {
+		t.Errorf("expected the JSON of the parser, got %q", line.JSON)
+	}
+	if line := parsed(t, "upper", "calm"); line.JSON != nil {
+		t.Errorf("expected a raw line, got %q", line.JSON)
+	}
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"text/scanner"
+)
+
+// ErrUnstructured is returned by parsers for lines which aren't in their
+// format, the lines are then read as they are.
+var ErrUnstructured = errors.New("unstructured line")
+
+// Parser finds the entry in a line, returning it as JSON in a Line along
+// with the text before and after it, or an error when the line isn't in
+// its format. The Raw of the Line is set by the Stream.
+type Parser interface {
+	Parse(raw []byte) (*Line, error)
+}
+
+// ParserFunc lets a function be used as a Parser.
+type ParserFunc func(raw []byte) (*Line, error)
+
+// Parse calls f.
+func (f ParserFunc) Parse(raw []byte) (*Line, error) {
+	return f(raw)
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]Parser{
+		"json":   ParserFunc(parseJSON),
+		"logfmt": ParserFunc(parseLogfmt),
+		"cri":    ParserFunc(parseCRI),
+		"syslog": ParserFunc(parseSyslog),
+	}
+)
+
+// Register makes a parser available by name, ex: for the CLI to choose it.
+// It panics when the name is taken.
+func Register(name string, p Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	if _, ok := parsers[name]; ok {
+		panic(fmt.Sprintf("stream: parser %q registered twice", name))
+	}
+	parsers[name] = p
+}
+
+// Lookup returns the parser registered by name.
+func Lookup(name string) (Parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	p, ok := parsers[name]
+	return p, ok
+}
+
+// Parsers returns the names of the parsers registered, sorted.
+func Parsers() []string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseJSON finds the first JSON object of a line, the text around it is
+// its prefix and suffix.
+func parseJSON(raw []byte) (*Line, error) {
+	var s scanner.Scanner
+	s.Init(bytes.NewReader(raw))
+	s.Error = func(s *scanner.Scanner, msg string) {}
+	depth := 0
+	start := -1
+	end := -1
+	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+		if tok == '{' {
+			if depth == 0 {
+				start = s.Position.Offset
+			}
+			depth++
+		}
+		if tok == '}' {
+			depth--
+			if depth == 0 {
+				end = s.Position.Offset + 1
+				break
+			}
+		}
+	}
+	if start == -1 || end == -1 {
+		return nil, ErrUnstructured
+	}
+	slice := raw[start:end]
+	var v interface{}
+	if err := json.Unmarshal(slice, &v); err != nil {
+		return nil, ErrUnstructured
+	}
+	prefix, suffix := split(raw, slice)
+	return &Line{JSON: slice, Prefix: prefix, Suffix: suffix}, nil
+}
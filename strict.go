@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/robfig/jl/structure"
+)
+
+// maxInvalidLines bounds the invalid lines listed by --strict, the others
+// are only counted.
+const maxInvalidLines = 20
+
+// validator counts the lines which aren't JSON entries or which violate
+// the schema with --strict, noting the first ones.
+type validator struct {
+	schema  structure.Schema
+	lines   int
+	invalid int
+	reasons []string
+}
+
+// check checks the next line read, the fields of its entry unless it's a
+// raw line. Empty lines are ignored.
+func (v *validator) check(raw []byte, fields map[string]interface{}, entry bool) {
+	v.lines++
+	var problems []string
+	switch {
+	case !entry && len(strings.TrimSpace(string(raw))) == 0:
+	case !entry:
+		problems = []string{"not JSON"}
+	default:
+		problems = v.schema.Check(fields)
+	}
+	if len(problems) == 0 {
+		return
+	}
+	v.invalid++
+	if len(v.reasons) < maxInvalidLines {
+		v.reasons = append(v.reasons, fmt.Sprintf("line %d: %s", v.lines, strings.Join(problems, ", ")))
+	}
+}
+
+// report writes how many lines were invalid and which ones to w, it
+// reports whether there were any.
+func (v *validator) report(w io.Writer) bool {
+	if v.invalid == 0 {
+		return false
+	}
+	fmt.Fprintf(w, "%d of %d lines invalid\n", v.invalid, v.lines)
+	for _, reason := range v.reasons {
+		fmt.Fprintf(w, "  %s\n", reason)
+	}
+	if more := v.invalid - len(v.reasons); more > 0 {
+		fmt.Fprintf(w, "  and %d more\n", more)
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package structure
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Aggregate is a function computed over the values of a field, ex:
+// avg(duration_ms).
+type Aggregate struct {
+	Func  string
+	Field string
+}
+
+// Aggregation computes the count of entries and aggregates of their fields
+// per group of entries with the same values of the GroupBy fields.
+type Aggregation struct {
+	GroupBy    []string
+	Count      bool
+	Aggregates []Aggregate
+
+	groups map[string]*aggGroup
+	order  []string
+}
+
+type aggGroup struct {
+	values []string
+	count  int
+	stats  []fieldStats
+}
+
+type fieldStats struct {
+	count    int
+	sum      float64
+	min, max float64
+}
+
+// NewAggregation returns an Aggregation grouping by the fields.
+func NewAggregation(groupBy []string, count bool, aggregates []Aggregate) *Aggregation {
+	return &Aggregation{GroupBy: groupBy, Count: count, Aggregates: aggregates, groups: make(map[string]*aggGroup)}
+}
+
+// Add counts the entry in its group, entries missing some of the GroupBy
+// fields are grouped under "".
+func (a *Aggregation) Add(entry *Entry) {
+	values := make([]string, len(a.GroupBy))
+	for i, field := range a.GroupBy {
+		if value, ok := Lookup(entry.Fields, field); ok {
+			values[i] = formatValue(value)
+		}
+	}
+	key := strings.Join(values, "\x00")
+	group, ok := a.groups[key]
+	if !ok {
+		group = &aggGroup{values: values, stats: make([]fieldStats, len(a.Aggregates))}
+		for i := range group.stats {
+			group.stats[i].min, group.stats[i].max = math.Inf(1), math.Inf(-1)
+		}
+		a.groups[key] = group
+		a.order = append(a.order, key)
+	}
+	group.count++
+	for i, aggregate := range a.Aggregates {
+		value, ok := Lookup(entry.Fields, aggregate.Field)
+		if !ok {
+			continue
+		}
+		n, ok := number(value)
+		if !ok {
+			continue
+		}
+		stats := &group.stats[i]
+		stats.count++
+		stats.sum += n
+		stats.min = math.Min(stats.min, n)
+		stats.max = math.Max(stats.max, n)
+	}
+}
+
+// Table returns a row per group, the largest groups first.
+func (a *Aggregation) Table() *Table {
+	t := &Table{Name: "agg", Header: append([]string{}, a.GroupBy...)}
+	if a.Count {
+		t.Header = append(t.Header, "count")
+	}
+	for _, aggregate := range a.Aggregates {
+		t.Header = append(t.Header, fmt.Sprintf("%s(%s)", aggregate.Func, aggregate.Field))
+	}
+	keys := append([]string{}, a.order...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return a.groups[keys[i]].count > a.groups[keys[j]].count
+	})
+	for _, key := range keys {
+		group := a.groups[key]
+		row := append([]string{}, group.values...)
+		if a.Count {
+			row = append(row, fmt.Sprint(group.count))
+		}
+		for i, aggregate := range a.Aggregates {
+			row = append(row, group.stats[i].value(aggregate.Func))
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+// value returns the aggregate, "" when there were no numbers.
+func (s fieldStats) value(function string) string {
+	if s.count == 0 {
+		return ""
+	}
+	switch function {
+	case "sum":
+		return formatNumber(s.sum)
+	case "avg":
+		return formatNumber(s.sum / float64(s.count))
+	case "min":
+		return formatNumber(s.min)
+	case "max":
+		return formatNumber(s.max)
+	}
+	return ""
+}
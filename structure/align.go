@@ -0,0 +1,25 @@
+package structure
+
+// alignWindow is the number of lines a width is remembered for when
+// aligning fields.
+const alignWindow = 20
+
+// recentWidth records the width of a column, the start of the fields or the
+// value of a field, and returns the widest one of the recent lines.
+func (f *Formatter) recentWidth(column string, width int) int {
+	if f.widths == nil {
+		f.widths = make(map[string][]int)
+	}
+	widths := append(f.widths[column], width)
+	if len(widths) > alignWindow {
+		widths = widths[len(widths)-alignWindow:]
+	}
+	f.widths[column] = widths
+	widest := 0
+	for _, w := range widths {
+		if w > widest {
+			widest = w
+		}
+	}
+	return widest
+}
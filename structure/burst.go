@@ -0,0 +1,90 @@
+package structure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+var burstColor = color.New(color.FgHiRed, color.Bold).SprintFunc()
+
+const (
+	// burstHistory is the number of windows the trailing average is
+	// computed over, and burstMinHistory how many it takes at least.
+	burstHistory    = 30
+	burstMinHistory = 3
+	// minBurst is the least number of entries in a window to be a burst,
+	// so quiet streams don't burst on every other entry.
+	minBurst = 10
+)
+
+// BurstDetector detects windows of time in which entries are logged at more
+// than Factor times the trailing average rate, by their timestamps.
+type BurstDetector struct {
+	Window time.Duration
+	Factor float64
+
+	history []int
+	start   time.Time
+	count   int
+	burst   bool
+}
+
+// NewBurstDetector returns a BurstDetector counting entries per window,
+// ex: 10 seconds, bursting at factor times the trailing average.
+func NewBurstDetector(window time.Duration, factor float64) *BurstDetector {
+	return &BurstDetector{Window: window, Factor: factor}
+}
+
+// Add counts an entry logged at ts, returning the markers to show before
+// it when a burst starts or ends.
+func (b *BurstDetector) Add(ts time.Time) []string {
+	var markers []string
+	start := ts.Truncate(b.Window)
+	if !start.Equal(b.start) {
+		if b.burst {
+			markers = append(markers, burstColor(fmt.Sprintf("▼ burst ended: %d entries in %v from %s (%.1f× the average)",
+				b.count, b.Window, b.start.Format("15:04:05"), float64(b.count)/b.average())))
+		}
+		b.finish(start)
+	}
+	b.count++
+	if !b.burst && len(b.history) >= burstMinHistory && b.count >= minBurst && float64(b.count) > b.Factor*b.average() {
+		b.burst = true
+		markers = append(markers, burstColor(fmt.Sprintf("▲ burst: %d entries since %s, more than %.0f× the average of %.1f per %v",
+			b.count, b.start.Format("15:04:05"), b.Factor, b.average(), b.Window)))
+	}
+	return markers
+}
+
+// finish records the count of the window ending and starts the next one,
+// counting the windows without entries in between.
+func (b *BurstDetector) finish(next time.Time) {
+	if !b.start.IsZero() {
+		b.history = append(b.history, b.count)
+		for t := b.start.Add(b.Window); t.Before(next) && len(b.history) < 2*burstHistory; t = t.Add(b.Window) {
+			b.history = append(b.history, 0)
+		}
+		if len(b.history) > burstHistory {
+			b.history = b.history[len(b.history)-burstHistory:]
+		}
+	}
+	b.start = next
+	b.count = 0
+	b.burst = false
+}
+
+// average returns the trailing average number of entries per window, at
+// least 1 so a few entries after silence aren't a burst.
+func (b *BurstDetector) average() float64 {
+	sum := 0
+	for _, count := range b.history {
+		sum += count
+	}
+	average := float64(sum) / float64(len(b.history))
+	if average < 1 {
+		return 1
+	}
+	return average
+}
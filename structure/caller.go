@@ -0,0 +1,114 @@
+package structure
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// caller is the source code location an entry was logged from.
+type caller struct {
+	file string
+	line int
+}
+
+// String returns the location as file:line.
+func (c caller) String() string {
+	if c.line > 0 {
+		return c.file + ":" + strconv.Itoa(c.line)
+	}
+	return c.file
+}
+
+// findCaller looks for the location an entry was logged from in the common
+// fields: "caller" (zap: "pkg/file.go:12"), "source" (slog: an object with
+// "file" and "line"), "file" and "line" (logrus) and ECS's
+// "log.origin.file", after the key given when it isn't empty. The top-level
+// keys it used are returned so they can be left out of the fields.
+func findCaller(fields map[string]interface{}, key string) (caller, []string, bool) {
+	keys := []string{"caller", "source"}
+	if key != "" {
+		keys = append([]string{key}, keys...)
+	}
+	for _, key := range keys {
+		value, _ := Lookup(fields, key)
+		switch value := value.(type) {
+		case string:
+			if c, ok := parseCaller(value); ok {
+				return c, []string{key}, true
+			}
+		case map[string]interface{}:
+			if c, ok := callerFromObject(value, "file", "line"); ok {
+				return c, []string{key}, true
+			}
+		}
+	}
+	if c, ok := callerFromObject(fields, "file", "line"); ok {
+		return c, []string{"file", "line"}, true
+	}
+	if origin, ok := Lookup(fields, "log.origin.file"); ok {
+		if origin, ok := origin.(map[string]interface{}); ok {
+			if c, ok := callerFromObject(origin, "name", "line"); ok {
+				return c, nil, true
+			}
+		}
+	}
+	return caller{}, nil, false
+}
+
+func parseCaller(text string) (caller, bool) {
+	if text == "" || strings.ContainsAny(text, " \n") {
+		return caller{}, false
+	}
+	if i := strings.LastIndexByte(text, ':'); i > 0 {
+		if line, err := strconv.Atoi(text[i+1:]); err == nil {
+			return caller{file: text[:i], line: line}, true
+		}
+	}
+	return caller{file: text}, true
+}
+
+func callerFromObject(object map[string]interface{}, fileKey, lineKey string) (caller, bool) {
+	file, ok := object[fileKey].(string)
+	if !ok || file == "" {
+		return caller{}, false
+	}
+	c := caller{file: file}
+	switch line := object[lineKey].(type) {
+	case float64:
+		c.line = int(line)
+	case string:
+		c.line, _ = strconv.Atoi(line)
+	}
+	return c, true
+}
+
+// callerLink returns the URL a caller links to, using the CallerURL template
+// when set and a file:// URL otherwise.
+func (f *Formatter) callerLink(c caller) string {
+	if f.CallerURL != "" {
+		return strings.NewReplacer("{file}", c.file, "{line}", strconv.Itoa(c.line)).Replace(f.CallerURL)
+	}
+	path, err := filepath.Abs(c.file)
+	if err != nil {
+		path = c.file
+	}
+	link := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return link.String()
+}
+
+// hyperlink wraps text in an OSC 8 escape sequence, which makes it clickable
+// in terminals supporting it.
+func hyperlink(link, text string) string {
+	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s\x1b]8;;\x1b\\", link, text)
+}
+
+func (f *Formatter) formatCaller(c caller) string {
+	text := callerColor("(" + c.String() + ")")
+	if f.CallerLinks {
+		text = hyperlink(f.callerLink(c), text)
+	}
+	return text
+}
@@ -0,0 +1,79 @@
+package structure
+
+import "fmt"
+
+// Chain combines named filters, with AND unless Any is set, in which case
+// entries matching any of them pass. It counts the entries each filter
+// drops, or with Any the entries each filter lets pass, to help debugging
+// a filter setup. Filters are the Stages of a pipeline run in order, which
+// can change the entries too without Any.
+type Chain struct {
+	Any bool
+
+	links []*chainLink
+}
+
+type chainLink struct {
+	name  string
+	stage Stage
+	chain *Chain
+
+	// entries counts the entries reaching the filter, count those it
+	// dropped or let pass.
+	entries int
+	count   int
+}
+
+// Add appends a filter to the chain, the name is what it's reported as,
+// ex: "--level warn".
+func (c *Chain) Add(name string, filter Filter) {
+	c.Use(name, filter.Stage())
+}
+
+// Use appends a stage to the chain, the name is what it's reported as,
+// ex: "--redact password". Stages changing the entries, like enrichers
+// and redactors, belong in chains without Any, where they run until one
+// drops the entry.
+func (c *Chain) Use(name string, stage Stage) {
+	c.links = append(c.links, &chainLink{name: name, stage: stage})
+}
+
+// Nest appends a filter built on the Match of another chain, which is
+// reported beneath it.
+func (c *Chain) Nest(name string, chain *Chain, filter Filter) {
+	c.links = append(c.links, &chainLink{name: name, stage: filter.Stage(), chain: chain})
+}
+
+// Match reports whether the entry passes the chain, it is the Filter of
+// the chain.
+func (c *Chain) Match(entry *Entry) bool {
+	for _, link := range c.links {
+		link.entries++
+		if link.stage(entry, entry.Fields) == c.Any {
+			link.count++
+			return c.Any
+		}
+	}
+	return !c.Any || len(c.links) == 0
+}
+
+// Report lists how many entries each filter dropped, or with Any let pass,
+// ex: "--level warn: dropped 120 of 500" for the entries reaching it.
+func (c *Chain) Report() []string {
+	return c.report("")
+}
+
+func (c *Chain) report(indent string) []string {
+	verb := "dropped"
+	if c.Any {
+		verb = "passed"
+	}
+	var lines []string
+	for _, link := range c.links {
+		lines = append(lines, fmt.Sprintf("%s%s: %s %d of %d", indent, link.name, verb, link.count, link.entries))
+		if link.chain != nil {
+			lines = append(lines, link.chain.report(indent+"  ")...)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,115 @@
+package structure
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// SampleEntries are entries of the usual kinds to render templates with
+// while writing them: with fields, with an error and a caller, with a raw
+// timestamp and with only a message.
+var SampleEntries = []string{
+	`{"time": "2024-05-01T12:00:00Z", "level": "info", "msg": "user created", "user_id": 42, "http": {"method": "POST", "status": 201}, "duration_ms": 12.5}`,
+	`{"time": "2024-05-01T12:00:01.250Z", "level": "error", "msg": "payment failed", "error": "card declined", "caller": "billing/charge.go:88", "request_id": "c0ffee"}`,
+	`{"ts": 1714564802, "severity": "debug", "message": "cache miss", "key": "session:abc"}`,
+	`{"message": "no timestamp nor severity"}`,
+}
+
+// undefinedFunction matches the error of a template calling a function
+// which doesn't exist.
+var undefinedFunction = regexp.MustCompile(`function "([^"]+)" not defined`)
+
+// CheckTemplate returns the problems of a template given to NewFormatter:
+// whether it parses, calls known functions and reads fields of Entry. The
+// fields of the JSON are read with {{field}} and {{get}}, not as .Name.
+func CheckTemplate(text string) []string {
+	f := &Formatter{}
+	tmpl, err := template.New("out").Funcs(f.funcs()).Parse(text)
+	if err != nil {
+		if m := undefinedFunction.FindStringSubmatch(err.Error()); m != nil {
+			var names []string
+			for name := range f.funcs() {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return []string{fmt.Sprintf("unknown function %q, the functions of jl are %s, along with those of Go templates", m[1], strings.Join(names, ", "))}
+		}
+		return []string{err.Error()}
+	}
+	var problems []string
+	entry := reflect.TypeOf(Entry{})
+	for _, name := range entryFields(tmpl.Tree) {
+		if _, ok := entry.FieldByName(name); ok {
+			continue
+		}
+		problem := fmt.Sprintf(`unknown field .%s, the fields of the JSON are read with {{field %q}}`, name, name)
+		for i := 0; i < entry.NumField(); i++ {
+			if known := entry.Field(i).Name; strings.EqualFold(known, name) {
+				problem = fmt.Sprintf("unknown field .%s, did you mean .%s?", name, known)
+			}
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// entryFields returns the names of the fields of the entry a template
+// reads, ex: "Message" for {{.Message}}, in order.
+func entryFields(tree *parse.Tree) []string {
+	var names []string
+	seen := map[string]bool{}
+	var walk func(node parse.Node)
+	walkPipe := func(pipe *parse.PipeNode) {
+		if pipe == nil {
+			return
+		}
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				switch arg := arg.(type) {
+				case *parse.FieldNode:
+					if name := arg.Ident[0]; !seen[name] {
+						seen[name] = true
+						names = append(names, name)
+					}
+				case *parse.PipeNode:
+					walk(arg)
+				}
+			}
+		}
+	}
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, n := range node.Nodes {
+				walk(n)
+			}
+		case *parse.PipeNode:
+			walkPipe(node)
+		case *parse.ActionNode:
+			walkPipe(node.Pipe)
+		case *parse.IfNode:
+			walkPipe(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			// The fields within with are of the value of its pipeline.
+			walkPipe(node.Pipe)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walkPipe(node.Pipe)
+			walk(node.ElseList)
+		}
+	}
+	if tree != nil && tree.Root != nil {
+		walk(tree.Root)
+	}
+	return names
+}
@@ -1,8 +1,25 @@
 package structure
 
-import "github.com/fatih/color"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
 
 var messageColor = color.New(color.FgHiCyan, color.Bold).SprintFunc()
+var elapsedColor = color.New(color.FgHiYellow, color.Bold).SprintFunc()
+var stackErrorColor = color.New(color.FgRed).SprintFunc()
+var stackLibraryColor = color.New(color.FgHiBlack).SprintFunc()
+var stackUserColor = color.New(color.FgHiYellow).SprintFunc()
+
+var callerColor = color.New(color.FgHiBlack).SprintFunc()
+var errorColor = color.New(color.FgRed).SprintFunc()
+var missingColor = color.New(color.FgRed).SprintFunc()
+var repeatColor = color.New(color.FgHiYellow).SprintFunc()
+
 var severityColors = map[string]func(a ...interface{}) string{
 	"TRACE":   color.New(color.FgBlack).SprintFunc(),
 	"DEBUG":   color.New(color.FgHiBlack).SprintFunc(),
@@ -11,3 +28,184 @@ var severityColors = map[string]func(a ...interface{}) string{
 	"ERROR":   color.New(color.FgHiRed, color.Bold).SprintFunc(),
 	"FATAL":   color.New(color.FgHiRed, color.Bold).SprintFunc(),
 }
+
+var colorAttributes = map[string]color.Attribute{
+	"black":     color.FgBlack,
+	"red":       color.FgRed,
+	"green":     color.FgGreen,
+	"yellow":    color.FgYellow,
+	"blue":      color.FgBlue,
+	"magenta":   color.FgMagenta,
+	"cyan":      color.FgCyan,
+	"white":     color.FgWhite,
+	"hiblack":   color.FgHiBlack,
+	"gray":      color.FgHiBlack,
+	"grey":      color.FgHiBlack,
+	"hired":     color.FgHiRed,
+	"higreen":   color.FgHiGreen,
+	"hiyellow":  color.FgHiYellow,
+	"hiblue":    color.FgHiBlue,
+	"himagenta": color.FgHiMagenta,
+	"hicyan":    color.FgHiCyan,
+	"hiwhite":   color.FgHiWhite,
+	"bold":      color.Bold,
+	"dim":       color.Faint,
+	"faint":     color.Faint,
+	"italic":    color.Italic,
+	"underline": color.Underline,
+	"reverse":   color.ReverseVideo,
+}
+
+// ParseColor parses a color specification like "red", "hicyan" or
+// "yellow+bold" into a Color.
+func ParseColor(spec string) (*color.Color, error) {
+	var attrs []color.Attribute
+	for _, name := range strings.Split(spec, "+") {
+		attr, ok := colorAttributes[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown color %q", name)
+		}
+		attrs = append(attrs, attr)
+	}
+	return color.New(attrs...), nil
+}
+
+// ColorRule colors a field, or the whole line when Line is set, when the
+// Condition matches.
+type ColorRule struct {
+	*Condition
+	Color *color.Color
+	Line  bool
+}
+
+// ParseColorRule parses rules like "status>=500:red" and "duration_ms>1000:
+// yellow". A ":line" suffix colors the whole line, ex: "env=prod:bold:line".
+func ParseColorRule(s string) (*ColorRule, error) {
+	rule := &ColorRule{}
+	if strings.HasSuffix(s, ":line") {
+		rule.Line = true
+		s = strings.TrimSuffix(s, ":line")
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid color rule %q, expected <condition>:<color>", s)
+	}
+	var err error
+	rule.Condition, err = ParseCondition(s[:i])
+	if err != nil {
+		return nil, err
+	}
+	rule.Color, err = ParseColor(s[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Repeats renders the counter of an entry collapsed from n consecutive
+// duplicates.
+func Repeats(n int) string {
+	return repeatColor(fmt.Sprintf("×%d", n))
+}
+
+var gapColor = color.New(color.FgYellow).SprintFunc()
+
+// GapMarker renders the line marking a gap of d between two entries.
+func GapMarker(d time.Duration) string {
+	return gapColor(fmt.Sprintf("─── %s gap ───", humanDuration(d)))
+}
+
+// themeColors are the elements of the output whose colors can be set, by
+// the name SetColor takes.
+var themeColors = map[string]*func(a ...interface{}) string{
+	"message":       &messageColor,
+	"elapsed":       &elapsedColor,
+	"caller":        &callerColor,
+	"error-text":    &errorColor,
+	"missing":       &missingColor,
+	"repeat":        &repeatColor,
+	"gap":           &gapColor,
+	"stack.error":   &stackErrorColor,
+	"stack.library": &stackLibraryColor,
+	"stack.user":    &stackUserColor,
+}
+
+// SetColor sets the color of an element of the output, a severity like
+// "warn" or one of "message", "elapsed", "caller", "error-text", "missing",
+// "repeat", "gap", "stack.error", "stack.library" and "stack.user". The
+// spec is parsed by ParseColor.
+func SetColor(element, spec string) error {
+	c, err := ParseColor(spec)
+	if err != nil {
+		return err
+	}
+	if color, ok := themeColors[strings.ToLower(element)]; ok {
+		*color = c.SprintFunc()
+		return nil
+	}
+	severity := NormalizeSeverity(element)
+	if _, ok := severityLevels[severity]; !ok {
+		return fmt.Errorf("unknown element %q", element)
+	}
+	severityColors[severity] = c.SprintFunc()
+	return nil
+}
+
+// defaultThemeColors and defaultSeverityColors are the colors before any
+// is set, which SetColors starts from.
+var (
+	defaultThemeColors    = themeColorFuncs()
+	defaultSeverityColors = copyColors(severityColors)
+)
+
+func themeColorFuncs() map[string]func(a ...interface{}) string {
+	colors := make(map[string]func(a ...interface{}) string, len(themeColors))
+	for element, color := range themeColors {
+		colors[element] = *color
+	}
+	return colors
+}
+
+func copyColors(colors map[string]func(a ...interface{}) string) map[string]func(a ...interface{}) string {
+	copied := make(map[string]func(a ...interface{}) string, len(colors))
+	for element, color := range colors {
+		copied[element] = color
+	}
+	return copied
+}
+
+// SetColors sets the colors of the elements of the output like SetColor,
+// the other elements getting their default colors back. None is set when
+// an element or a spec is invalid.
+func SetColors(colors map[string]string) error {
+	var elements []string
+	for element := range colors {
+		elements = append(elements, element)
+	}
+	sort.Strings(elements)
+	themed := themeColorFuncs()
+	severities := copyColors(defaultSeverityColors)
+	for element := range themed {
+		themed[element] = defaultThemeColors[element]
+	}
+	for _, element := range elements {
+		c, err := ParseColor(colors[element])
+		if err != nil {
+			return fmt.Errorf("invalid color of %s: %v", element, err)
+		}
+		if _, ok := themed[strings.ToLower(element)]; ok {
+			themed[strings.ToLower(element)] = c.SprintFunc()
+			continue
+		}
+		severity := NormalizeSeverity(element)
+		if _, ok := severityLevels[severity]; !ok {
+			return fmt.Errorf("invalid color of %s: unknown element %q", element, element)
+		}
+		severities[severity] = c.SprintFunc()
+	}
+	for element, color := range themed {
+		*themeColors[element] = color
+	}
+	severityColors = severities
+	return nil
+}
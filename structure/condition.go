@@ -0,0 +1,139 @@
+package structure
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var conditionOperators = []string{"==", "!=", ">=", "<=", "!~", "=", ">", "<", "~"}
+
+// Condition is a simple predicate on a field, like "status>=500",
+// "env=prod" or "path~^/api". Values are compared as numbers when both
+// sides are numeric and as strings otherwise. The ~ and !~ operators match
+// a regular expression.
+type Condition struct {
+	Field string
+	Op    string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// ParseCondition parses a condition in the form of <field><op><value>.
+func ParseCondition(s string) (*Condition, error) {
+	i := strings.IndexAny(s, "=!<>~")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid condition %q, expected <field><op><value>", s)
+	}
+	c := &Condition{Field: strings.TrimSpace(s[:i])}
+	for _, op := range conditionOperators {
+		if strings.HasPrefix(s[i:], op) {
+			c.Op = op
+			break
+		}
+	}
+	if c.Op == "" {
+		return nil, fmt.Errorf("invalid operator in condition %q", s)
+	}
+	c.Value = strings.TrimSpace(s[i+len(c.Op):])
+	if c.Op == "==" {
+		c.Op = "="
+	}
+	if c.Op == "~" || c.Op == "!~" {
+		re, err := regexp.Compile(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q: %v", s, err)
+		}
+		c.re = re
+	}
+	return c, nil
+}
+
+// String returns the condition in the form it was parsed from.
+func (c *Condition) String() string {
+	return c.Field + c.Op + c.Value
+}
+
+// Match reports whether the field of the condition, looked up by its dotted
+// path in fields, satisfies the condition. Missing fields only satisfy !=
+// and !~.
+func (c *Condition) Match(fields map[string]interface{}) bool {
+	value, ok := Lookup(fields, c.Field)
+	if !ok {
+		return c.Op == "!=" || c.Op == "!~"
+	}
+	return c.MatchValue(value)
+}
+
+// MatchValue reports whether value satisfies the condition.
+func (c *Condition) MatchValue(value interface{}) bool {
+	text := formatValue(value)
+	switch c.Op {
+	case "~":
+		return c.re.MatchString(text)
+	case "!~":
+		return !c.re.MatchString(text)
+	}
+
+	cmp := strings.Compare(text, c.Value)
+	if a, err := strconv.ParseFloat(text, 64); err == nil {
+		if b, err := strconv.ParseFloat(c.Value, 64); err == nil {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+	} else if c.Op == "=" || c.Op == "!=" {
+		cmp = compareFold(text, c.Value)
+	}
+
+	switch c.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+func compareFold(a, b string) int {
+	if strings.EqualFold(a, b) {
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// Lookup finds the value of a dotted path like "http.request.method" in
+// fields, both nested objects and keys containing dots are supported.
+func Lookup(fields map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := fields[path]; ok {
+		return value, true
+	}
+	for i := strings.IndexByte(path, '.'); i >= 0; {
+		if nested, ok := fields[path[:i]].(map[string]interface{}); ok {
+			if value, ok := Lookup(nested, path[i+1:]); ok {
+				return value, true
+			}
+		}
+		next := strings.IndexByte(path[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, false
+}
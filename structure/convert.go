@@ -0,0 +1,192 @@
+package structure
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConvertFormats are the formats a Converter writes.
+var ConvertFormats = []string{"json", "logfmt", "csv"}
+
+// entryKeys are the keys the timestamp, severity and message of entries are
+// read from when Keys doesn't name them, in order, as in the tags of Entry.
+var entryKeys = [][]string{
+	{"timestamp", "@timestamp", "time", "date", "ts"},
+	{"severity", "level", "log.level"},
+	{"message", "msg", "text"},
+}
+
+// Converter writes entries in a machine format instead of the template:
+// their timestamp, severity and message as "time", "level" and "msg"
+// followed by their other fields, ex: to convert bunyan logs to logfmt.
+type Converter struct {
+	// Keys are the keys the timestamp, severity and message were read
+	// from, over the usual ones, which aren't written again as fields.
+	Keys Keys
+
+	// Columns are the fields written after the timestamp, severity and
+	// message in CSV, those of the first entry when empty.
+	Columns []string
+
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+	header bool
+}
+
+// NewConverter returns a Converter writing to w in format, one of
+// ConvertFormats.
+func NewConverter(w io.Writer, format string) (*Converter, error) {
+	c := &Converter{format: format, w: w}
+	switch format {
+	case "json", "logfmt":
+	case "csv":
+		c.csv = csv.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(ConvertFormats, ", "))
+	}
+	return c, nil
+}
+
+// pair is a key and value written by a Converter, in order.
+type pair struct {
+	key   string
+	value interface{}
+}
+
+// fields returns the fields of entry to write, those read as its
+// timestamp, severity and message first under their common keys.
+func (c *Converter) fields(entry *Entry) []pair {
+	var fields []pair
+	switch {
+	case entry.Timestamp != nil:
+		fields = append(fields, pair{"time", entry.Timestamp.Format(time.RFC3339Nano)})
+	case entry.RawTimestamp != "":
+		fields = append(fields, pair{"time", entry.RawTimestamp})
+	case entry.FloatTimestamp != 0:
+		fields = append(fields, pair{"time", entry.FloatTimestamp})
+	}
+	if entry.Severity != "" {
+		fields = append(fields, pair{"level", strings.ToLower(NormalizeSeverity(entry.Severity))})
+	}
+	fields = append(fields, pair{"msg", entry.Message})
+
+	read := map[string]bool{}
+	for i, key := range []string{c.Keys.Timestamp, c.Keys.Severity, c.Keys.Message} {
+		if _, ok := entry.Fields[key]; ok {
+			read[key] = true
+			continue
+		}
+		for _, key := range entryKeys[i] {
+			if _, ok := entry.Fields[key]; ok {
+				read[key] = true
+				break
+			}
+		}
+	}
+	var keys []string
+	for key := range entry.Fields {
+		if !read[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, pair{key, entry.Fields[key]})
+	}
+	return fields
+}
+
+// Write writes entry, normalized.
+func (c *Converter) Write(entry *Entry) error {
+	fields := c.fields(entry)
+	switch c.format {
+	case "json":
+		var b bytes.Buffer
+		b.WriteByte('{')
+		for i, f := range fields {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := json.Marshal(f.key)
+			b.Write(key)
+			b.WriteByte(':')
+			// The values are written as they are, without escaping HTML.
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(f.value); err != nil {
+				return err
+			}
+			b.Truncate(b.Len() - 1)
+		}
+		b.WriteString("}\n")
+		_, err := c.w.Write(b.Bytes())
+		return err
+	case "logfmt":
+		pairs := make([]string, len(fields))
+		for i, f := range fields {
+			pairs[i] = f.key + "=" + quoteValue(convertedValue(f.value))
+		}
+		_, err := io.WriteString(c.w, strings.Join(pairs, " ")+"\n")
+		return err
+	}
+	if !c.header {
+		c.header = true
+		if len(c.Columns) == 0 {
+			for _, f := range fields {
+				if f.key != "time" && f.key != "level" && f.key != "msg" {
+					c.Columns = append(c.Columns, f.key)
+				}
+			}
+		}
+		if err := c.csv.Write(append([]string{"time", "level", "msg"}, c.Columns...)); err != nil {
+			return err
+		}
+	}
+	values := map[string]interface{}{}
+	for _, f := range fields {
+		values[f.key] = f.value
+	}
+	record := make([]string, 0, len(c.Columns)+3)
+	for _, key := range append([]string{"time", "level", "msg"}, c.Columns...) {
+		if value, ok := values[key]; ok {
+			record = append(record, convertedValue(value))
+		} else if value, ok := Lookup(entry.Fields, key); ok {
+			record = append(record, convertedValue(value))
+		} else {
+			record = append(record, "")
+		}
+	}
+	if err := c.csv.Write(record); err != nil {
+		return err
+	}
+	// Flushing each record lets the conversion of a stream be read as it
+	// goes.
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+// convertedValue returns the text of a value in logfmt and CSV, objects and
+// arrays as JSON.
+func convertedValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
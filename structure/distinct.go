@@ -0,0 +1,97 @@
+package structure
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// hllPrecision is the number of bits of the hashes picking a register,
+// 2^14 registers estimate cardinalities within about 1%.
+const hllPrecision = 14
+
+// Distinct estimates the number of distinct values of a field over a
+// stream with a HyperLogLog, using a fixed amount of memory.
+type Distinct struct {
+	Field string
+
+	registers []uint8
+	exact     map[string]struct{}
+}
+
+// NewDistinct returns a Distinct counting the values of the field, which
+// can be a dotted path.
+func NewDistinct(field string) *Distinct {
+	return &Distinct{Field: field, registers: make([]uint8, 1<<hllPrecision), exact: make(map[string]struct{})}
+}
+
+// Add counts the value of the field of the entry, if it has one.
+func (d *Distinct) Add(entry *Entry) {
+	value, ok := Lookup(entry.Fields, d.Field)
+	if !ok {
+		return
+	}
+	text := formatValue(value)
+	// Small cardinalities are counted exactly, as long as it's cheap.
+	if d.exact != nil {
+		d.exact[text] = struct{}{}
+		if len(d.exact) > 1<<hllPrecision {
+			d.exact = nil
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	hash := mix(h.Sum64())
+	register := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > d.registers[register] {
+		d.registers[register] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values.
+func (d *Distinct) Count() int {
+	if d.exact != nil {
+		return len(d.exact)
+	}
+	m := float64(len(d.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range d.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// String describes the count, ex: "session_id: ~1234 distinct values".
+func (d *Distinct) String() string {
+	approximate := "~"
+	if d.exact != nil {
+		approximate = ""
+	}
+	return fmt.Sprintf("%s: %s%d distinct values", d.Field, approximate, d.Count())
+}
+
+// Table returns the count as a table of a single row.
+func (d *Distinct) Table() *Table {
+	return &Table{Name: "distinct " + d.Field, Header: []string{"field", "distinct"}, Rows: [][]string{{d.Field, strconv.Itoa(d.Count())}}}
+}
+
+// mix finalizes a hash to spread its bits, as FNV's high bits are poorly
+// distributed for short values.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -11,4 +11,21 @@ type Entry struct {
 	Message        string     `djson:"message,msg,text"`
 
 	Name string `djson:"app,name,service.name"`
+
+	// Logger is the name of the logger of the entry read under Keys.Logger,
+	// see LoggerName for the usual keys.
+	Logger string `json:"-"`
+
+	// Fields holds all the keys of the entry, letting templates show any of
+	// them, ex: {{index .Fields "http" "status"}} or {{field "http.status"}}.
+	// It is filled by Format when nil.
+	Fields map[string]interface{} `json:"-"`
+
+	// Repeats counts the consecutive duplicates collapsed into the entry,
+	// shown as ×N when more than one.
+	Repeats int `json:"-"`
+
+	// Source names the input the entry was read from when there are
+	// several, shown first by the default template.
+	Source string `json:"-"`
 }
@@ -0,0 +1,67 @@
+package structure
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrorRate counts the entries and the errors among them over a sliding
+// window of time, in buckets of a second.
+type ErrorRate struct {
+	Window time.Duration
+
+	buckets []rateBucket
+}
+
+type rateBucket struct {
+	second  int64
+	entries int
+	errors  int
+}
+
+// NewErrorRate returns an ErrorRate over the window, ex: a minute.
+func NewErrorRate(window time.Duration) *ErrorRate {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &ErrorRate{Window: window, buckets: make([]rateBucket, seconds)}
+}
+
+// Add counts the entry at now, as an error when it's ERROR or worse.
+func (r *ErrorRate) Add(entry *Entry, now time.Time) {
+	second := now.Unix()
+	bucket := &r.buckets[int(second%int64(len(r.buckets)))]
+	if bucket.second != second {
+		*bucket = rateBucket{second: second}
+	}
+	bucket.entries++
+	if level, ok := SeverityLevel(entry.Severity); ok && level >= severityLevels["ERROR"] {
+		bucket.errors++
+	}
+}
+
+// Counts returns the number of entries and errors within the window before
+// now.
+func (r *ErrorRate) Counts(now time.Time) (entries, errors int) {
+	oldest := now.Unix() - int64(len(r.buckets))
+	for _, bucket := range r.buckets {
+		if bucket.second > oldest && bucket.second <= now.Unix() {
+			entries += bucket.entries
+			errors += bucket.errors
+		}
+	}
+	return entries, errors
+}
+
+// Summary describes the errors within the window before now, ex:
+// "12 errors in the last 1m0s (0.2/s, 3.1% of 390 entries)".
+func (r *ErrorRate) Summary(now time.Time) string {
+	entries, errors := r.Counts(now)
+	share := 0.0
+	if entries > 0 {
+		share = 100 * float64(errors) / float64(entries)
+	}
+	rate := float64(errors) / r.Window.Seconds()
+	return fmt.Sprintf("%d errors in the last %v (%.1f/s, %.1f%% of %d entries)", errors, r.Window, rate, share, entries)
+}
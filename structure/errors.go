@@ -0,0 +1,153 @@
+package structure
+
+import (
+	"strings"
+)
+
+var errorFields = []string{"error", "err"}
+
+// maxCauses limits how deep cause chains are followed.
+const maxCauses = 16
+
+// errorLink is a single error of a chain of wrapped errors.
+type errorLink struct {
+	message string
+	stack   string
+}
+
+// combineError takes the error of an entry out of its fields, to be
+// appended to the message. It returns the chain of errors it wraps, which
+// is read from zap's "errorVerbose", pkg/errors' "%+v" output, "cause"
+// fields and structured errors like {"type", "message", "stack", "cause"}.
+func (f *Formatter) combineError(fields map[string]interface{}) (string, []errorLink) {
+	var text string
+	var chain []errorLink
+	keys := errorFields
+	if f.Keys.Error != "" {
+		keys = append([]string{f.Keys.Error}, keys...)
+	}
+	for _, key := range keys {
+		value, _ := Lookup(fields, key)
+		if message, ok := errorMessage(value); ok {
+			text = message
+			chain = causeChain(value)
+			deleteKey(fields, key)
+			break
+		}
+	}
+	if text == "" {
+		return "", nil
+	}
+	if verbose, ok := fields["errorVerbose"].(string); ok {
+		delete(fields, "errorVerbose")
+		if links := verboseChain(verbose); len(links) > 0 {
+			chain = links
+		}
+	}
+	if cause, ok := fields["cause"]; ok {
+		delete(fields, "cause")
+		chain = append(chain, causeChain(cause)...)
+	}
+	return text, chain
+}
+
+// errorMessage returns the message of an error, which is either a string or
+// an object with a message and optionally a type.
+func errorMessage(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, value != ""
+	case map[string]interface{}:
+		var message, kind string
+		for _, key := range []string{"message", "msg", "error"} {
+			if message, _ = value[key].(string); message != "" {
+				break
+			}
+		}
+		for _, key := range []string{"type", "name", "kind"} {
+			if kind, _ = value[key].(string); kind != "" {
+				break
+			}
+		}
+		switch {
+		case message == "":
+			return kind, kind != ""
+		case kind != "" && !strings.HasPrefix(message, kind):
+			return kind + ": " + message, true
+		}
+		return message, true
+	}
+	return "", false
+}
+
+// causeChain follows the "cause" of structured errors.
+func causeChain(value interface{}) []errorLink {
+	var chain []errorLink
+	for len(chain) < maxCauses {
+		message, ok := errorMessage(value)
+		if !ok {
+			break
+		}
+		chain = append(chain, errorLink{message: message})
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		value = object["cause"]
+	}
+	return chain
+}
+
+// verboseChain parses the "%+v" output of pkg/errors, which prints the root
+// cause with its stack followed by each message wrapping it with theirs.
+// The chain is returned outermost first, with only the stack of the root.
+func verboseChain(verbose string) []errorLink {
+	lines := strings.Split(strings.TrimSpace(verbose), "\n")
+	var chain []errorLink
+	var stack []string
+	for i, line := range lines {
+		frame := strings.HasPrefix(line, "\t") ||
+			(i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t"))
+		switch {
+		case frame && len(chain) == 1:
+			stack = append(stack, line)
+		case !frame:
+			chain = append(chain, errorLink{message: line})
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	chain[0].stack = strings.Join(stack, "\n")
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// renderChain renders the errors wrapped by the first one of the chain as
+// indented "caused by:" lines, followed by the stack of the root cause.
+func (f *Formatter) renderChain(chain []errorLink) string {
+	var out strings.Builder
+	indent := wrapIndent
+	for i, link := range chain {
+		if i > 0 {
+			out.WriteString("\n" + indent + stackLibraryColor("caused by:") + " " + errorColor(link.message))
+			indent += "  "
+		}
+		if link.stack != "" {
+			stack := strings.Replace(link.stack, "\t", "  ", -1)
+			out.WriteString(f.renderStack("\n" + indent + strings.Replace(stack, "\n", "\n"+indent, -1)))
+		}
+	}
+	return out.String()
+}
+
+// appendError appends the error to the already colored message, the
+// message is trimmed of punctuation so they read as "connect failed: EOF".
+func appendError(message, plain, text string) string {
+	if strings.TrimRight(plain, ".: ") == "" {
+		return errorColor(text)
+	}
+	return message + messageColor(":") + " " + errorColor(text)
+}
@@ -0,0 +1,353 @@
+package structure
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseExpression parses a filter expression evaluated against the fields
+// of entries, ex: `level=="error" && (status>=500 || duration_ms>2000)`.
+//
+// Fields are referenced by their dotted path and compared to strings,
+// numbers, true, false, null or other fields with ==, !=, >, >=, <, <=, =~
+// (regexp) and !~. Values are compared as numbers when both sides are
+// numeric and as case-insensitive strings otherwise. A field on its own is
+// true when it's present and not false, null, 0 or "". Conditions combine
+// with &&, || and !, and are grouped with parentheses.
+func ParseExpression(expression string) (Filter, error) {
+	p := &exprParser{input: expression}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEOF {
+		return nil, p.errorf("unexpected %q", p.token.text)
+	}
+	return func(entry *Entry) bool {
+		return truthy(node.eval(entry.Fields))
+	}, nil
+}
+
+type exprNode interface {
+	eval(fields map[string]interface{}) interface{}
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(map[string]interface{}) interface{} {
+	return n.value
+}
+
+type pathNode struct {
+	path string
+}
+
+func (n pathNode) eval(fields map[string]interface{}) interface{} {
+	value, _ := Lookup(fields, n.path)
+	return value
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n notNode) eval(fields map[string]interface{}) interface{} {
+	return !truthy(n.operand.eval(fields))
+}
+
+type logicNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n logicNode) eval(fields map[string]interface{}) interface{} {
+	left := truthy(n.left.eval(fields))
+	if n.op == "&&" {
+		return left && truthy(n.right.eval(fields))
+	}
+	return left || truthy(n.right.eval(fields))
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+	re          *regexp.Regexp
+}
+
+func (n compareNode) eval(fields map[string]interface{}) interface{} {
+	left, right := n.left.eval(fields), n.right.eval(fields)
+	switch n.op {
+	case "=~", "!~":
+		re := n.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(formatValue(right)); err != nil {
+				return false
+			}
+		}
+		matched := left != nil && re.MatchString(formatValue(left))
+		return matched == (n.op == "=~")
+	case "==":
+		return equalValues(left, right)
+	case "!=":
+		return !equalValues(left, right)
+	}
+	if left == nil || right == nil {
+		return false
+	}
+	cmp := compareValues(left, right)
+	switch n.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func equalValues(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return compareValues(a, b) == 0
+}
+
+// compareValues compares numerically when both values are numeric and as
+// case-insensitive strings otherwise.
+func compareValues(a, b interface{}) int {
+	x, y := formatValue(a), formatValue(b)
+	if m, err := strconv.ParseFloat(x, 64); err == nil {
+		if n, err := strconv.ParseFloat(y, 64); err == nil {
+			switch {
+			case m < n:
+				return -1
+			case m > n:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToLower(x), strings.ToLower(y))
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenOperator
+	tokenString
+	tokenNumber
+	tokenIdent
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", ">=", "<=", "=~", "!~", "(", ")", "!", ">", "<"}
+
+type exprParser struct {
+	input string
+	pos   int
+	token exprToken
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid expression at %d: %s", p.token.pos+1, fmt.Sprintf(format, args...))
+}
+
+// next reads the next token of the input.
+func (p *exprParser) next() error {
+	for p.pos < len(p.input) && strings.IndexByte(" \t\r\n", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	p.token = exprToken{pos: start}
+	if p.pos >= len(p.input) {
+		p.token.kind = tokenEOF
+		return nil
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '"' || c == '\'':
+		end := stringEnd(p.input, p.pos, c)
+		if end > len(p.input) || end-start < 2 || p.input[end-1] != c {
+			return p.errorf("unterminated string")
+		}
+		text := p.input[start:end]
+		if c == '\'' {
+			// Single quoted strings are raw, which suits regexps, and
+			// contain quotes doubled like in SQL.
+			text = strconv.Quote(strings.ReplaceAll(text[1:len(text)-1], "''", "'"))
+		}
+		unquoted, err := strconv.Unquote(text)
+		if err != nil {
+			return p.errorf("invalid string %s", p.input[start:end])
+		}
+		p.token.kind, p.token.text, p.pos = tokenString, unquoted, end
+		return nil
+	case c == '-' || isDigit(c):
+		end := p.pos + 1
+		for end < len(p.input) && strings.IndexByte("0123456789.eE", p.input[end]) >= 0 {
+			end++
+		}
+		p.token.kind, p.token.text, p.pos = tokenNumber, p.input[start:end], end
+		return nil
+	case isWordStart(c) || c == '@':
+		end := p.pos + 1
+		for end < len(p.input) && (isWordStart(p.input[end]) || isDigit(p.input[end]) || strings.IndexByte(".@-", p.input[end]) >= 0) {
+			end++
+		}
+		p.token.kind, p.token.text, p.pos = tokenIdent, p.input[start:end], end
+		return nil
+	}
+	for _, op := range exprOperators {
+		if strings.HasPrefix(p.input[p.pos:], op) {
+			p.token.kind, p.token.text = tokenOperator, op
+			p.pos += len(op)
+			return nil
+		}
+	}
+	return p.errorf("unexpected %q", c)
+}
+
+func (p *exprParser) isOperator(ops ...string) bool {
+	if p.token.kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if p.token.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.isOperator("||") {
+		var right exprNode
+		if err = p.next(); err != nil {
+			break
+		}
+		if right, err = p.parseAnd(); err == nil {
+			left = logicNode{op: "||", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	for err == nil && p.isOperator("&&") {
+		var right exprNode
+		if err = p.next(); err != nil {
+			break
+		}
+		if right, err = p.parseNot(); err == nil {
+			left = logicNode{op: "&&", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.isOperator("!") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot()
+		return notNode{operand: operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil || !p.isOperator("==", "!=", ">=", "<=", ">", "<", "=~", "!~") {
+		return left, err
+	}
+	node := compareNode{op: p.token.text, left: left}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	pos := p.token.pos
+	if node.right, err = p.parseOperand(); err != nil {
+		return nil, err
+	}
+	if literal, ok := node.right.(literalNode); ok && (node.op == "=~" || node.op == "!~") {
+		node.re, err = regexp.Compile(formatValue(literal.value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression at %d: %v", pos+1, err)
+		}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	token := p.token
+	switch token.kind {
+	case tokenString:
+		return literalNode{value: token.text}, p.next()
+	case tokenNumber:
+		n, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", token.text)
+		}
+		return literalNode{value: n}, p.next()
+	case tokenIdent:
+		switch token.text {
+		case "true":
+			return literalNode{value: true}, p.next()
+		case "false":
+			return literalNode{value: false}, p.next()
+		case "null":
+			return literalNode{value: nil}, p.next()
+		}
+		return pathNode{path: token.text}, p.next()
+	case tokenOperator:
+		if token.text == "(" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOperator(")") {
+				return nil, p.errorf("expected )")
+			}
+			return node, p.next()
+		}
+	case tokenEOF:
+		return nil, p.errorf("unexpected end")
+	}
+	return nil, p.errorf("unexpected %q", token.text)
+}
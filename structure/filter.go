@@ -0,0 +1,226 @@
+package structure
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Filter reports whether a normalized entry is shown.
+type Filter func(entry *Entry) bool
+
+// All returns a Filter matching entries matched by all of the filters.
+func All(filters ...Filter) Filter {
+	return func(entry *Entry) bool {
+		for _, filter := range filters {
+			if !filter(entry) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any returns a Filter matching entries matched by any of the filters.
+func Any(filters ...Filter) Filter {
+	return func(entry *Entry) bool {
+		for _, filter := range filters {
+			if filter(entry) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a Filter matching the entries filter doesn't match.
+func Not(filter Filter) Filter {
+	return func(entry *Entry) bool {
+		return !filter(entry)
+	}
+}
+
+// MinSeverity returns a Filter hiding entries less severe than severity.
+// Entries without a known severity are shown.
+func MinSeverity(severity string) (Filter, error) {
+	min, ok := SeverityLevel(severity)
+	if !ok {
+		return nil, fmt.Errorf("unknown severity %q", severity)
+	}
+	return func(entry *Entry) bool {
+		level, ok := SeverityLevel(entry.Severity)
+		return !ok || level >= min
+	}, nil
+}
+
+// Errors returns a Filter showing only entries with a severity of ERROR or
+// worse, entries without a known severity are hidden.
+func Errors() Filter {
+	min := severityLevels["ERROR"]
+	return func(entry *Entry) bool {
+		level, ok := SeverityLevel(entry.Severity)
+		return ok && level >= min
+	}
+}
+
+// OnlySeverities returns a Filter showing only entries of these severities,
+// which don't have to be known ones.
+func OnlySeverities(severities []string) Filter {
+	set := severitySet(severities)
+	return func(entry *Entry) bool {
+		return set[NormalizeSeverity(entry.Severity)]
+	}
+}
+
+// ExceptSeverities returns a Filter hiding entries of these severities.
+func ExceptSeverities(severities []string) Filter {
+	set := severitySet(severities)
+	return func(entry *Entry) bool {
+		return !set[NormalizeSeverity(entry.Severity)]
+	}
+}
+
+func severitySet(severities []string) map[string]bool {
+	set := make(map[string]bool, len(severities))
+	for _, severity := range severities {
+		set[NormalizeSeverity(strings.TrimSpace(severity))] = true
+	}
+	return set
+}
+
+// Where returns a Filter showing entries of which the fields satisfy the
+// condition, ex: "status>=500".
+func Where(condition *Condition) Filter {
+	return func(entry *Entry) bool {
+		return condition.Match(entry.Fields)
+	}
+}
+
+// Grep returns a Filter showing entries of which the message matches re.
+// With fields, entries of which any field matches as key=value are shown
+// too.
+func Grep(re *regexp.Regexp, fields bool) Filter {
+	return func(entry *Entry) bool {
+		if re.MatchString(entry.Message) {
+			return true
+		}
+		return fields && matchFields(re, entry.Fields, "")
+	}
+}
+
+func matchFields(re *regexp.Regexp, fields map[string]interface{}, path string) bool {
+	for key, value := range fields {
+		if path != "" {
+			key = path + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			if matchFields(re, nested, key) {
+				return true
+			}
+		} else if re.MatchString(key + "=" + formatValue(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// loggerKeys are the fields holding the name of the logger of an entry.
+var loggerKeys = []string{"logger", "logger_name", "loggerName", "log.logger", "category", "name"}
+
+// Logger returns a Filter showing entries of loggers matching any of the
+// patterns hierarchically, like log4j does: "com.acme" and "com.acme.*"
+// both match "com.acme" and all loggers beneath it, such as
+// "com.acme.payment.Gateway". Segments can be globs, ex: "com.*.payment".
+func Logger(patterns []string) Filter {
+	var hierarchies [][]string
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), ".*")
+		if pattern != "" {
+			hierarchies = append(hierarchies, strings.Split(pattern, "."))
+		}
+	}
+	return func(entry *Entry) bool {
+		name, ok := entry.LoggerName()
+		if !ok {
+			return false
+		}
+		segments := strings.Split(name, ".")
+		for _, hierarchy := range hierarchies {
+			if beneath(segments, hierarchy) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// LoggerName returns the name of the logger of an entry, ex:
+// "com.acme.payment.Gateway".
+func LoggerName(fields map[string]interface{}) (string, bool) {
+	for _, key := range loggerKeys {
+		if value, ok := Lookup(fields, key); ok {
+			if name, ok := value.(string); ok && name != "" {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// LoggerName returns the name of the logger of the entry, the one read
+// under Keys.Logger or else under the usual keys.
+func (e *Entry) LoggerName() (string, bool) {
+	if e.Logger != "" {
+		return e.Logger, true
+	}
+	return LoggerName(e.Fields)
+}
+
+// beneath reports whether the logger segments are those of hierarchy or of
+// one of its descendants.
+func beneath(segments, hierarchy []string) bool {
+	if len(segments) < len(hierarchy) {
+		return false
+	}
+	for i, pattern := range hierarchy {
+		if ok, err := path.Match(pattern, segments[i]); !ok && (err == nil || pattern != segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TimeRange returns a Filter showing entries logged from since up to until,
+// either of which can be zero for an open range. Entries without a
+// timestamp are shown.
+func TimeRange(since, until time.Time) Filter {
+	return func(entry *Entry) bool {
+		if entry.Timestamp == nil {
+			return true
+		}
+		if !since.IsZero() && entry.Timestamp.Before(since) {
+			return false
+		}
+		return until.IsZero() || !entry.Timestamp.After(until)
+	}
+}
+
+// Sample returns a Filter showing a random fraction of the entries, using
+// random to draw numbers in [0, 1).
+func Sample(fraction float64, random func() float64) Filter {
+	return func(entry *Entry) bool {
+		return random() < fraction
+	}
+}
+
+// Every returns a Filter showing every nth entry: the nth, the 2nth and so
+// on.
+func Every(n int) Filter {
+	count := 0
+	return func(entry *Entry) bool {
+		count++
+		return count%n == 0
+	}
+}
@@ -0,0 +1,599 @@
+package structure_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/robfig/jl/structure"
+)
+
+// filtered returns the messages of the loglines matched by filter.
+func filtered(t *testing.T, filter structure.Filter, loglines ...string) []string {
+	t.Helper()
+	formatter, err := structure.NewFormatter(nil)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	var messages []string
+	for _, logline := range loglines {
+		var entry structure.Entry
+		_ = json.Unmarshal([]byte(logline), &entry)
+		formatter.Normalize(&entry, []byte(logline))
+		if filter(&entry) {
+			messages = append(messages, entry.Message)
+		}
+	}
+	return messages
+}
+
+func expectMessages(t *testing.T, got []string, expect ...string) {
+	t.Helper()
+	if len(got) != len(expect) {
+		t.Fatalf("\n\tnot match: %q\n\t   expect: %q\n", got, expect)
+	}
+	for i := range got {
+		if got[i] != expect[i] {
+			t.Fatalf("\n\tnot match: %q\n\t   expect: %q\n", got, expect)
+		}
+	}
+}
+
+func TestMinSeverity(t *testing.T) {
+	t.Parallel()
+
+	filter, err := structure.MinSeverity("warn")
+	if err != nil {
+		t.Fatalf("failed to create filter: %v", err)
+	}
+	got := filtered(t, filter,
+		`{"message": "a", "severity": "info"}`,
+		`{"message": "b", "severity": "WARN"}`,
+		`{"message": "c", "severity": "50"}`,
+		`{"message": "d", "severity": "debug"}`,
+		`{"message": "e"}`,
+	)
+	expectMessages(t, got, "b", "c", "e")
+
+	if _, err := structure.MinSeverity("loud"); err == nil {
+		t.Errorf("expected an error for an unknown severity")
+	}
+}
+
+func TestSeveritySets(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "a", "severity": "info"}`,
+		`{"message": "b", "severity": "WARN"}`,
+		`{"message": "c", "severity": "50"}`,
+		`{"message": "d", "severity": "audit"}`,
+		`{"message": "e"}`,
+	}
+	got := filtered(t, structure.OnlySeverities([]string{"error", " warning", "audit"}), loglines...)
+	expectMessages(t, got, "b", "c", "d")
+
+	got = filtered(t, structure.ExceptSeverities([]string{"info", "warn"}), loglines...)
+	expectMessages(t, got, "c", "d", "e")
+}
+
+func TestWhere(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "a", "status": 200, "env": "prod", "http": {"method": "GET"}}`,
+		`{"message": "b", "status": 503, "env": "prod", "http": {"method": "POST"}}`,
+		`{"message": "c", "status": 500, "env": "dev", "http": {"method": "GET"}}`,
+	}
+	status, _ := structure.ParseCondition("status>=500")
+	env, _ := structure.ParseCondition("env=prod")
+	method, _ := structure.ParseCondition("http.method!=post")
+
+	got := filtered(t, structure.All(structure.Where(status), structure.Where(env)), loglines...)
+	expectMessages(t, got, "b")
+
+	got = filtered(t, structure.Where(method), loglines...)
+	expectMessages(t, got, "a", "c")
+}
+
+func TestParseExpression(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "a", "level": "error", "status": 503, "duration_ms": 12}`,
+		`{"message": "b", "level": "ERROR", "status": 200, "duration_ms": 2500}`,
+		`{"message": "c", "level": "info", "status": 500, "duration_ms": 3000, "http": {"path": "/api/users"}}`,
+		`{"message": "d", "level": "error", "status": 200, "cached": true}`,
+	}
+	tests := []struct {
+		expression string
+		expect     []string
+	}{
+		{`level=="error" && (status>=500 || duration_ms>2000)`, []string{"a", "b"}},
+		{`!(level == 'error')`, []string{"c"}},
+		{`http.path =~ '^/api/\w+$'`, []string{"c"}},
+		{`cached || status < 300 && duration_ms > 2000`, []string{"b", "d"}},
+		{`http != null`, []string{"c"}},
+	}
+	for _, test := range tests {
+		filter, err := structure.ParseExpression(test.expression)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", test.expression, err)
+		}
+		got := filtered(t, filter, loglines...)
+		expectMessages(t, got, test.expect...)
+	}
+
+	for _, invalid := range []string{`status >`, `(a == 1`, `a == "b`, `a =~ "("`, `a b`} {
+		if _, err := structure.ParseExpression(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestGrep(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "GET /health", "status": 200}`,
+		`{"message": "user logged in", "user": {"name": "bob"}}`,
+		`{"message": "timeout"}`,
+	}
+	re := regexp.MustCompile(`(?i)health|timeout|name=bob`)
+
+	got := filtered(t, structure.Grep(re, false), loglines...)
+	expectMessages(t, got, "GET /health", "timeout")
+
+	got = filtered(t, structure.Grep(re, true), loglines...)
+	expectMessages(t, got, "GET /health", "user logged in", "timeout")
+
+	got = filtered(t, structure.Not(structure.Grep(re, false)), loglines...)
+	expectMessages(t, got, "user logged in")
+}
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "charged", "logger": "com.acme.payment.Gateway"}`,
+		`{"message": "refunded", "logger_name": "com.acme.payment"}`,
+		`{"message": "similar", "logger": "com.acme.payments.Gateway"}`,
+		`{"message": "shipped", "log": {"logger": "com.acme.shipping"}}`,
+		`{"message": "anonymous"}`,
+	}
+
+	got := filtered(t, structure.Logger([]string{"com.acme.payment.*"}), loglines...)
+	expectMessages(t, got, "charged", "refunded")
+
+	got = filtered(t, structure.Logger([]string{"com.*.shipping", "com.acme.payments"}), loglines...)
+	expectMessages(t, got, "similar", "shipped")
+}
+
+func TestTimeRange(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	since, err := structure.ParseTimeBound("45m", now, nil)
+	if err != nil {
+		t.Fatalf("failed to parse bound: %v", err)
+	}
+	until, err := structure.ParseTimeBound("2024-05-01 12:15", now, nil)
+	if err != nil {
+		t.Fatalf("failed to parse bound: %v", err)
+	}
+	got := filtered(t, structure.TimeRange(since, until),
+		`{"message": "a", "timestamp": "2024-05-01T11:40:00Z"}`,
+		`{"message": "b", "timestamp": "2024-05-01T11:50:00Z"}`,
+		`{"message": "c", "timestamp": "2024-05-01T14:10:00+02:00"}`,
+		`{"message": "d", "timestamp": "2024-05-01T12:20:00Z"}`,
+		`{"message": "e"}`,
+	)
+	expectMessages(t, got, "b", "c", "e")
+
+	if _, err := structure.ParseTimeBound("yesterday", now, nil); err == nil {
+		t.Errorf("expected an error for an invalid bound")
+	}
+	if week, _ := structure.ParseTimeBound("7d", now, nil); !week.Equal(now.AddDate(0, 0, -7)) {
+		t.Errorf("expected 7d to be a week ago, got %v", week)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "a"}`, `{"message": "b"}`, `{"message": "c"}`,
+		`{"message": "d"}`, `{"message": "e"}`,
+	}
+	got := filtered(t, structure.Every(2), loglines...)
+	expectMessages(t, got, "b", "d")
+
+	draws := []float64{0.5, 0.01, 0.9, 0.2, 0.05}
+	random := func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	}
+	got = filtered(t, structure.Sample(0.1, random), loglines...)
+	expectMessages(t, got, "b", "e")
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := structure.ParseRate("2/s")
+	if err != nil {
+		t.Fatalf("failed to parse rate: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	severities := []string{"info", "info", "error", "info", "", "error"}
+	var allowed []bool
+	for _, severity := range severities {
+		allowed = append(allowed, limiter.Allow(&structure.Entry{Severity: severity}, now))
+		now = now.Add(100 * time.Millisecond)
+	}
+	expect := []bool{true, true, false, false, false, false}
+	for i := range expect {
+		if allowed[i] != expect[i] {
+			t.Fatalf("not match: %v, expect: %v", allowed, expect)
+		}
+	}
+	summary := limiter.Summary()
+	if summary != "suppressed 4 lines (2 ERROR, 1 INFO, 1 other)" {
+		t.Errorf("unexpected summary: %q", summary)
+	}
+	if limiter.Summary() != "" {
+		t.Errorf("expected the summary to be reset")
+	}
+	if !limiter.Allow(&structure.Entry{}, now.Add(time.Second)) {
+		t.Errorf("expected the next period to be allowed")
+	}
+
+	if _, err := structure.ParseRate("fast"); err == nil {
+		t.Errorf("expected an error for an invalid rate")
+	}
+}
+
+func TestFollow(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "request started", "request_id": "a1", "trace_id": "t1"}`,
+		`{"message": "other request", "request_id": "b2"}`,
+		`{"message": "payment failed", "severity": "ERROR", "trace_id": "t1"}`,
+		`{"message": "retrying", "requestId": "a1"}`,
+		`{"message": "done", "request_id": "b2"}`,
+	}
+	condition, err := structure.ParseCondition("severity=ERROR")
+	if err != nil {
+		t.Fatalf("failed to parse condition: %v", err)
+	}
+
+	got := filtered(t, structure.Follow(structure.Where(condition), structure.CorrelationKeys), loglines...)
+	expectMessages(t, got, "payment failed")
+
+	condition, err = structure.ParseCondition("request_id=a1")
+	if err != nil {
+		t.Fatalf("failed to parse condition: %v", err)
+	}
+	got = filtered(t, structure.Follow(structure.Where(condition), structure.CorrelationKeys), loglines...)
+	expectMessages(t, got, "request started", "payment failed", "retrying")
+}
+
+func TestCorrelationID(t *testing.T) {
+	color.NoColor = true
+	fields := map[string]interface{}{"requestId": "r1", "trace": map[string]interface{}{"id": "t1"}}
+	id, ok := structure.CorrelationID(fields, structure.CorrelationKeys)
+	if !ok || id != "t1" {
+		t.Errorf("expected trace ID t1, got %q", id)
+	}
+	if header := structure.GroupHeader(id, 3, 1250*time.Millisecond); header != "▶ t1 (3 entries in 1.3s)" {
+		t.Errorf("unexpected header %q", header)
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "a", "severity": "ERROR"}`,
+		`{"message": "b", "severity": "INFO", "status": 503}`,
+		`{"message": "c", "severity": "INFO", "status": 200}`,
+	}
+	status, err := structure.ParseCondition("status>=500")
+	if err != nil {
+		t.Fatalf("failed to parse condition: %v", err)
+	}
+	level, err := structure.MinSeverity("error")
+	if err != nil {
+		t.Fatalf("failed to create filter: %v", err)
+	}
+
+	chain := &structure.Chain{}
+	chain.Add("--level error", level)
+	chain.Add("--where status>=500", structure.Where(status))
+	got := filtered(t, chain.Match, loglines...)
+	expectMessages(t, got)
+	expectMessages(t, chain.Report(), "--level error: dropped 2 of 3", "--where status>=500: dropped 1 of 1")
+
+	chain = &structure.Chain{Any: true}
+	chain.Add("--level error", level)
+	chain.Add("--where status>=500", structure.Where(status))
+	got = filtered(t, chain.Match, loglines...)
+	expectMessages(t, got, "a", "b")
+	expectMessages(t, chain.Report(), "--level error: passed 1 of 3", "--where status>=500: passed 1 of 2")
+}
+
+func TestStages(t *testing.T) {
+	t.Parallel()
+
+	formatter, err := structure.NewFormatter(nil)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	logline := []byte(`{"message": "login", "password": "hunter2", "request": {"token": "abc"}}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	formatter.Normalize(&entry, logline)
+
+	chain := &structure.Chain{}
+	chain.Use("--redact", structure.Redact("password", "request.token", "missing"))
+	chain.Use("region", func(entry *structure.Entry, fields map[string]interface{}) bool {
+		fields["region"] = "eu"
+		return true
+	})
+	chain.Add("--where region=us", structure.Where(&structure.Condition{Field: "region", Op: "=", Value: "us"}))
+	if chain.Match(&entry) {
+		t.Errorf("expected the entry to be dropped")
+	}
+	expectMessages(t, chain.Report(), "--redact: dropped 0 of 1", "region: dropped 0 of 1", "--where region=us: dropped 1 of 1")
+
+	b, _ := json.Marshal(entry.Fields)
+	expect := `{"message":"login","password":"[REDACTED]","region":"eu","request":{"token":"[REDACTED]"}}`
+	if string(b) != expect {
+		t.Errorf("\n\tnot match: %s\n\t   expect: %s\n", b, expect)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+
+	h := structure.NewHistogram(time.Minute)
+	for _, logline := range []string{
+		`{"message": "a", "severity": "INFO", "timestamp": "2024-05-01T12:00:10Z"}`,
+		`{"message": "b", "severity": "INFO", "timestamp": "2024-05-01T12:00:50Z"}`,
+		`{"message": "c", "severity": "ERROR", "timestamp": "2024-05-01T12:02:00Z"}`,
+		`{"message": "d", "severity": "INFO", "timestamp": "2024-05-01T12:03:30Z"}`,
+		`{"message": "e", "severity": "INFO"}`,
+	} {
+		var entry structure.Entry
+		if err := json.Unmarshal([]byte(logline), &entry); err != nil {
+			t.Fatalf("failed to unmarshal entry: %v", err)
+		}
+		h.Add(&entry)
+	}
+	expectMessages(t, h.Lines(time.UTC),
+		"ERROR       █  1",
+		"INFO      █  ▄ 3",
+		"          2024-05-01 12:00 → 2024-05-01 12:03, 1m0s per bar")
+}
+
+func TestTop(t *testing.T) {
+	t.Parallel()
+
+	top := structure.NewTop([]string{"user", "http.path"})
+	for _, logline := range []string{
+		`{"message": "a", "user": "bob", "http": {"path": "/"}}`,
+		`{"message": "b", "user": "alice"}`,
+		`{"message": "c", "user": "bob", "http": {"path": "/api"}}`,
+		`{"message": "d", "user": "carol smith"}`,
+	} {
+		var entry structure.Entry
+		if err := json.Unmarshal([]byte(logline), &entry); err != nil {
+			t.Fatalf("failed to unmarshal entry: %v", err)
+		}
+		entry.Fields = make(map[string]interface{})
+		_ = json.Unmarshal([]byte(logline), &entry.Fields)
+		top.Add(&entry)
+	}
+	expectMessages(t, top.Table(2),
+		"user (4 entries, 3 distinct):",
+		"   1.        2  50.0%  bob",
+		"   2.        1  25.0%  alice",
+		"http.path (2 entries, 2 distinct):",
+		"   1.        1  50.0%  /",
+		"   2.        1  50.0%  /api")
+}
+
+func TestPercentiles(t *testing.T) {
+	t.Parallel()
+
+	percentiles := structure.NewPercentiles("duration_ms", "")
+	for i := 1; i <= 1000; i++ {
+		entry := structure.Entry{Fields: map[string]interface{}{"duration_ms": float64(i)}}
+		percentiles.Add(&entry)
+	}
+	percentiles.Add(&structure.Entry{Fields: map[string]interface{}{"duration_ms": "fast"}})
+	expectMessages(t, percentiles.Lines(), "duration_ms: n=1000 p50=498 p90=907 p99=983 max=1000")
+}
+
+func TestErrorRate(t *testing.T) {
+	t.Parallel()
+
+	rate := structure.NewErrorRate(10 * time.Second)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rate.Add(&structure.Entry{Severity: "ERROR"}, start)
+	for i := 0; i < 4; i++ {
+		rate.Add(&structure.Entry{Severity: "INFO"}, start.Add(5*time.Second))
+	}
+	rate.Add(&structure.Entry{Severity: "fatal"}, start.Add(12*time.Second))
+
+	expectMessages(t, []string{rate.Summary(start.Add(12 * time.Second))},
+		"1 errors in the last 10s (0.1/s, 20.0% of 5 entries)")
+}
+
+func TestSummary(t *testing.T) {
+	t.Parallel()
+
+	summary := structure.NewSummary()
+	for _, logline := range []string{
+		`{"message": "started", "severity": "INFO", "timestamp": "2024-05-01T12:00:00Z"}`,
+		`{"message": "user 42 not found", "severity": "ERROR", "timestamp": "2024-05-01T12:01:00Z"}`,
+		`{"message": "user 7 not found", "severity": "ERROR", "timestamp": "2024-05-01T12:00:30Z"}`,
+	} {
+		var entry structure.Entry
+		if err := json.Unmarshal([]byte(logline), &entry); err != nil {
+			t.Fatalf("failed to unmarshal entry: %v", err)
+		}
+		summary.Add(&entry)
+	}
+	summary.AddRaw(false)
+	summary.AddRaw(true)
+
+	expectMessages(t, summary.Text(),
+		"lines read:     5",
+		"entries:        3",
+		"non-JSON lines: 1",
+		"parse failures: 1",
+		"severities:     2 ERROR, 1 INFO",
+		"time span:      2024-05-01T12:00:00Z → 2024-05-01T12:01:00Z (1m0s)",
+		"top errors:",
+		"       2  user <n> not found")
+}
+
+func TestDistinct(t *testing.T) {
+	t.Parallel()
+
+	distinct := structure.NewDistinct("user")
+	for i := 0; i < 100000; i++ {
+		distinct.Add(&structure.Entry{Fields: map[string]interface{}{"user": float64(i % 50000)}})
+		if i == 10 {
+			expectMessages(t, []string{distinct.String()}, "user: 11 distinct values")
+		}
+	}
+	if count := distinct.Count(); count < 48500 || count > 51500 {
+		t.Errorf("expected about 50000 distinct values, got %d", count)
+	}
+}
+
+func TestBurstDetector(t *testing.T) {
+	color.NoColor = true
+
+	bursts := structure.NewBurstDetector(10*time.Second, 5)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var markers []string
+	for s := 0; s < 60; s += 5 {
+		markers = append(markers, bursts.Add(start.Add(time.Duration(s)*time.Second))...)
+	}
+	for i := 0; i < 30; i++ {
+		markers = append(markers, bursts.Add(start.Add(time.Minute+time.Duration(i)*100*time.Millisecond))...)
+	}
+	markers = append(markers, bursts.Add(start.Add(80*time.Second))...)
+	expectMessages(t, markers,
+		"▲ burst: 11 entries since 12:01:00, more than 5× the average of 2.0 per 10s",
+		"▼ burst ended: 30 entries in 10s from 12:01:00 (15.0× the average)")
+}
+
+func TestAggregation(t *testing.T) {
+	t.Parallel()
+
+	agg := structure.NewAggregation([]string{"status"}, true, []structure.Aggregate{
+		{Func: "avg", Field: "duration_ms"},
+		{Func: "max", Field: "duration_ms"},
+	})
+	for _, fields := range []map[string]interface{}{
+		{"status": float64(200), "duration_ms": float64(10)},
+		{"status": float64(500), "duration_ms": float64(1500)},
+		{"status": float64(200), "duration_ms": float64(15)},
+		{"status": float64(200)},
+	} {
+		agg.Add(&structure.Entry{Fields: fields})
+	}
+	expectMessages(t, agg.Table().Lines(),
+		"status  count  avg(duration_ms)  max(duration_ms)",
+		"   200      3              12.5                15",
+		"   500      1              1500              1500")
+}
+
+func TestTableExport(t *testing.T) {
+	t.Parallel()
+
+	table := &structure.Table{
+		Name:   "top user",
+		Header: []string{"user", "count"},
+		Rows:   [][]string{{"bob, jr", "3"}, {"42", "1"}, {"NaN", "1"}},
+	}
+	var csv strings.Builder
+	if err := table.CSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, strings.Split(csv.String(), "\n"),
+		"user,count", `"bob, jr",3`, "42,1", "NaN,1", "")
+	b, err := json.Marshal(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"name":"top user","rows":[{"user":"bob, jr","count":3},{"user":42,"count":1},{"user":"NaN","count":1}]}`
+	if string(b) != expect {
+		t.Errorf("expected %s, got %s", expect, b)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "GET /healthcheck", "severity": "info", "status": 200}`,
+		`{"message": "slow request", "severity": "warn", "status": 200, "path": "/Orders"}`,
+		`{"message": "request failed", "severity": "error", "status": 502}`,
+	}
+	for query, expect := range map[string][]string{
+		"":                        {"GET /healthcheck", "slow request", "request failed"},
+		"level:warn":              {"slow request", "request failed"},
+		"status>=500":             {"request failed"},
+		"request -failed":         {"slow request"},
+		"orders":                  {"slow request"},
+		"-healthcheck status=200": {"slow request"},
+	} {
+		filter, err := structure.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		expectMessages(t, filtered(t, filter, loglines...), expect...)
+	}
+	for _, query := range []string{"level:loud", "path~(", "(unclosed"} {
+		if _, err := structure.ParseQuery(query); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	schema, err := structure.ParseSchema("message,http.status:number,tags:array")
+	if err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	for logline, expect := range map[string]string{
+		`{"message": "ok", "http": {"status": 200}, "tags": []}`:   "",
+		`{"message": "ok", "http": {"status": "200"}, "tags": []}`: `"http.status" is string, expected number`,
+		`{"http": {"status": 200}}`:                                `missing "message", missing "tags"`,
+	} {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(logline), &fields); err != nil {
+			t.Fatal(err)
+		}
+		if violations := strings.Join(schema.Check(fields), ", "); violations != expect {
+			t.Errorf("%s\n\tnot match: %q\n\t   expect: %q\n", logline, violations, expect)
+		}
+	}
+	for _, spec := range []string{"message:text", "status:number,"} {
+		if _, err := structure.ParseSchema(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
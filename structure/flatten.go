@@ -0,0 +1,70 @@
+package structure
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Collision selects what happens when a key of a flattened envelope, like
+// "labels", already exists at the top level.
+type Collision int
+
+const (
+	// CollisionPrefix keeps both, showing the key of the envelope with its
+	// name as prefix, ex: "labels.env". This is the default.
+	CollisionPrefix Collision = iota
+	// CollisionOverwrite replaces the top level key with the one of the
+	// envelope.
+	CollisionOverwrite
+	// CollisionWarn works like CollisionPrefix and also writes a warning to
+	// the Warnings writer the first time a key collides.
+	CollisionWarn
+)
+
+var defaultFlattenFields = []string{"labels"}
+
+// flatten moves the keys of the FlattenFields envelopes to the top level of
+// fields. It returns the prefixed keys made for collisions, mapped to the
+// path their depth is counted by.
+func (f *Formatter) flatten(fields map[string]interface{}) map[string]string {
+	var prefixed map[string]string
+	for _, envelope := range f.FlattenFields {
+		object, ok := fields[envelope].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		delete(fields, envelope)
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, exists := fields[k]; !exists || f.FlattenCollision == CollisionOverwrite {
+				fields[k] = object[k]
+				continue
+			}
+			key := envelope + "." + k
+			fields[key] = object[k]
+			if prefixed == nil {
+				prefixed = make(map[string]string)
+			}
+			prefixed[key] = k
+			if f.FlattenCollision == CollisionWarn {
+				f.warnCollision(key)
+			}
+		}
+	}
+	return prefixed
+}
+
+func (f *Formatter) warnCollision(key string) {
+	if f.Warnings == nil || f.warned[key] {
+		return
+	}
+	if f.warned == nil {
+		f.warned = make(map[string]bool)
+	}
+	f.warned[key] = true
+	fmt.Fprintf(f.Warnings, "jl: %s collides with a top level field\n", key)
+}
@@ -0,0 +1,77 @@
+package structure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+var groupColor = color.New(color.FgHiBlack).SprintFunc()
+
+// CorrelationKeys are the fields holding IDs shared by the entries of a
+// request or trace.
+var CorrelationKeys = []string{
+	"trace_id", "traceId", "trace.id", "traceID",
+	"request_id", "requestId", "req_id", "request.id", "x_request_id",
+	"correlation_id", "correlationId",
+}
+
+// Follow returns a Filter showing the entries filter matches and, from then
+// on, all entries sharing one of their correlation IDs, the values of any
+// of keys. This tells the whole story of a request once one of its entries
+// matches.
+func Follow(filter Filter, keys []string) Filter {
+	ids := make(map[string]bool)
+	return func(entry *Entry) bool {
+		values := correlationIDs(entry.Fields, keys)
+		if !filter(entry) {
+			for _, value := range values {
+				if ids[value] {
+					return true
+				}
+			}
+			return false
+		}
+		for _, value := range values {
+			ids[value] = true
+		}
+		return true
+	}
+}
+
+// CorrelationID returns the first correlation ID of the fields, the value
+// of any of keys.
+func CorrelationID(fields map[string]interface{}, keys []string) (string, bool) {
+	ids := correlationIDs(fields, keys)
+	if len(ids) == 0 {
+		return "", false
+	}
+	return ids[0], true
+}
+
+// GroupHeader renders the line shown above the entries of a request or
+// trace, with the number of entries and the time between the first and
+// the last of them.
+func GroupHeader(id string, entries int, elapsed time.Duration) string {
+	text := fmt.Sprintf("%d entries", entries)
+	if entries == 1 {
+		text = "1 entry"
+	}
+	if elapsed > 0 {
+		text += " in " + humanDuration(elapsed)
+	}
+	return idColor(id).Sprint("▶ "+id) + " " + groupColor("("+text+")")
+}
+
+func correlationIDs(fields map[string]interface{}, keys []string) []string {
+	var values []string
+	for _, key := range keys {
+		if value, ok := Lookup(fields, key); ok {
+			if text := formatValue(value); text != "" {
+				values = append(values, text)
+			}
+		}
+	}
+	return values
+}
@@ -5,17 +5,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"path"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultTimeFormat is the layout used to display timestamps when no
+// TimeFormat is given.
+const DefaultTimeFormat = "2006-01-02 15:04:05"
+
 // DefaultTemplate is used when no template is given.
-const DefaultTemplate = `{{if .Timestamp}}[{{.Timestamp.Format "2006-01-02 15:04:05"}}] {{else if .RawTimestamp}}[{{.RawTimestamp}}] {{end}}{{if .Severity}}{{.Severity}}: {{end}}{{.Message}}`
+const DefaultTemplate = `{{if .Source}}{{.Source}} {{end}}{{if .Timestamp}}[{{timestamp .Timestamp}}] {{else if .RawTimestamp}}[{{.RawTimestamp}}] {{end}}{{if .Severity}}{{.Severity}}: {{end}}{{.Message}}`
 
 var severityMapping = map[string]string{
 	"10":   "TRACE",
@@ -24,6 +32,8 @@ var severityMapping = map[string]string{
 	"40":   "WARNING",
 	"WARN": "WARNING",
 	"50":   "ERROR",
+	"ERR":  "ERROR",
+	"CRIT": "CRITICAL",
 	"60":   "FATAL",
 }
 
@@ -31,8 +41,75 @@ var defaultExcludes = []string{
 	"@timestamp", "hostname", "level", "message", "msg", "name", "pid", "severity", "text", "time", "timestamp", "ts", "v",
 }
 
+var severityAbbreviations = map[string]string{
+	"TRACE":   "TRC",
+	"DEBUG":   "DBG",
+	"INFO":    "INF",
+	"WARNING": "WRN",
+	"ERROR":   "ERR",
+	"FATAL":   "FTL",
+}
+
 var defaultObjFields = []string{"record"}
 
+// Alignment controls on which side of the severity column the padding goes.
+type Alignment int
+
+const (
+	// AlignRight pads the severity on the left, this is the default.
+	AlignRight Alignment = iota
+	// AlignLeft pads the severity on the right.
+	AlignLeft
+)
+
+// RelativeMode selects how the timestamp helper displays timestamps.
+type RelativeMode int
+
+const (
+	// Absolute displays timestamps as they are, this is the default.
+	Absolute RelativeMode = iota
+	// RelativeToNow displays how long ago an entry was logged, ex: "2m13s ago".
+	RelativeToNow
+	// RelativeToStart displays the time passed since the first entry of the
+	// stream, ex: "+2m13s".
+	RelativeToStart
+)
+
+const wrapIndent = "    "
+
+const truncationMarker = "…"
+
+// TrailerFormat selects how objects printed beneath an entry are rendered.
+type TrailerFormat int
+
+const (
+	// TrailerJSON renders objects as indented JSON, this is the default.
+	TrailerJSON TrailerFormat = iota
+	// TrailerYAML renders objects as YAML.
+	TrailerYAML
+)
+
+// IconMode selects whether lines are prefixed with a glyph per severity.
+type IconMode int
+
+const (
+	// NoIcons doesn't display icons, this is the default.
+	NoIcons IconMode = iota
+	// IconsWithSeverity prefixes lines with an icon and keeps the severity.
+	IconsWithSeverity
+	// IconsOnly prefixes lines with an icon instead of the severity.
+	IconsOnly
+)
+
+var severityIcons = map[string]string{
+	"TRACE":   "⚪",
+	"DEBUG":   "⚪",
+	"INFO":    "🔵",
+	"WARNING": "🟡",
+	"ERROR":   "🔴",
+	"FATAL":   "🔴",
+}
+
 // NewLine contains ['\n']
 var NewLine = []byte("\n")
 
@@ -42,6 +119,9 @@ type Formatter struct {
 	output   io.Writer
 	template *template.Template
 
+	// Colorize is whether the output is colored. The colors are disabled
+	// for every formatter with color.NoColor, which is set once before
+	// formatting to !Colorize as formatters may run concurrently.
 	Colorize       bool
 	ShowFields     bool
 	MaxFieldLength int
@@ -50,193 +130,897 @@ type Formatter struct {
 	IncludeFields  string
 	ExcludeFields  []string
 	ObjFields      []string
-}
 
-// NewFormatter compiles the given fmt as a go template and returns a Formatter
-func NewFormatter(w io.Writer, fmt string) (*Formatter, error) {
-	if fmt == "" {
-		fmt = DefaultTemplate
-	}
-	tmpl, err := template.New("out").Parse(fmt)
-	if err != nil {
-		return nil, err
-	}
+	// SourceWidth is the width the names of the sources are padded to, for
+	// the lines of several to line up.
+	SourceWidth int
+
+	// Keys are read for the timestamp, severity, message, logger, caller
+	// and error of entries over the usual keys.
+	Keys Keys
+
+	// IncludeFieldsRegexp and ExcludeFieldsRegexp work like IncludeFields
+	// and ExcludeFields but match the dotted field path with a regexp.
+	IncludeFieldsRegexp *regexp.Regexp
+	ExcludeFieldsRegexp *regexp.Regexp
+
+	// TruncateValues, when positive, cuts field values at this length
+	// instead of hiding fields exceeding MaxFieldLength. TruncateFields
+	// overrides this per field (or glob).
+	TruncateValues int
+	TruncateFields map[string]int
+
+	// AlignFields pads the fields, and their values, to the widest of the
+	// recent lines so the values of a field line up across lines.
+	AlignFields bool
+
+	// WrapWidth, when positive, wraps the fields onto indented continuation
+	// lines so lines don't exceed this width.
+	WrapWidth int
+
+	// TruncateWidth, when positive, cuts every output line at this width,
+	// marking where the line was cut.
+	TruncateWidth int
+
+	// FieldColors colors fields (or globs) in the trailer, ex: to make
+	// correlation IDs stand out.
+	FieldColors map[string]*color.Color
+
+	// ColorRules color a field, or the whole line, based on its value.
+	ColorRules []*ColorRule
 
-	return &Formatter{
+	// MaxDepth is the number of levels of nested objects shown as dotted
+	// fields, deeper fields are only shown when included explicitly. Use 0
+	// to show all levels.
+	MaxDepth int
+
+	// MaxArrayLength is the maximum number of elements of an array to be
+	// displayed inline as [a,b,c], larger arrays or arrays containing
+	// objects are printed beneath the entry.
+	MaxArrayLength int
+
+	// TrailerFormat is used for the objects and arrays printed beneath the
+	// entry.
+	TrailerFormat TrailerFormat
+
+	// StackUserPackages are highlighted when they're found in the frames of
+	// a stacktrace, ex: "github.com/acme/" or "com.acme.".
+	StackUserPackages []string
+
+	// StackHead and StackTail are the number of frames shown at the start
+	// and the end of a stacktrace, the frames in between are collapsed. Use
+	// 0 for both to show all frames. Frames matching any of the StackHide
+	// globs (ex: "runtime.*") are hidden completely.
+	StackHead int
+	StackTail int
+	StackHide []string
+
+	// CombineErrors appends the "error" or "err" field to the message, ex:
+	// "connect failed: timeout", and prints the errors it wraps as a chain
+	// of causes beneath the line.
+	CombineErrors bool
+
+	// HighlightSyntax colors JSON and SQL found in messages by token
+	// instead of printing them in the message color.
+	HighlightSyntax bool
+
+	// Highlight colors the substrings of messages and field values it
+	// matches, ex: the --grep pattern.
+	Highlight *regexp.Regexp
+
+	// TraceIDs shortens OpenTelemetry trace and span IDs and colors them per
+	// trace. With TraceURL the trace ID links to a trace viewer, {trace_id}
+	// and {span_id} are replaced, ex: "http://jaeger:16686/trace/{trace_id}".
+	TraceIDs bool
+	TraceURL string
+
+	// ShowCaller displays the source code location the entry was logged
+	// from, when found, dimmed at the end of the line. With CallerLinks it
+	// is made clickable using OSC 8, linking to a file:// URL or to the
+	// CallerURL with {file} and {line} replaced, ex:
+	// "https://github.com/acme/app/blob/main/{file}#L{line}".
+	ShowCaller  bool
+	CallerLinks bool
+	CallerURL   string
+
+	// FlattenFields are envelope objects, like "labels", of which the keys
+	// are shown as top level fields. FlattenCollision selects what happens
+	// when such a key already exists, Warnings receives the warnings of
+	// CollisionWarn.
+	FlattenFields    []string
+	FlattenCollision Collision
+	Warnings         io.Writer
+
+	// FieldOrder lists fields (or globs) displayed first, in this order, so
+	// they're in the same position on every line. The other fields follow
+	// alphabetically.
+	FieldOrder []string
+
+	// Units displays the numeric value of fields (or globs) in human units,
+	// ex: {"size": Bytes, "*_ms": Milliseconds}.
+	Units map[string]Unit
+
+	// Rename maps dotted field paths to the name they're displayed with.
+	Rename map[string]string
+
+	// SeverityWidth is the width of the severity column, severities shorter
+	// than this are padded according to SeverityAlign.
+	SeverityWidth    int
+	SeverityAlign    Alignment
+	SeverityTruncate bool
+
+	// Icons prefixes lines with a glyph per severity, which is readable
+	// without colors too.
+	Icons IconMode
+
+	// Location, when set, is the time zone timestamps are converted to
+	// before they're passed to the template.
+	Location *time.Location
+
+	// RelativeTime makes the timestamp template helper display timestamps
+	// relative to now or to the first entry of the stream.
+	RelativeTime RelativeMode
+
+	// TimeFormat is the layout used by the timestamp template helper. Next
+	// to regular Go layouts it accepts the names of the layouts in the time
+	// package (ex: "RFC3339") and "unix", "unixmilli", "unixmicro" and
+	// "unixnano" for epoch timestamps.
+	TimeFormat string
+
+	// TimeLayouts are tried in order to parse timestamps that aren't in
+	// RFC3339 nor an epoch. Layouts without a time zone are read as UTC.
+	TimeLayouts []string
+
+	// Strict reports fields the template outputs which are absent from an
+	// entry, fields checked with {{if}} or {{with}} first are allowed to be
+	// missing.
+	Strict StrictMode
+
+	// ShowElapsed adds a column with the time passed since the previous
+	// entry, which is highlighted when it exceeds ElapsedThreshold.
+	ShowElapsed      bool
+	ElapsedThreshold time.Duration
+
+	text         string
+	templates    map[string]string
+	referenced   []string
+	entry        *Entry
+	raw          json.RawMessage
+	missing      []string
+	icon         string
+	continuation []string
+	errorText    string
+	trace        string
+	widths       map[string][]int
+	span         string
+	warned       map[string]bool
+	start        *time.Time
+	previous     *time.Time
+	elapsed      *time.Duration
+}
+
+// NewFormatter returns a Formatter writing to w, configured by the options
+// given. The template, DefaultTemplate unless WithTemplate is given, is
+// compiled along with the templates it includes.
+func NewFormatter(w io.Writer, options ...Option) (*Formatter, error) {
+	f := &Formatter{
 		output:         w,
-		template:       tmpl,
 		Colorize:       false,
 		ShowFields:     true,
+		CombineErrors:  true,
 		MaxFieldLength: 30,
 		ShowPrefix:     true,
 		ShowSuffix:     true,
 		IncludeFields:  "",
 		ExcludeFields:  defaultExcludes,
 		ObjFields:      defaultObjFields,
-	}, nil
+		FlattenFields:  defaultFlattenFields,
+		SeverityWidth:  7,
+		SeverityAlign:  AlignRight,
+		TimeFormat:     DefaultTimeFormat,
+		TimeLayouts:    defaultTimeLayouts,
+		MaxArrayLength: 5,
+		MaxDepth:       1,
+		StackHead:      10,
+		StackTail:      3,
+
+		ElapsedThreshold: time.Second,
+
+		text: DefaultTemplate,
+	}
+	for _, option := range options {
+		if err := option(f); err != nil {
+			return nil, err
+		}
+	}
+	tmpl, err := template.New("out").Funcs(f.funcs()).Parse(f.text)
+	if err != nil {
+		return nil, err
+	}
+	f.template = tmpl
+	f.referenced = templateFields(tmpl.Tree)
+	for name, text := range f.templates {
+		if err := f.AddTemplate(name, text); err != nil {
+			return nil, fmt.Errorf("template %s: %v", name, err)
+		}
+	}
+	return f, nil
+}
+
+// AddTemplate defines a template named name which the template of the
+// formatter can include, ex: {{template "request" .}}.
+func (f *Formatter) AddTemplate(name, text string) error {
+	_, err := f.template.New(name).Parse(text)
+	return err
 }
 
 // Format takes a structured log entry and formats it according the template.
 func (f *Formatter) Format(entry *Entry, raw json.RawMessage, prefix, suffix []byte) error {
-	color.NoColor = !f.Colorize
+	f.Normalize(entry, raw)
+	f.entry = entry
+	f.raw = raw
+	f.missing = nil
+
+	// The fields shown are a copy of those of the entry, decoded once by
+	// Normalize, which are taken out as they're written.
+	fields := copyFields(entry.Fields)
+	expandTraceparent(fields, entry.Message)
+	lineColor := f.lineColor(fields)
+
+	var chain []errorLink
+	f.errorText = ""
+	if f.CombineErrors {
+		f.errorText, chain = f.combineError(fields)
+		if strings.Contains(entry.Message, f.errorText) {
+			f.errorText = ""
+		}
+	}
 	f.enhance(entry)
 
-	err := f.outputSimple(prefix, f.ShowPrefix)
+	line := &bytes.Buffer{}
+	f.outputIcon(line)
+	f.outputSimple(line, prefix, f.ShowPrefix)
+	f.outputElapsed(line)
+
+	err := f.template.Execute(line, entry)
 	if err != nil {
 		return err
 	}
 
-	err = f.template.Execute(f.output, entry)
-	if err != nil {
-		return err
+	var missing []string
+	if f.Strict != StrictOff {
+		missing = append(f.missingFields(entry), f.missing...)
+		if len(missing) > 0 && f.Strict == StrictFail {
+			return &MissingFieldsError{Fields: missing}
+		}
+	}
+
+	var location string
+	if f.ShowCaller {
+		if c, keys, ok := findCaller(fields, f.Keys.Caller); ok {
+			location = f.formatCaller(c)
+			for _, key := range keys {
+				deleteKey(fields, key)
+			}
+		}
 	}
 
-	trailerJSON, trailerMultiline := f.outputFields(entry, raw)
+	annotateMissing(line, missing)
 
-	err = f.outputSimple(suffix, f.ShowSuffix)
-	if err != nil {
-		return err
+	trailing, trailers := f.outputFields(fields)
+	f.writeFields(line, trailing)
+
+	if location != "" {
+		line.WriteString(" " + location)
 	}
+	if entry.Repeats > 1 {
+		line.WriteString(" " + Repeats(entry.Repeats))
+	}
+
+	f.outputSimple(line, suffix, f.ShowSuffix)
+	f.writeContinuation(line)
+	line.WriteString(f.renderChain(chain))
 
-	err = stacktrace(f.output, raw)
+	err = f.stacktrace(line, entry.Fields)
 	if err != nil {
 		return err
 	}
 
-	_, err = f.output.Write(NewLine)
+	if lineColor != nil {
+		plain := ansiEscape.ReplaceAll(line.Bytes(), nil)
+		line = bytes.NewBufferString(lineColor.Sprint(string(plain)))
+	}
+
+	if f.TruncateWidth > 0 {
+		truncated := truncateLines(line.Bytes(), f.TruncateWidth)
+		line = bytes.NewBuffer(truncated)
+	}
+
+	line.Write(NewLine)
+	_, err = f.output.Write(line.Bytes())
 	if err != nil {
 		return err
 	}
 
-	if trailerMultiline != "" {
-		f.output.Write([]byte{'\t'})
-		f.output.Write(bytes.ReplaceAll([]byte(trailerMultiline), []byte("\n"), []byte("\n\t")))
-		f.output.Write(NewLine)
-	}
-	if trailerJSON != nil {
-		enc := json.NewEncoder(f.output)
-		enc.SetEscapeHTML(false)
-		enc.SetIndent("\t", "\t")
-		f.output.Write([]byte("\t"))
-		enc.Encode(trailerJSON)
+	for _, t := range trailers {
+		f.writeTrailer(t)
 	}
 
 	return nil
 }
 
-func (f *Formatter) enhance(entry *Entry) {
+// Normalize parses the timestamp of entry, maps its severity to a common
+// name and fills its Fields, without decorating it for display. Format
+// normalizes entries itself, filters use it to see entries as they're
+// displayed.
+func (f *Formatter) Normalize(entry *Entry, raw json.RawMessage) {
+	if entry.Fields == nil {
+		_ = json.Unmarshal(raw, &entry.Fields)
+	}
+	f.Keys.read(entry, entry.Fields)
+	expandTraceparent(entry.Fields, entry.Message)
+
 	if entry.Timestamp != nil && entry.Timestamp.IsZero() {
 		entry.Timestamp = nil
 	}
 
-	if entry.Timestamp != nil && entry.Timestamp.Year() > 3000 { // timestamp was probably in milliseconds
-		t := *entry.Timestamp
-		t = time.Unix(t.Unix()/int64(time.Second/time.Millisecond), 0).UTC()
+	if entry.Timestamp == nil {
+		if t, ok := parseEpoch(entry.FloatTimestamp, entry.RawTimestamp); ok {
+			entry.Timestamp = &t
+		} else if t, ok := parseLayouts(entry.RawTimestamp, f.TimeLayouts); ok {
+			entry.Timestamp = &t
+		}
+	}
+
+	if entry.Timestamp != nil && f.Location != nil {
+		t := entry.Timestamp.In(f.Location)
 		entry.Timestamp = &t
 	}
 
-	entry.Severity = strings.ToUpper(entry.Severity)
-	if level, ok := severityMapping[entry.Severity]; ok {
-		entry.Severity = level
+	entry.Severity = NormalizeSeverity(entry.Severity)
+}
+
+func (f *Formatter) enhance(entry *Entry) {
+	if entry.Timestamp != nil && f.start == nil {
+		f.start = entry.Timestamp
+	}
+
+	f.elapsed = nil
+	if entry.Timestamp != nil {
+		if f.previous != nil {
+			d := entry.Timestamp.Sub(*f.previous)
+			f.elapsed = &d
+		}
+		f.previous = entry.Timestamp
+	}
+
+	if entry.Source != "" {
+		entry.Source = f.SourceLabel(entry.Source)
+	}
+
+	f.icon = severityIcons[entry.Severity]
+	if f.Icons == IconsOnly {
+		entry.Severity = ""
 	}
 	if entry.Severity != "" {
-		padding := 7 - len(entry.Severity)
-		if color, ok := severityColors[entry.Severity]; ok {
-			entry.Severity = color(entry.Severity)
+		entry.Severity = f.formatSeverity(entry.Severity)
+	}
+
+	entry.Message, f.continuation = splitMessage(entry.Message)
+	if f.errorText != "" {
+		entry.Message = strings.TrimRight(entry.Message, ".: ")
+	}
+	plain := entry.Message
+	switch {
+	case f.Highlight != nil && f.Highlight.MatchString(entry.Message):
+		entry.Message = highlightMatches(f.Highlight, entry.Message, messageColor)
+	case f.HighlightSyntax:
+		entry.Message = highlightMessage(entry.Message)
+	default:
+		entry.Message = messageColor(entry.Message)
+	}
+	if f.errorText != "" {
+		entry.Message = appendError(entry.Message, plain, f.errorText)
+	}
+}
+
+// splitMessage splits a multi-line message into its first line and the
+// lines following it, without trailing empty lines.
+func splitMessage(message string) (string, []string) {
+	message = strings.TrimRight(message, "\r\n")
+	if !strings.Contains(message, "\n") {
+		return message, nil
+	}
+	lines := strings.Split(message, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines[0], lines[1:]
+}
+
+// writeContinuation writes the lines following the first line of a
+// multi-line message indented beneath the line, keeping their own
+// indentation.
+func (f *Formatter) writeContinuation(line *bytes.Buffer) {
+	for _, text := range f.continuation {
+		line.WriteString("\n")
+		if strings.TrimSpace(text) != "" {
+			line.WriteString(wrapIndent + messageColor(text))
 		}
-		if padding > 0 {
-			entry.Severity = strings.Repeat(" ", padding) + entry.Severity
+	}
+}
+
+// SourceLabel renders the name of a source, colored after it so it's the
+// same color on every line and padded to SourceWidth.
+func (f *Formatter) SourceLabel(name string) string {
+	text := idColor(name).Sprint(name)
+	if padding := f.SourceWidth - utf8.RuneCountInString(name); padding > 0 {
+		text += strings.Repeat(" ", padding)
+	}
+	return text
+}
+
+func (f *Formatter) formatSeverity(severity string) string {
+	text := severity
+	if f.SeverityTruncate && f.SeverityWidth > 0 && len(text) > f.SeverityWidth {
+		if abbr, ok := severityAbbreviations[text]; ok && f.SeverityWidth == len(abbr) {
+			text = abbr
+		} else {
+			text = text[:f.SeverityWidth]
 		}
 	}
+	padding := f.SeverityWidth - len(text)
+	if color, ok := severityColors[severity]; ok {
+		text = color(text)
+	}
+	if padding > 0 {
+		if f.SeverityAlign == AlignLeft {
+			text = text + strings.Repeat(" ", padding)
+		} else {
+			text = strings.Repeat(" ", padding) + text
+		}
+	}
+	return text
+}
 
-	entry.Message = messageColor(entry.Message)
+// outputIcon writes the icon of the severity, or padding of the same width
+// when there is none so messages stay aligned.
+func (f *Formatter) outputIcon(w io.Writer) {
+	if f.Icons == NoIcons {
+		return
+	}
+	icon := f.icon
+	if icon == "" {
+		icon = "  "
+	}
+	io.WriteString(w, icon+" ")
 }
 
-func (f *Formatter) outputSimple(txt []byte, toggle bool) error {
-	if toggle && txt != nil && len(txt) > 0 {
-		_, err := f.output.Write(txt)
-		if err != nil {
-			return err
+func (f *Formatter) outputElapsed(w io.Writer) {
+	if !f.ShowElapsed {
+		return
+	}
+	text := ""
+	if f.elapsed != nil {
+		text = "+" + humanDuration(*f.elapsed)
+		if *f.elapsed < 0 {
+			text = "-" + humanDuration(-*f.elapsed)
 		}
 	}
-	return nil
+	text = fmt.Sprintf("%8s", text)
+	if f.elapsed != nil && f.ElapsedThreshold > 0 && *f.elapsed >= f.ElapsedThreshold {
+		text = elapsedColor(text)
+	}
+	io.WriteString(w, text+" ")
+}
+
+func (f *Formatter) outputSimple(w io.Writer, txt []byte, toggle bool) {
+	if toggle && len(txt) > 0 {
+		w.Write(txt)
+	}
+}
+
+// trailer is a value printed on its own, indented lines beneath the entry.
+type trailer struct {
+	label string
+	value interface{}
+}
+
+func (f *Formatter) writeTrailer(t trailer) {
+	if text, ok := t.value.(string); ok {
+		f.output.Write([]byte{'\t'})
+		if t.label != "" {
+			f.output.Write([]byte(t.label + ": "))
+		}
+		f.output.Write(bytes.ReplaceAll([]byte(text), NewLine, []byte("\n\t")))
+		f.output.Write(NewLine)
+		return
+	}
+	switch f.TrailerFormat {
+	case TrailerYAML:
+		f.writeYAML(t)
+	default:
+		f.writeJSON(t)
+	}
+}
+
+func (f *Formatter) writeJSON(t trailer) {
+	f.output.Write([]byte{'\t'})
+	if t.label != "" {
+		f.output.Write([]byte(t.label + ": "))
+	}
+	enc := json.NewEncoder(f.output)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("\t", "\t")
+	enc.Encode(t.value)
 }
 
-func (f *Formatter) outputFields(entry *Entry, raw json.RawMessage) (map[string]any, string) {
-	if !f.ShowFields {
-		return nil, ""
+func (f *Formatter) writeYAML(t trailer) {
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	enc.Encode(t.value)
+	enc.Close()
+
+	indent := []byte("\t")
+	if t.label != "" {
+		f.output.Write([]byte("\t" + t.label + ":\n"))
+		indent = []byte("\t  ")
+	}
+	for _, line := range bytes.SplitAfter(buf.Bytes(), NewLine) {
+		if len(line) > 0 {
+			f.output.Write(indent)
+			f.output.Write(line)
+		}
 	}
-	fields := make(map[string]interface{})
-	err := json.Unmarshal(raw, &fields)
+}
+
+// field is a single key=value pair of the trailer.
+type field struct {
+	key   string
+	text  string
+	value interface{}
+}
 
-	if labels, ok := fields["labels"]; ok {
-		if labelmap, ok := labels.(map[string]interface{}); ok {
-			for k, v := range labelmap {
-				fields[k] = v
+func (f *Formatter) outputFields(fields map[string]interface{}) ([]field, []trailer) {
+	if !f.ShowFields || fields == nil {
+		return nil, nil
+	}
+
+	prefixed := f.flatten(fields)
+	f.trace, f.span = "", ""
+
+	output := make([]field, 0)
+	var objects, arrays []trailer
+	for key, value := range f.walkFields(fields, "") {
+		if contains(f.ObjFields, key) {
+			switch value.(type) {
+			case map[string]interface{}, string:
+				objects = append(objects, trailer{label: key, value: value})
+				continue
+			}
+		}
+		path := "." + key
+		if original, ok := prefixed[key]; ok {
+			path = "." + original
+		}
+		// The fields are included or excluded by their name in the entry,
+		// the alias is only displayed.
+		name := key
+		if alias, ok := f.Rename[key]; ok {
+			key = alias
+			path = "." + alias
+		}
+		if array, ok := value.([]interface{}); ok && !f.isShortArray(array) {
+			if !f.shouldSkipField(name, path, "", true) {
+				arrays = append(arrays, trailer{label: key, value: array})
+			}
+			continue
+		}
+		text := formatValue(value)
+		if f.TraceIDs {
+			switch traceField(key) {
+			case traceID:
+				f.trace = text
+				text = shortenTraceID(text)
+			case spanID:
+				f.span = text
+				text = shortenTraceID(text)
 			}
 		}
-		delete(fields, "labels")
-	}
-
-	output := make([]string, 0)
-	var trailerJSON map[string]interface{}
-	var trailerMultiline string
-	if err == nil {
-		path := ""
-		for key, value := range f.walkFields(fields, "") {
-			if contains(f.ObjFields, key) {
-				switch value := value.(type) {
-				case map[string]interface{}:
-					trailerJSON = value
-					continue
-				case string:
-					trailerMultiline = value
-					continue
-				}
+		if unit, ok := f.unit(key); ok {
+			if human, ok := humanize(value, unit); ok {
+				text = human
 			}
-			if _, ok := value.([]interface{}); ok {
+		}
+		limit := f.truncateLimit(key)
+		if limit > 0 {
+			text = truncate(text, limit)
+		}
+		if !f.shouldSkipField(name, path, text, limit > 0) {
+			output = append(output, field{key: key, text: quoteValue(text), value: value})
+		}
+	}
+	sort.Slice(output, func(i, j int) bool {
+		pi, pj := f.fieldPriority(output[i].key), f.fieldPriority(output[j].key)
+		if pi != pj {
+			return pi < pj
+		}
+		return output[i].key+"="+output[i].text < output[j].key+"="+output[j].text
+	})
+	sort.Slice(objects, func(i, j int) bool {
+		return index(f.ObjFields, objects[i].label) < index(f.ObjFields, objects[j].label)
+	})
+	sort.Slice(arrays, func(i, j int) bool { return arrays[i].label < arrays[j].label })
+	return output, append(objects, arrays...)
+}
+
+// fieldPriority returns the position of the first FieldOrder pattern
+// matching field, fields not matching any come last.
+func (f *Formatter) fieldPriority(field string) int {
+	for i, pattern := range f.FieldOrder {
+		if matches([]string{pattern}, field) {
+			return i
+		}
+	}
+	return len(f.FieldOrder)
+}
+
+// isShortArray reports whether the array can be displayed inline, which
+// requires it to be small and to not contain any objects or arrays.
+func (f *Formatter) isShortArray(array []interface{}) bool {
+	if len(array) > f.MaxArrayLength {
+		return false
+	}
+	for _, value := range array {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+// writeFields writes the fields as " [k=v k=v]" to the line, wrapping onto
+// indented continuation lines when the line would exceed the WrapWidth.
+func (f *Formatter) writeFields(line *bytes.Buffer, fields []field) {
+	if len(fields) == 0 {
+		return
+	}
+	column := visibleWidth(line.Bytes())
+	if f.AlignFields {
+		start := f.recentWidth("", column)
+		line.WriteString(strings.Repeat(" ", start-column))
+		column = start
+	}
+	line.WriteString(" [")
+	column += 2
+	for i, fld := range fields {
+		text := f.colorField(fld, fld.key+"="+fld.text)
+		if f.Highlight != nil && f.Highlight.MatchString(fld.text) {
+			base := func(a ...interface{}) string { return f.colorField(fld, a[0].(string)) }
+			text = base(fld.key+"=") + highlightMatches(f.Highlight, fld.text, base)
+		}
+		if link := f.traceLink(fld); link != "" {
+			text = hyperlink(link, text)
+		}
+		width := utf8.RuneCountInString(fld.key + "=" + fld.text)
+		if f.AlignFields && i < len(fields)-1 {
+			padded := f.recentWidth("."+fld.key, width)
+			text += strings.Repeat(" ", padded-width)
+			width = padded
+		}
+		if i > 0 {
+			if f.WrapWidth > 0 && column+1+width+1 > f.WrapWidth {
+				line.WriteString("\n" + wrapIndent)
+				column = len(wrapIndent)
+			} else {
+				line.WriteString(" ")
+				column++
+			}
+		}
+		line.WriteString(text)
+		column += width
+	}
+	line.WriteString("]")
+}
+
+// Truncate cuts every line of s at the given visible width like
+// TruncateWidth does, keeping the color codes intact.
+func Truncate(s string, width int) string {
+	return string(truncateLines([]byte(s), width))
+}
+
+// StripColors removes the color codes and links from s.
+func StripColors(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// truncateLines cuts every line in b at the given visible width, keeping the
+// color codes intact.
+func truncateLines(b []byte, width int) []byte {
+	lines := bytes.Split(b, NewLine)
+	for i, line := range lines {
+		if visibleWidth(line) <= width {
+			continue
+		}
+		result := make([]byte, 0, len(line))
+		colored := false
+		visible := 0
+		for len(line) > 0 {
+			if loc := ansiEscape.FindIndex(line); loc != nil && loc[0] == 0 {
+				result = append(result, line[:loc[1]]...)
+				line = line[loc[1]:]
+				colored = true
 				continue
 			}
-			if !f.shouldSkipField(key, path+"."+key, value) {
-				switch v := value.(type) {
-				case float64:
-					output = append(output, key+"="+strconv.FormatFloat(v, 'f', -1, 64))
-				default:
-					output = append(output, fmt.Sprintf("%s=%v", key, value))
-				}
+			if visible == width-1 {
+				break
 			}
+			_, size := utf8.DecodeRune(line)
+			result = append(result, line[:size]...)
+			line = line[size:]
+			visible++
+		}
+		if colored {
+			result = append(result, "\x1b[0m"...)
+		}
+		lines[i] = append(result, truncationMarker...)
+	}
+	return bytes.Join(lines, NewLine)
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m|\x1b\]8;[^\x1b]*\x1b\\`)
+
+// visibleWidth returns the number of characters on the last line of b,
+// leaving out color codes.
+func visibleWidth(b []byte) int {
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		b = b[i+1:]
+	}
+	return utf8.RuneCount(ansiEscape.ReplaceAll(b, nil))
+}
+
+// lineColor returns the color of the first line ColorRule matching fields.
+func (f *Formatter) lineColor(fields map[string]interface{}) *color.Color {
+	for _, rule := range f.ColorRules {
+		if rule.Line && rule.Match(fields) {
+			return rule.Color
+		}
+	}
+	return nil
+}
+
+// colorField colors the rendered field when a color is configured for it or
+// when a field ColorRule matches its value.
+func (f *Formatter) colorField(fld field, text string) string {
+	for _, rule := range f.ColorRules {
+		if !rule.Line && matches([]string{rule.Field}, fld.key) && rule.MatchValue(fld.value) {
+			return rule.Color.Sprint(text)
+		}
+	}
+	field := fld.key
+	if c, ok := f.FieldColors[field]; ok {
+		return c.Sprint(text)
+	}
+	for pattern, c := range f.FieldColors {
+		if matches([]string{pattern}, field) {
+			return c.Sprint(text)
+		}
+	}
+	if f.TraceIDs {
+		if colored, ok := f.colorTrace(fld, text); ok {
+			return colored
 		}
-		if len(output) > 0 {
-			sort.Strings(output)
-			fmt.Fprintf(f.output, " %v", output)
+	}
+	return text
+}
+
+// quoteValue quotes a value the way logfmt does when it is empty or contains
+// spaces, quotes, "=" or control characters, so the fields stay unambiguous.
+func quoteValue(text string) string {
+	if text == "" {
+		return `""`
+	}
+	for _, r := range text {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == 0x85 || r == 0xa0 {
+			return strconv.Quote(text)
+		}
+	}
+	return text
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = formatValue(value)
 		}
+		return "[" + strings.Join(values, ",") + "]"
+	default:
+		return fmt.Sprintf("%v", value)
 	}
-	return trailerJSON, trailerMultiline
 }
 
-func (f *Formatter) shouldSkipField(field, path string, value interface{}) bool {
-	if strings.Contains(f.IncludeFields, field) || strings.Contains(f.IncludeFields, path) {
+// truncateLimit returns the length the value of field should be truncated
+// at, or 0 when it shouldn't be truncated.
+func (f *Formatter) truncateLimit(field string) int {
+	if limit, ok := f.TruncateFields[field]; ok {
+		return limit
+	}
+	for pattern, limit := range f.TruncateFields {
+		if matches([]string{pattern}, field) {
+			return limit
+		}
+	}
+	return f.TruncateValues
+}
+
+// truncate shortens s to at most limit characters, marking it with an
+// ellipsis when it was cut.
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	if limit <= 1 {
+		return string(runes[:limit])
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+func (f *Formatter) shouldSkipField(field, path, value string, truncated bool) bool {
+	if matches(strings.Split(f.IncludeFields, ","), field) {
+		return false
+	}
+	if f.IncludeFieldsRegexp != nil && f.IncludeFieldsRegexp.MatchString(field) {
 		return false
 	}
-	if strings.Count(path, ".") > 1 { // Only include nested fields when the are in the IncludeFields
+	if f.MaxDepth > 0 && strings.Count(path, ".") > f.MaxDepth { // Only include deeper nested fields when the are in the IncludeFields
 		return true
 	}
-	if f.MaxFieldLength > 0 && len(path+fmt.Sprintf("%v", value)) >= f.MaxFieldLength {
+	if !truncated && f.MaxFieldLength > 0 && len(path+value) >= f.MaxFieldLength {
 		return true
 	}
 
-	return contains(f.ExcludeFields, field)
+	if f.ExcludeFieldsRegexp != nil && f.ExcludeFieldsRegexp.MatchString(field) {
+		return true
+	}
+	return matches(f.ExcludeFields, field)
 }
 
-func contains(lst []string, val string) bool {
-	for _, i := range lst {
-		if strings.EqualFold(i, val) {
+// matches reports whether val matches any of the glob patterns (as supported
+// by path.Match), ignoring case.
+func matches(patterns []string, val string) bool {
+	val = strings.ToLower(val)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if ok, err := path.Match(pattern, val); ok || (err != nil && pattern == val) {
 			return true
 		}
 	}
 	return false
 }
 
+func contains(lst []string, val string) bool {
+	return index(lst, val) >= 0
+}
+
+func index(lst []string, val string) int {
+	for i, item := range lst {
+		if strings.EqualFold(item, val) {
+			return i
+		}
+	}
+	return -1
+}
+
 func (f *Formatter) walkFields(fields map[string]interface{}, path string) map[string]interface{} {
 	result := make(map[string]interface{})
 	for key, value := range fields {
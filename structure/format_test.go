@@ -3,9 +3,14 @@ package structure_test
 import (
 	"bytes"
 	"encoding/json"
+	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fatih/color"
+	"github.com/robfig/jl/djson"
 	"github.com/robfig/jl/structure"
 )
 
@@ -19,10 +24,24 @@ const example = `{
   "float_number": 2250.1438
 }`
 
+func TestMain(m *testing.M) {
+	// The colors are enabled by the tests of colors only, whether the
+	// output is a terminal or not.
+	color.NoColor = true
+	os.Exit(m.Run())
+}
+
+// colorize enables the colors for the test, which isn't parallel since
+// the colors are shared by all formatters.
+func colorize(t *testing.T) {
+	color.NoColor = false
+	t.Cleanup(func() { color.NoColor = true })
+}
+
 func TestHappypath(t *testing.T) {
 	t.Parallel()
 	buf := &bytes.Buffer{}
-	formatter, err := structure.NewFormatter(buf, "")
+	formatter, err := structure.NewFormatter(buf)
 	if err != nil {
 		t.Fatalf("failed to create new formatter: %v", err)
 	}
@@ -57,7 +76,7 @@ func TestNestedFieldPaths(t *testing.T) {
 	logline := []byte(`{"message": "Hi!", "severity": "info", "meta": {"count": 42}, "flat.root": "yes"}`)
 
 	buf := &bytes.Buffer{}
-	formatter, err := structure.NewFormatter(buf, "")
+	formatter, err := structure.NewFormatter(buf)
 	if err != nil {
 		t.Fatalf("failed to create new formatter: %v", err)
 	}
@@ -79,3 +98,1541 @@ func TestNestedFieldPaths(t *testing.T) {
 		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
 	}
 }
+
+func TestSeverityColumn(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "severity": "warn"}`)
+	tests := []struct {
+		width    int
+		align    structure.Alignment
+		truncate bool
+		expect   string
+	}{
+		{7, structure.AlignRight, false, "WARNING: Hi!\n"},
+		{9, structure.AlignRight, false, "  WARNING: Hi!\n"},
+		{9, structure.AlignLeft, false, "WARNING  : Hi!\n"},
+		{3, structure.AlignRight, false, "WARNING: Hi!\n"},
+		{3, structure.AlignRight, true, "WRN: Hi!\n"},
+		{4, structure.AlignLeft, true, "WARN: Hi!\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.SeverityWidth = test.width
+		formatter.SeverityAlign = test.align
+		formatter.SeverityTruncate = test.truncate
+
+		var entry structure.Entry
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestIcons(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		logline string
+		icons   structure.IconMode
+		expect  string
+	}{
+		{`{"message": "Hi!", "severity": "warn"}`, structure.IconsWithSeverity, "🟡 WARNING: Hi!\n"},
+		{`{"message": "Hi!", "severity": "error"}`, structure.IconsOnly, "🔴 Hi!\n"},
+		{`{"message": "Hi!"}`, structure.IconsOnly, "   Hi!\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.Icons = test.icons
+
+		var entry structure.Entry
+		logline := []byte(test.logline)
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestStrictTemplate(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!"}`)
+	tests := []struct {
+		template string
+		strict   structure.StrictMode
+		expect   string
+		err      string
+	}{
+		{"{{.Severity}} {{.Message}}", structure.StrictOff, " Hi!\n", ""},
+		{"{{.Severity}} {{.Message}}", structure.StrictAnnotate, " Hi! <missing .Severity>\n", ""},
+		{"{{.Severity}} {{.Message}}", structure.StrictFail, "", "template references missing fields: .Severity"},
+		{"{{if .Severity}}{{.Severity}} {{end}}{{.Message}}", structure.StrictFail, "Hi!\n", ""},
+		{`{{.Message}} {{field "http.status"}}`, structure.StrictAnnotate, "Hi!  <missing http.status>\n", ""},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf, structure.WithTemplate(test.template))
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.Strict = test.strict
+
+		var entry structure.Entry
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestTemplateFields(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "http": {"method": "GET", "status": 404}, "user.id": 7}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate(`{{index .Fields "http" "method"}} {{field "http.status"}} {{field "user.id"}} {{.Message}}`))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.ShowFields = false
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "GET 404 7 Hi!\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestGetTemplateFunc(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "resource": {"attributes": {"service.name": "api", "pod": {"ip": "10.0.0.1"}}}, "spans": [1, 2]}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate(`{{get "resource.attributes.service\\.name"}} {{get "resource.attributes.pod"}} {{get "spans.1"}} {{get "missing" "n/a"}} {{.Message}}`))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.ShowFields = false
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := `api {"ip": "10.0.0.1"} 2 n/a Hi!` + "\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestMultilineMessage(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Query failed:\n  SELECT *\n\n    FROM users\r\n", "lang": "fr"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Query failed: [lang=fr]\n      SELECT *\n\n        FROM users\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		logline string
+		combine bool
+		expect  string
+	}{
+		{`{"message": "connect failed.", "error": "EOF", "lang": "fr"}`, true, "connect failed: EOF [lang=fr]\n"},
+		{`{"message": "connect failed", "error": "EOF"}`, false, "connect failed [error=EOF]\n"},
+		{`{"err": "EOF"}`, true, "EOF\n"},
+		{`{"message": "query", "error": "EOF", "errorVerbose": "EOF\nmain.query\n\tmain.go:12"}`, true, "query: EOF\n    main.query\n      main.go:12\n"},
+		{`{"message": "operation went boom: TypeError: boom", "err": {"name": "TypeError", "message": "boom"}}`, true, "operation went boom: TypeError: boom\n"},
+		{`{"message": "save failed", "error": "write: disk full", "errorVerbose": "disk full\nmain.write\n\tmain.go:7\nmain.main\n\tmain.go:3\nwrite\nmain.save\n\tmain.go:21"}`, true, "save failed: write: disk full\n    caused by: disk full\n      main.write\n        main.go:7\n      main.main\n        main.go:3\n"},
+		{`{"message": "request failed", "error": {"type": "HTTPError", "message": "bad gateway", "cause": {"message": "dial tcp", "cause": "connection refused"}}}`, true, "request failed: HTTPError: bad gateway\n    caused by: dial tcp\n      caused by: connection refused\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.CombineErrors = test.combine
+
+		var entry structure.Entry
+		logline := []byte(test.logline)
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "timestamp": "2015-02-11T13:37:00+01:00"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Location = time.UTC
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "[2015-02-11 12:37:00] Hi!\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestRelativeToStart(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.RelativeTime = structure.RelativeToStart
+
+	loglines := []string{
+		`{"message": "one", "timestamp": "2015-02-11T13:37:00Z"}`,
+		`{"message": "two", "timestamp": "2015-02-11T13:37:01.25Z"}`,
+		`{"message": "three", "timestamp": "2015-02-11T13:39:13Z"}`,
+	}
+	for _, logline := range loglines {
+		var entry structure.Entry
+		_ = json.Unmarshal([]byte(logline), &entry)
+		err = formatter.Format(&entry, []byte(logline), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+	}
+	expect := "[+0s] one\n[+1.3s] two\n[+2m13s] three\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestElapsed(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate(`{{.Message}}`))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.ShowElapsed = true
+
+	loglines := []string{
+		`{"message": "one", "timestamp": "2015-02-11T13:37:00Z"}`,
+		`{"message": "two", "timestamp": "2015-02-11T13:37:00.012Z"}`,
+		`{"message": "three", "timestamp": "2015-02-11T13:37:04.2Z"}`,
+	}
+	for _, logline := range loglines {
+		var entry structure.Entry
+		_ = json.Unmarshal([]byte(logline), &entry)
+		err = formatter.Format(&entry, []byte(logline), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+	}
+	expect := "         one\n   +12ms two\n   +4.2s three\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "timestamp": "2015-02-11T13:37:00.123Z"}`)
+	tests := map[string]string{
+		"15:04:05.000": "[13:37:00.123] Hi!\n",
+		"RFC3339":      "[2015-02-11T13:37:00Z] Hi!\n",
+		"unixmilli":    "[1423661820123] Hi!\n",
+	}
+	for layout, expect := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.TimeFormat = layout
+
+		var entry structure.Entry
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+		}
+	}
+}
+
+func TestEpochTimestamps(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		`1423661820.5`:           "2015-02-11T13:37:00.5Z",
+		`1423661820123`:          "2015-02-11T13:37:00.123Z",
+		`1423661820123456`:       "2015-02-11T13:37:00.123456Z",
+		`1423661820123456000`:    "2015-02-11T13:37:00.123456Z",
+		`"1423661820.25"`:        "2015-02-11T13:37:00.25Z",
+		`"1423661820123"`:        "2015-02-11T13:37:00.123Z",
+		`"2015-02-11T13:37:00Z"`: "2015-02-11T13:37:00Z",
+	}
+	for ts, expect := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf, structure.WithTemplate(`{{timestamp .Timestamp}}`))
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.TimeFormat = time.RFC3339Nano
+		formatter.ShowFields = false
+
+		logline := []byte(`{"message": "Hi!", "ts": ` + ts + `}`)
+		entry := &structure.Entry{}
+		djson.Unmarshal(logline, entry)
+		err = formatter.Format(entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != expect+"\n" {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+		}
+	}
+}
+
+func TestTimeLayouts(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"2015-02-11 13:37:00,123":    "2015-02-11T13:37:00.123Z",
+		"2015-02-11T13:37:00":        "2015-02-11T13:37:00Z",
+		"11/Feb/2015:14:37:00 +0100": "2015-02-11T14:37:00+01:00",
+	}
+	for ts, expect := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf, structure.WithTemplate(`{{timestamp .Timestamp}}`))
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.TimeFormat = time.RFC3339Nano
+		formatter.TimeLayouts = append(formatter.TimeLayouts, "02/Jan/2006:15:04:05 -0700")
+		formatter.ShowFields = false
+
+		logline := []byte(`{"message": "Hi!", "time": "` + ts + `"}`)
+		entry := &structure.Entry{}
+		djson.Unmarshal(logline, entry)
+		err = formatter.Format(entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != expect+"\n" {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "http": {"request": {"method": "GET"}}, "user_id": 42}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Rename = map[string]string{
+		"http.request.method": "method",
+		"user_id":             "user",
+	}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! [method=GET user=42]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestFieldPatterns(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "http": {"method": "GET", "path": "/"}, "uuid": "4f1c6e7a-0b5e-4b8a-9e43-3e0c5a6d9b21", "id": 1, "user_id": 2, "request_id": 3}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.IncludeFields = "http.*,id"
+	formatter.ExcludeFields = append(formatter.ExcludeFields, "*_id")
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! [http.method=GET http.path=/ id=1]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestFieldRegexps(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "otel": {"attributes": {"http.status": 200}}, "user_id": 2, "db_query_ms": 3}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.IncludeFieldsRegexp = regexp.MustCompile(`^otel\.attributes\.`)
+	formatter.ExcludeFieldsRegexp = regexp.MustCompile(`_ms$`)
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! [otel.attributes.http.status=200 user_id=2]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestQuoteValues(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "query": "a=b", "user": "John Doe", "empty": "", "lines": "a\nb", "path": "/x"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := `Hi! [empty="" lines="a\nb" path=/x query="a=b" user="John Doe"]` + "\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestQuoteValuesLength(t *testing.T) {
+	t.Parallel()
+
+	// The quotes don't count in the length of the fields, which are hidden
+	// as long with quoting as without.
+	logline := []byte(`{"message": "Hi!", "user": "John Do", "name": "John Doe"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithMaxFieldLength(13))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := `Hi! [user="John Do"]` + "\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestFieldOrder(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "status": 200, "method": "GET", "lang": "fr", "request_id": "abc", "app": "api"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.FieldOrder = []string{"*_id", "method", "status"}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! [request_id=abc method=GET status=200 app=api lang=fr]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestFlattenFields(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "env": "prod", "labels": {"env": "dev", "team": "core"}, "context": {"user": "bob"}}`)
+	tests := []struct {
+		collision structure.Collision
+		expect    string
+		warnings  string
+	}{
+		{structure.CollisionPrefix, "Hi! [env=prod labels.env=dev team=core user=bob]\n", ""},
+		{structure.CollisionOverwrite, "Hi! [env=dev team=core user=bob]\n", ""},
+		{structure.CollisionWarn, "Hi! [env=prod labels.env=dev team=core user=bob]\n", "jl: labels.env collides with a top level field\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		warnings := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.FlattenFields = []string{"labels", "context"}
+		formatter.FlattenCollision = test.collision
+		formatter.Warnings = warnings
+
+		for i := 0; i < 2; i++ {
+			var entry structure.Entry
+			_ = json.Unmarshal(logline, &entry)
+			err = formatter.Format(&entry, logline, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to format entry: %v", err)
+			}
+		}
+		if buf.String() != test.expect+test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect+test.expect)
+		}
+		if warnings.String() != test.warnings {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", warnings.String(), test.warnings)
+		}
+	}
+}
+
+func TestAlignFields(t *testing.T) {
+	t.Parallel()
+
+	loglines := []string{
+		`{"message": "GET /", "status": 200, "duration": "3ms"}`,
+		`{"message": "POST /login", "status": 401, "duration": "120ms"}`,
+		`{"message": "GET /a", "status": 200, "duration": "9ms"}`,
+	}
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.AlignFields = true
+
+	for _, logline := range loglines {
+		var entry structure.Entry
+		_ = json.Unmarshal([]byte(logline), &entry)
+		err = formatter.Format(&entry, []byte(logline), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+	}
+	expect := "GET / [duration=3ms status=200]\n" +
+		"POST /login [duration=120ms status=401]\n" +
+		"GET /a      [duration=9ms   status=200]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestTruncateValues(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "url": "https://example.com/a/very/long/path?with=query", "sql": "SELECT * FROM users WHERE id = 42", "ignored": "Lorem ipsum dolor sit amet."}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.TruncateFields = map[string]int{"url": 20, "s*": 10}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! [sql=\"SELECT * …\" url=https://example.com…]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestWrapFields(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "a": "first", "b": "second", "c": "third", "d": "fourth"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.WrapWidth = 24
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! [a=first b=second\n    c=third d=fourth]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestTruncateWidth(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hello, world", "severity": "info", "lang": "fr"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.TruncateWidth = 20
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "   INFO: Hello, wor…\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestFieldColors(t *testing.T) {
+	colorize(t)
+	logline := []byte(`{"message": "Hi!", "request_id": "abc", "user_id": 42, "lang": "fr"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate("{{.Message}}"))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Colorize = true
+	formatter.FieldColors = make(map[string]*color.Color)
+	formatter.FieldColors["request_id"], _ = structure.ParseColor("cyan")
+	formatter.FieldColors["*_id"], _ = structure.ParseColor("magenta+bold")
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "\x1b[96;1mHi!\x1b[0m [lang=fr \x1b[36mrequest_id=abc\x1b[0m \x1b[35;1muser_id=42\x1b[0m]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestHighlightSyntax(t *testing.T) {
+	colorize(t)
+	tests := []struct {
+		message string
+		expect  string
+	}{
+		{`got {"id": 7, "ok": true}`, "\x1b[96;1mgot \x1b[0m{\x1b[34m\"id\"\x1b[0m: \x1b[35m7\x1b[0m, \x1b[34m\"ok\"\x1b[0m: \x1b[33mtrue\x1b[0m}\n"},
+		{`query: select id from users where name = 'bob'`, "\x1b[96;1mquery: \x1b[0m\x1b[94;1mselect\x1b[0m\x1b[96;1m id \x1b[0m\x1b[94;1mfrom\x1b[0m\x1b[96;1m users \x1b[0m\x1b[94;1mwhere\x1b[0m\x1b[96;1m name = \x1b[0m\x1b[32m'bob'\x1b[0m\n"},
+		{`select a plan {}`, "\x1b[96;1mselect a plan {}\x1b[0m\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf, structure.WithTemplate("{{.Message}}"))
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.Colorize = true
+		formatter.HighlightSyntax = true
+
+		logline, _ := json.Marshal(map[string]string{"message": test.message})
+		var entry structure.Entry
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestTraceIDs(t *testing.T) {
+	colorize(t)
+	logline := []byte(`{"message": "Hi!", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "spanId": "00f067aa0ba902b7", "trace_flags": "01"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate("-"))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Colorize = true
+	formatter.TraceIDs = true
+	formatter.TraceURL = "http://jaeger/trace/{trace_id}?span={span_id}"
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "- [\x1b[33mspanId=00f067aa\x1b[0m \x1b[90mtrace_flags=01\x1b[0m " +
+		"\x1b]8;;http://jaeger/trace/4bf92f3577b34da6a3ce929d0e0e4736?span=00f067aa0ba902b7\x1b\\\x1b[33mtrace_id=4bf92f35\x1b[0m\x1b]8;;\x1b\\]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		logline string
+		expect  string
+	}{
+		{`{"message": "Hi!", "traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`, "Hi! [sampled=true span_id=00f067aa trace_id=4bf92f35]\n"},
+		{`{"message": "sending traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}`, "sending traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00 [sampled=false span_id=00f067aa trace_id=4bf92f35]\n"},
+		{`{"message": "Hi!", "traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}`, "Hi!\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.TraceIDs = true
+
+		var entry structure.Entry
+		logline := []byte(test.logline)
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestColorRules(t *testing.T) {
+	colorize(t)
+	tests := []struct {
+		logline string
+		expect  string
+	}{
+		{`{"message": "Hi!", "status": 503, "env": "dev"}`, "- [env=dev \x1b[31mstatus=503\x1b[0m]\n"},
+		{`{"message": "Hi!", "status": 200, "env": "dev"}`, "- [env=dev status=200]\n"},
+		{`{"message": "Hi!", "status": 200, "env": "prod"}`, "\x1b[1m- [env=prod status=200]\x1b[0m\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf, structure.WithTemplate("-"))
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.Colorize = true
+		for _, spec := range []string{"status>=500:red", "env=prod:bold:line"} {
+			rule, err := structure.ParseColorRule(spec)
+			if err != nil {
+				t.Fatalf("failed to parse color rule: %v", err)
+			}
+			formatter.ColorRules = append(formatter.ColorRules, rule)
+		}
+
+		var entry structure.Entry
+		logline := []byte(test.logline)
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestArrays(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "tags": ["a", "b"], "ids": [1, 2, 3], "scopes": [{"name": "read"}]}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.MaxArrayLength = 2
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! [tags=[a,b]]\n\tids: [\n\t\t1,\n\t\t2,\n\t\t3\n\t]\n\tscopes: [\n\t\t{\n\t\t\t\"name\": \"read\"\n\t\t}\n\t]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "http": {"status": 200, "request": {"method": "GET", "headers": {"host": "a"}}}}`)
+	tests := map[int]string{
+		1: "Hi!\n",
+		2: "Hi! [http.status=200]\n",
+		3: "Hi! [http.request.method=GET http.status=200]\n",
+		0: "Hi! [http.request.headers.host=a http.request.method=GET http.status=200]\n",
+	}
+	for depth, expect := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.MaxDepth = depth
+		formatter.MaxFieldLength = 0
+
+		var entry structure.Entry
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+		}
+	}
+}
+
+func TestObjFields(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "request": {"path": "/"}, "response": {"status": 200}, "query": "SELECT *\nFROM users"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.ObjFields = []string{"request", "response", "query"}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi!\n\trequest: {\n\t\t\"path\": \"/\"\n\t}\n\tresponse: {\n\t\t\"status\": 200\n\t}\n\tquery: SELECT *\n\tFROM users\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestYAMLTrailer(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"message": "Hi!", "record": {"path": "/", "headers": {"accept": ["text/html", "*/*"]}}}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.TrailerFormat = structure.TrailerYAML
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi!\n\trecord:\n\t  headers:\n\t    accept:\n\t      - text/html\n\t      - '*/*'\n\t  path: /\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestStacktraceColors(t *testing.T) {
+	colorize(t)
+	logline := []byte(`{"message": "boom", "stack_trace": "java.lang.IllegalStateException: bad\n\tat com.acme.Service.charge(Service.java:42)\n\tat java.lang.Thread.run(Thread.java:833)\n\tat org.example.Other.call(Other.java:1)"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate("-"))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Colorize = true
+	formatter.StackUserPackages = []string{"com.acme."}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "-\n" +
+		"    \x1b[31mjava.lang.IllegalStateException: bad\x1b[0m\n" +
+		"      \x1b[93mat com.acme.Service.charge(Service.java:42)\x1b[0m\n" +
+		"      \x1b[90mat java.lang.Thread.run(Thread.java:833)\x1b[0m\n" +
+		"      at org.example.Other.call(Other.java:1)\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestStacktraceFolding(t *testing.T) {
+	t.Parallel()
+
+	stack := "panic: boom\n\ngoroutine 1 [running]:"
+	for _, fn := range []string{"main.a", "main.b", "runtime.c", "main.d", "main.e", "main.f"} {
+		stack += "\n" + fn + "()\n\t/app/main.go:1"
+	}
+	logline, _ := json.Marshal(map[string]string{"message": "boom", "stacktrace": stack})
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate("-"))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.StackHead = 2
+	formatter.StackTail = 1
+	formatter.StackHide = []string{"runtime.*"}
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "-\n" +
+		"    panic: boom\n" +
+		"    \n" +
+		"    goroutine 1 [running]:\n" +
+		"    main.a()\n" +
+		"      /app/main.go:1\n" +
+		"    main.b()\n" +
+		"      /app/main.go:1\n" +
+		"    … 3 frames hidden\n" +
+		"    main.f()\n" +
+		"      /app/main.go:1\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	tests := []struct {
+		logline string
+		links   bool
+		expect  string
+	}{
+		{`{"message": "Hi!", "caller": "kafka/consumer.go:63", "lang": "fr"}`, false, "Hi! [lang=fr] (kafka/consumer.go:63)\n"},
+		{`{"message": "Hi!", "source": {"file": "/app/main.go", "line": 12, "function": "main.main"}}`, false, "Hi! (/app/main.go:12)\n"},
+		{`{"message": "Hi!", "file": "app.py", "line": 3}`, true, "Hi! \x1b]8;;https://example.com/app.py#L3\x1b\\(app.py:3)\x1b]8;;\x1b\\\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.ShowCaller = true
+		formatter.CallerLinks = test.links
+		formatter.CallerURL = "https://example.com/{file}#L{line}"
+
+		var entry structure.Entry
+		logline := []byte(test.logline)
+		_ = json.Unmarshal(logline, &entry)
+		err = formatter.Format(&entry, logline, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), test.expect)
+		}
+	}
+}
+
+func TestUnits(t *testing.T) {
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate(`{{.Message}} {{bytes 1536}} {{duration 93000000}} {{duration "2.5" "s"}}`))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Units = map[string]structure.Unit{
+		"size":   structure.Bytes,
+		"*_ms":   structure.Milliseconds,
+		"status": structure.Bytes,
+	}
+
+	logline := []byte(`{"message": "Hi!", "size": 5242880, "latency_ms": 1250, "status": "ok"}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Hi! 1.5KiB 93ms 2.5s [latency_ms=1.3s size=5MiB status=ok]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestRepeats(t *testing.T) {
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+
+	logline := []byte(`{"message": "Retrying", "attempt": "db"}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	entry.Repeats = 3
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "Retrying [attempt=db] ×3\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestHighlightMatches(t *testing.T) {
+	colorize(t)
+	logline := []byte(`{"message": "connection timeout", "host": "db-timeout-1"}`)
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate("{{.Message}}"))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Colorize = true
+	formatter.Highlight = regexp.MustCompile("time(out)?")
+
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "\x1b[96;1mconnection \x1b[0m\x1b[30;43mtimeout\x1b[0m [host=db-\x1b[30;43mtimeout\x1b[0m-1]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestMessagePattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		expect  string
+	}{
+		{"user 42 logged in from 10.0.0.1:5432", "user <n> logged in from <ip>"},
+		{"order 3f2b1c9a-0000-4000-8000-123456789abc shipped", "order <uuid> shipped"},
+		{`cache miss for "profile:7" in 1.5ms`, "cache miss for <str> in <n>ms"},
+		{"commit deadbeef1 added at 2024-05-01T12:00:00Z", "commit <id> added at <time>"},
+		{"added a decade ago", "added a decade ago"},
+	}
+	for _, test := range tests {
+		if got := structure.MessagePattern(test.message); got != test.expect {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", got, test.expect)
+		}
+	}
+}
+
+func TestSetColor(t *testing.T) {
+	colorize(t)
+	// Not parallel, the colors and severities are shared by all formatters.
+	defer func() {
+		_ = structure.SetColor("message", "hicyan+bold")
+		_ = structure.SetColor("error", "hired+bold")
+	}()
+	if err := structure.SetColor("message", "green"); err != nil {
+		t.Fatalf("failed to set color: %v", err)
+	}
+	if err := structure.SetColor("err", "yellow+underline"); err != nil {
+		t.Fatalf("failed to set color: %v", err)
+	}
+	if err := structure.SetColor("banner", "green"); err == nil {
+		t.Errorf("expected an error for an unknown element")
+	}
+	structure.MapSeverity("oops", "error")
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Colorize = true
+	logline := []byte(`{"severity": "OOPS", "message": "disk full"}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "  \x1b[33;4mERROR\x1b[0m: \x1b[32mdisk full\x1b[0m\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestSetColors(t *testing.T) {
+	colorize(t)
+	// Not parallel, the colors and severities are shared by all formatters.
+	defer func() {
+		_ = structure.SetColors(nil)
+		structure.SetSeverities(nil)
+	}()
+	format := func() string {
+		buf := &bytes.Buffer{}
+		formatter, err := structure.NewFormatter(buf)
+		if err != nil {
+			t.Fatalf("failed to create new formatter: %v", err)
+		}
+		formatter.Colorize = true
+		logline := []byte(`{"severity": "OOPS", "message": "disk full"}`)
+		var entry structure.Entry
+		_ = json.Unmarshal(logline, &entry)
+		if err := formatter.Format(&entry, logline, nil, nil); err != nil {
+			t.Fatalf("failed to format entry: %v", err)
+		}
+		return buf.String()
+	}
+
+	structure.SetSeverities(map[string]string{"oops": "err"})
+	if err := structure.SetColors(map[string]string{"message": "green", "error": "yellow"}); err != nil {
+		t.Fatalf("failed to set colors: %v", err)
+	}
+	expect := "  \x1b[33mERROR\x1b[0m: \x1b[32mdisk full\x1b[0m\n"
+	if got := format(); got != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", got, expect)
+	}
+
+	// None of the colors is set when one of them is invalid.
+	if err := structure.SetColors(map[string]string{"message": "blue", "banner": "red"}); err == nil {
+		t.Errorf("expected an error for an unknown element")
+	}
+	if err := structure.SetColors(map[string]string{"message": "blue", "error": "pink"}); err == nil {
+		t.Errorf("expected an error for an unknown color")
+	}
+	if got := format(); got != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", got, expect)
+	}
+
+	// The severities and the colors not set again are back to their
+	// defaults.
+	structure.SetSeverities(nil)
+	if err := structure.SetColors(map[string]string{"message": "green"}); err != nil {
+		t.Fatalf("failed to set colors: %v", err)
+	}
+	expect = "\x1b[32mdisk full\x1b[0m\n"
+	if got := format(); !strings.HasSuffix(got, expect) || strings.Contains(got, "ERROR") {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", got, expect)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.Keys = structure.Keys{Timestamp: "t", Severity: "meta.lvl", Message: "msg", Caller: "at", Error: "problem"}
+	formatter.ExcludeFields = append(formatter.ExcludeFields, "t", "meta")
+	formatter.ShowCaller = true
+
+	logline := []byte(`{"t": "2024-05-01T12:00:00Z", "meta": {"lvl": "warn"}, "msg": "retrying", "at": "db.go:7", "problem": "timeout"}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "[2024-05-01 12:00:00] WARNING: retrying: timeout (db.go:7)\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestKeyPaths(t *testing.T) {
+	t.Parallel()
+
+	var keys structure.Keys
+	for name, path := range map[string]string{"timestamp": "meta.time", "severity": "level", "message": "msg", "logger": "meta.logger", "caller": "src.at", "error": "failure.reason"} {
+		if err := keys.Set(name, path); err != nil {
+			t.Fatalf("failed to set key %s: %v", name, err)
+		}
+	}
+	if err := keys.Set("level", "lvl"); err == nil {
+		t.Errorf("expected an error for an unknown key")
+	}
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithKeys(keys))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.ShowCaller = true
+
+	logline := []byte(`{"meta": {"time": "2024-05-01T12:00:00Z", "logger": "com.acme.db"}, "level": "error", "msg": "query failed", "src": {"at": "db.go:7"}, "failure": {"reason": "timeout"}}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	formatter.Normalize(&entry, logline)
+	if name, ok := entry.LoggerName(); !ok || name != "com.acme.db" {
+		t.Errorf("expected the logger com.acme.db, got %q", name)
+	}
+	formatter.ExcludeFields = append(formatter.ExcludeFields, "meta")
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "[2024-05-01 12:00:00]   ERROR: query failed: timeout (db.go:7)\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestSource(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf)
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	formatter.SourceWidth = 6
+
+	logline := []byte(`{"severity": "INFO", "message": "started"}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	entry.Source = "api"
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "api       INFO: started\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"time": "2024-05-01T12:00:00Z", "level": 50, "msg": "failed", "err": "boom x", "user": {"id": 42}}`)
+	tests := []struct {
+		format string
+		expect string
+	}{
+		{"json", `{"time":"2024-05-01T12:00:00Z","level":"error","msg":"failed","err":"boom x","user":{"id":42}}` + "\n"},
+		{"logfmt", `time=2024-05-01T12:00:00Z level=error msg=failed err="boom x" user="{\"id\":42}"` + "\n"},
+		{"csv", "time,level,msg,err,user\n" + `2024-05-01T12:00:00Z,error,failed,boom x,"{""id"":42}"` + "\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		converter, err := structure.NewConverter(buf, test.format)
+		if err != nil {
+			t.Fatalf("failed to create new converter: %v", err)
+		}
+		formatter, _ := structure.NewFormatter(nil)
+		var entry structure.Entry
+		djson.Unmarshal(logline, &entry)
+		formatter.Normalize(&entry, logline)
+		if err := converter.Write(&entry); err != nil {
+			t.Fatalf("failed to convert entry: %v", err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("%s\n\tnot match: %q\n\t   expect: %q\n", test.format, buf.String(), test.expect)
+		}
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	t.Parallel()
+
+	for format, expect := range map[string]string{
+		structure.DefaultTemplate:                   "",
+		`{{if .Severity}}{{field "status"}}{{end}}`: "",
+		`{{.message}}`:                              "unknown field .message, did you mean .Message?",
+		`{{.Status}}`:                               `unknown field .Status, the fields of the JSON are read with {{field "Status"}}`,
+		`{{upper .Name}}`:                           `unknown function "upper", the functions of jl are ago, bytes, duration, field, get, sinceStart, timestamp, along with those of Go templates`,
+	} {
+		if problems := strings.Join(structure.CheckTemplate(format), "; "); problems != expect {
+			t.Errorf("%s\n\tnot match: %q\n\t   expect: %q\n", format, problems, expect)
+		}
+	}
+}
+
+func TestAddTemplate(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf, structure.WithTemplate(`{{template "level" .}} {{.Message}}`))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	if err := formatter.AddTemplate("level", "<{{.Severity}}>"); err != nil {
+		t.Fatalf("failed to add template: %v", err)
+	}
+	formatter.ShowFields = false
+
+	logline := []byte(`{"severity": "WARN", "message": "disk full"}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "<WARNING> disk full\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	formatter, err := structure.NewFormatter(buf,
+		structure.WithTemplate(`{{template "level" .}} {{.Message}}`),
+		structure.WithTemplates(map[string]string{"level": "<{{.Severity}}>"}),
+		structure.WithKeys(structure.Keys{Message: "text"}),
+		structure.WithExcludes("pid"),
+		structure.WithMaxFieldLength(0))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+
+	logline := []byte(`{"severity": "INFO", "message": "ignored", "text": "started", "pid": 7, "port": 8080}`)
+	var entry structure.Entry
+	_ = json.Unmarshal(logline, &entry)
+	err = formatter.Format(&entry, logline, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to format entry: %v", err)
+	}
+	expect := "<   INFO> started [port=8080]\n"
+	if buf.String() != expect {
+		t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", buf.String(), expect)
+	}
+
+}
+
+func TestInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name   string
+		option structure.Option
+		expect string
+	}{
+		{"template", structure.WithTemplate("{{.Message"), "unclosed action"},
+		{"templates", structure.WithTemplates(map[string]string{"broken": "{{end}}"}), "template broken"},
+		{"max field length", structure.WithMaxFieldLength(-1), "invalid max field length -1"},
+		{"field color", structure.WithFieldColors(map[string]string{"id": "plaid"}), `invalid color of id`},
+		{"color rule", structure.WithColorRules("status>=500"), "status>=500"},
+		{"time format", structure.WithTimeFormat(""), "invalid empty time format"},
+		{"include regexp", structure.WithIncludeRegexp("("), "missing closing )"},
+		{"exclude regexp", structure.WithExcludeRegexp("["), "missing closing ]"},
+		{"flatten", structure.WithFlatten(structure.Collision(7), "labels"), "invalid collision mode 7"},
+		{"wrap width", structure.WithWrapWidth(-1), "invalid wrap width -1"},
+		{"truncate width", structure.WithTruncateWidth(-1), "invalid truncate width -1"},
+		{"trailer format", structure.WithTrailerFormat(structure.TrailerFormat(-1)), "invalid trailer format -1"},
+		{"stack head", structure.WithStack(-1, 3), "invalid head of -1 frames"},
+		{"stack tail", structure.WithStack(10, -3), "invalid tail of -3 frames"},
+		{"stack hide", structure.WithStackHide("runtime.[a"), "invalid glob"},
+		{"max depth", structure.WithMaxDepth(-1), "invalid max depth -1"},
+		{"max array length", structure.WithMaxArrayLength(-5), "invalid max array length -5"},
+		{"truncate values", structure.WithTruncateValues(-1), "invalid length -1"},
+		{"truncate fields", structure.WithTruncateFields(map[string]int{"query": -40}), "invalid length of query: -40"},
+		{"units", structure.WithUnits(map[string]string{"size": "furlongs"}), `unknown unit "furlongs"`},
+		{"severity width", structure.WithSeverity(-7, structure.AlignRight, false), "invalid severity width -7"},
+		{"severity align", structure.WithSeverity(7, structure.Alignment(2), false), "invalid alignment 2"},
+		{"relative time", structure.WithRelativeTime(structure.RelativeMode(3)), "invalid relative mode 3"},
+		{"icons", structure.WithIcons(structure.IconMode(3)), "invalid icon mode 3"},
+		{"elapsed", structure.WithElapsed(true, -time.Second), "invalid threshold -1s"},
+		{"source width", structure.WithSourceWidth(-1), "invalid source width -1"},
+	} {
+		_, err := structure.NewFormatter(nil, test.option)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.expect) {
+			t.Errorf("%s:\n\tnot match: %q\n\t   expect: %q\n", test.name, err, test.expect)
+		}
+	}
+}
+
+func TestFormattingOptions(t *testing.T) {
+	t.Parallel()
+
+	utc8 := time.FixedZone("UTC+8", 8*60*60)
+	formatter, err := structure.NewFormatter(nil,
+		structure.WithPrefix(false),
+		structure.WithFields(false),
+		structure.WithFlatten(structure.CollisionWarn, "tags"),
+		structure.WithFieldOrder("request_id"),
+		structure.WithIncludeRegexp("^http\\."),
+		structure.WithStack(0, 0),
+		structure.WithTruncateFields(map[string]int{"query": 40}),
+		structure.WithUnits(map[string]string{"size": "bytes"}),
+		structure.WithSeverity(5, structure.AlignLeft, true),
+		structure.WithLocation(utc8),
+		structure.WithTimeFormat("Kitchen"),
+		structure.WithTimeLayouts("02/Jan/2006:15:04:05 -0700"),
+		structure.WithElapsed(true, time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create new formatter: %v", err)
+	}
+	switch {
+	case formatter.ShowPrefix || formatter.ShowFields || !formatter.ShowSuffix:
+		t.Error("wrong parts shown")
+	case formatter.FlattenCollision != structure.CollisionWarn || len(formatter.FlattenFields) != 1:
+		t.Errorf("wrong flatten: %v %v", formatter.FlattenCollision, formatter.FlattenFields)
+	case formatter.IncludeFieldsRegexp == nil || formatter.ExcludeFieldsRegexp != nil:
+		t.Error("wrong field regexps")
+	case formatter.StackHead != 0 || formatter.StackTail != 0:
+		t.Errorf("wrong stack: %d %d", formatter.StackHead, formatter.StackTail)
+	case formatter.Units["size"] != structure.Bytes || formatter.TruncateFields["query"] != 40:
+		t.Error("wrong field units or lengths")
+	case formatter.SeverityWidth != 5 || formatter.SeverityAlign != structure.AlignLeft || !formatter.SeverityTruncate:
+		t.Error("wrong severity column")
+	case formatter.Location != utc8 || formatter.TimeFormat != "Kitchen":
+		t.Errorf("wrong time: %v %q", formatter.Location, formatter.TimeFormat)
+	case formatter.TimeLayouts[0] != "02/Jan/2006:15:04:05 -0700" || len(formatter.TimeLayouts) < 2:
+		t.Errorf("wrong time layouts: %v", formatter.TimeLayouts)
+	case !formatter.ShowElapsed || formatter.ElapsedThreshold != time.Minute:
+		t.Error("wrong elapsed")
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	t.Parallel()
+
+	logline := []byte(`{"time": "2024-05-01T12:00:00Z", "level": "warn", "msg": "slow <query>", "ms": 900}`)
+	buf := &bytes.Buffer{}
+	formatter, _ := structure.NewFormatter(buf)
+	converter, _ := structure.NewConverter(buf, "json")
+	html := structure.NewHTMLWriter(buf)
+	for _, test := range []struct {
+		renderer structure.Renderer
+		expect   string
+	}{
+		{formatter, "[2024-05-01 12:00:00] WARNING: slow <query> [ms=900]\n"},
+		{converter, `{"time":"2024-05-01T12:00:00Z","level":"warning","msg":"slow <query>","ms":900}` + "\n"},
+		{html, `<tr class="warning"><td class="time">2024-05-01T12:00:00Z</td><td class="level">WARNING</td><td class="msg">slow &lt;query&gt;</td><td class="fields">ms=900</td></tr>` + "\n"},
+	} {
+		buf.Reset()
+		var entry structure.Entry
+		djson.Unmarshal(logline, &entry)
+		formatter.Normalize(&entry, logline)
+		if err := test.renderer.Format(&entry, logline, nil, nil); err != nil {
+			t.Fatalf("failed to render entry: %v", err)
+		}
+		if got := buf.String(); !strings.HasSuffix(got, test.expect) {
+			t.Errorf("\n\tnot match: %q\n\t   expect: %q\n", got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package structure
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+var namedLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+}
+
+func (f *Formatter) funcs() template.FuncMap {
+	return template.FuncMap{
+		"timestamp":  f.timestamp,
+		"ago":        ago,
+		"sinceStart": f.sinceStart,
+		"bytes":      bytesFunc,
+		"duration":   durationFunc,
+		"field":      f.field,
+		"get":        f.get,
+	}
+}
+
+// field returns the value at the dotted path in the fields of the entry
+// being formatted, ex: {{field "http.status"}}. A missing field is empty,
+// and reported in strict mode.
+func (f *Formatter) field(path string) string {
+	if f.entry == nil {
+		return ""
+	}
+	value, ok := Lookup(f.entry.Fields, path)
+	if !ok || value == nil {
+		f.missing = append(f.missing, path)
+		return ""
+	}
+	return formatValue(value)
+}
+
+// get returns the value at the JSON path in the raw entry, or the default
+// when given and the path doesn't exist, ex: {{get "http.status" "-"}}.
+// Dots within keys are escaped with a backslash, unless the whole path is a
+// single key. Objects and arrays are returned as JSON.
+func (f *Formatter) get(path string, def ...interface{}) interface{} {
+	result := gjson.GetBytes(f.raw, path)
+	if !result.Exists() {
+		result = gjson.GetBytes(f.raw, strings.ReplaceAll(path, ".", "\\."))
+	}
+	if !result.Exists() || result.Type == gjson.Null {
+		if len(def) > 0 {
+			return def[0]
+		}
+		f.missing = append(f.missing, path)
+		return ""
+	}
+	switch result.Type {
+	case gjson.JSON:
+		return result.Raw
+	case gjson.Number:
+		return formatValue(result.Num)
+	}
+	return result.String()
+}
+
+// timestamp formats t according to the RelativeTime of the Formatter.
+func (f *Formatter) timestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	switch f.RelativeTime {
+	case RelativeToNow:
+		return ago(t)
+	case RelativeToStart:
+		return f.sinceStart(t)
+	}
+	return formatTime(*t, f.TimeFormat)
+}
+
+// formatTime formats t using the given layout, which can also be a named
+// layout or one of the epoch formats.
+func formatTime(t time.Time, layout string) string {
+	switch layout {
+	case "":
+		layout = DefaultTimeFormat
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case "unixmicro":
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	case "unixnano":
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+	if named, ok := namedLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout)
+}
+
+// ago formats t relative to now, ex: "2m13s ago".
+func ago(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	d := time.Since(*t)
+	if d < 0 {
+		return "in " + humanDuration(-d)
+	}
+	return humanDuration(d) + " ago"
+}
+
+// sinceStart formats t relative to the first timestamp seen by the
+// Formatter, ex: "+2m13s".
+func (f *Formatter) sinceStart(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	if f.start == nil {
+		f.start = t
+	}
+	d := t.Sub(*f.start)
+	if d < 0 {
+		return "-" + humanDuration(-d)
+	}
+	return "+" + humanDuration(d)
+}
+
+// humanDuration rounds d to a precision that is still useful to read.
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute:
+		d = d.Round(time.Second)
+	case d >= time.Second:
+		d = d.Round(100 * time.Millisecond)
+	case d >= time.Millisecond:
+		d = d.Round(time.Millisecond)
+	}
+	return d.String()
+}
@@ -0,0 +1,201 @@
+package structure
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var jsonKeyColor = color.New(color.FgBlue).SprintFunc()
+var literalStringColor = color.New(color.FgGreen).SprintFunc()
+var literalNumberColor = color.New(color.FgMagenta).SprintFunc()
+var literalKeywordColor = color.New(color.FgYellow).SprintFunc()
+var sqlKeywordColor = color.New(color.FgHiBlue, color.Bold).SprintFunc()
+
+// sqlStatement finds where an SQL statement starts in a message, it
+// requires a bit more than a single keyword so prose like "select a plan"
+// isn't highlighted.
+var sqlStatement = regexp.MustCompile(`(?i)\b(SELECT\b.+\bFROM|INSERT\s+INTO|UPDATE\s+\S+\s+SET|DELETE\s+FROM|(CREATE|ALTER|DROP)\s+(TABLE|INDEX|VIEW))\b`)
+
+var sqlKeywords = map[string]bool{
+	"ADD": true, "ALL": true, "ALTER": true, "AND": true, "AS": true,
+	"ASC": true, "BETWEEN": true, "BY": true, "CASE": true, "CREATE": true,
+	"DEFAULT": true, "DELETE": true, "DESC": true, "DISTINCT": true,
+	"DROP": true, "ELSE": true, "END": true, "EXISTS": true, "FROM": true,
+	"FULL": true, "GROUP": true, "HAVING": true, "IN": true, "INDEX": true,
+	"INNER": true, "INSERT": true, "INTO": true, "IS": true, "JOIN": true,
+	"LEFT": true, "LIKE": true, "LIMIT": true, "NOT": true, "NULL": true,
+	"OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true,
+	"RETURNING": true, "RIGHT": true, "SELECT": true, "SET": true,
+	"TABLE": true, "THEN": true, "UNION": true, "UPDATE": true,
+	"VALUES": true, "VIEW": true, "WHEN": true, "WHERE": true, "WITH": true,
+}
+
+// highlightMessage colors JSON and SQL embedded in a message by token, the
+// rest of the message gets the regular message color.
+func highlightMessage(message string) string {
+	var out strings.Builder
+	plain := 0
+	for i := 0; i < len(message); i++ {
+		if message[i] != '{' && message[i] != '[' {
+			continue
+		}
+		end := jsonEnd(message[i:])
+		if end == 0 {
+			continue
+		}
+		out.WriteString(highlightText(message[plain:i]))
+		out.WriteString(highlightJSON(message[i : i+end]))
+		i += end - 1
+		plain = i + 1
+	}
+	out.WriteString(highlightText(message[plain:]))
+	return out.String()
+}
+
+// jsonEnd returns the length of the non-empty JSON object or array s starts
+// with, or 0 when it doesn't start with one.
+func jsonEnd(s string) int {
+	dec := json.NewDecoder(strings.NewReader(s))
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return 0
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return 0
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return 0
+		}
+	}
+	return int(dec.InputOffset())
+}
+
+// highlightText colors a part of the message without JSON, highlighting
+// the SQL statement it may contain.
+func highlightText(text string) string {
+	if text == "" {
+		return ""
+	}
+	loc := sqlStatement.FindStringIndex(text)
+	if loc == nil {
+		return messageColor(text)
+	}
+	prose := ""
+	if loc[0] > 0 {
+		prose = messageColor(text[:loc[0]])
+	}
+	return prose + highlightSQL(text[loc[0]:])
+}
+
+// highlightJSON colors the keys, strings, numbers and literals of a valid
+// JSON text, keeping its formatting.
+func highlightJSON(text string) string {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '"':
+			end := stringEnd(text, i, '"')
+			token := text[i:end]
+			if strings.HasPrefix(strings.TrimLeft(text[end:], " \t\r\n"), ":") {
+				out.WriteString(jsonKeyColor(token))
+			} else {
+				out.WriteString(literalStringColor(token))
+			}
+			i = end
+		case c == '-' || isDigit(c):
+			end := i + 1
+			for end < len(text) && strings.IndexByte("0123456789.eE+-", text[end]) >= 0 {
+				end++
+			}
+			out.WriteString(literalNumberColor(text[i:end]))
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i
+			for end < len(text) && text[end] >= 'a' && text[end] <= 'z' {
+				end++
+			}
+			out.WriteString(literalKeywordColor(text[i:end]))
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// highlightSQL colors the keywords, string literals and numbers of an SQL
+// statement.
+func highlightSQL(text string) string {
+	var out strings.Builder
+	plain := 0
+	flush := func(i int) {
+		if i > plain {
+			out.WriteString(messageColor(text[plain:i]))
+		}
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\'':
+			flush(i)
+			end := stringEnd(text, i, '\'')
+			out.WriteString(literalStringColor(text[i:end]))
+			i, plain = end, end
+		case isWordStart(c):
+			end := i + 1
+			for end < len(text) && (isWordStart(text[end]) || isDigit(text[end])) {
+				end++
+			}
+			if sqlKeywords[strings.ToUpper(text[i:end])] {
+				flush(i)
+				out.WriteString(sqlKeywordColor(text[i:end]))
+				plain = end
+			}
+			i = end
+		case isDigit(c) && (i == 0 || !isWordStart(text[i-1])):
+			flush(i)
+			end := i + 1
+			for end < len(text) && (isDigit(text[end]) || text[end] == '.') {
+				end++
+			}
+			out.WriteString(literalNumberColor(text[i:end]))
+			i, plain = end, end
+		default:
+			i++
+		}
+	}
+	flush(len(text))
+	return out.String()
+}
+
+// stringEnd returns the index after the string literal starting at start,
+// which is quoted with quote and may contain escaped quotes.
+func stringEnd(text string, start int, quote byte) int {
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && quote == '"':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
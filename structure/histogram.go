@@ -0,0 +1,128 @@
+package structure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sparks are the bars of sparklines, from the lowest to the highest.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// maxBuckets bounds the width of the sparklines.
+const maxBuckets = 500
+
+// Histogram counts entries per severity in buckets of time, to be shown as
+// one sparkline per severity.
+type Histogram struct {
+	Bucket time.Duration
+
+	counts     map[string]map[int64]int
+	severities SeverityCounts
+	first      int64
+	last       int64
+}
+
+// NewHistogram returns a Histogram with buckets of the duration, ex: a
+// minute.
+func NewHistogram(bucket time.Duration) *Histogram {
+	return &Histogram{Bucket: bucket, counts: make(map[string]map[int64]int), severities: make(SeverityCounts)}
+}
+
+// Add counts the entry in the bucket of its timestamp, entries without one
+// aren't counted.
+func (h *Histogram) Add(entry *Entry) {
+	if entry.Timestamp == nil {
+		return
+	}
+	bucket := entry.Timestamp.Truncate(h.Bucket).Unix()
+	severity := NormalizeSeverity(entry.Severity)
+	if len(h.severities) == 0 || bucket < h.first {
+		h.first = bucket
+	}
+	if len(h.severities) == 0 || bucket > h.last {
+		h.last = bucket
+	}
+	h.severities.Add(severity)
+	if h.counts[severity] == nil {
+		h.counts[severity] = make(map[int64]int)
+	}
+	h.counts[severity][bucket]++
+}
+
+// Lines renders a sparkline per severity, the most severe first, followed
+// by the time range they cover. The last maxBuckets buckets are shown.
+func (h *Histogram) Lines(loc *time.Location) []string {
+	if len(h.severities) == 0 {
+		return []string{"no entries with a timestamp"}
+	}
+	step := int64(h.Bucket / time.Second)
+	if step < 1 {
+		step = 1
+	}
+	first := h.first
+	if (h.last-first)/step >= maxBuckets {
+		first = h.last - (maxBuckets-1)*step
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	var lines []string
+	for _, severity := range h.severities.Severities() {
+		counts := h.counts[severity]
+		max := 0
+		for bucket, count := range counts {
+			if bucket >= first && count > max {
+				max = count
+			}
+		}
+		var line strings.Builder
+		for bucket := first; bucket <= h.last; bucket += step {
+			line.WriteRune(spark(counts[bucket], max))
+		}
+		name := severity
+		if name == "" {
+			name = "other"
+		}
+		lines = append(lines, fmt.Sprintf("%-9s %s %d", name, line.String(), h.severities[severity]))
+	}
+	layout := "2006-01-02 15:04"
+	if h.Bucket < time.Minute {
+		layout = "2006-01-02 15:04:05"
+	}
+	lines = append(lines, fmt.Sprintf("%-9s %s → %s, %v per bar", "",
+		time.Unix(first, 0).In(loc).Format(layout), time.Unix(h.last, 0).In(loc).Format(layout), h.Bucket))
+	return lines
+}
+
+// Table returns the count of entries per bucket and severity, leaving out
+// the empty buckets.
+func (h *Histogram) Table(loc *time.Location) *Table {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t := &Table{Name: "histogram", Header: []string{"time", "severity", "count"}}
+	step := int64(h.Bucket / time.Second)
+	if step < 1 {
+		step = 1
+	}
+	severities := h.severities.Severities()
+	for bucket := h.first; len(severities) > 0 && bucket <= h.last; bucket += step {
+		for _, severity := range severities {
+			if count := h.counts[severity][bucket]; count > 0 {
+				t.Rows = append(t.Rows, []string{time.Unix(bucket, 0).In(loc).Format(time.RFC3339), severity, strconv.Itoa(count)})
+			}
+		}
+	}
+	return t
+}
+
+// spark returns the bar for count, relative to the max count, a space for
+// none.
+func spark(count, max int) rune {
+	if count == 0 || max == 0 {
+		return ' '
+	}
+	return sparks[(count*len(sparks)-1)/max]
+}
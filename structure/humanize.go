@@ -0,0 +1,137 @@
+package structure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unit is what the numeric value of a field measures, which lets it be
+// displayed in human units, ex: 1536 bytes as "1.5KiB".
+type Unit int
+
+const (
+	// Bytes displays sizes as B, KiB, MiB, etc.
+	Bytes Unit = iota + 1
+	// Nanoseconds, Microseconds, Milliseconds and Seconds display durations
+	// as Go durations, ex: "93ms" or "2m13s".
+	Nanoseconds
+	Microseconds
+	Milliseconds
+	Seconds
+)
+
+var unitNames = map[string]Unit{
+	"bytes": Bytes,
+	"ns":    Nanoseconds,
+	"us":    Microseconds,
+	"µs":    Microseconds,
+	"ms":    Milliseconds,
+	"s":     Seconds,
+}
+
+var durationUnits = map[Unit]time.Duration{
+	Nanoseconds:  time.Nanosecond,
+	Microseconds: time.Microsecond,
+	Milliseconds: time.Millisecond,
+	Seconds:      time.Second,
+}
+
+// ParseUnit parses one of "bytes", "ns", "us", "ms" or "s".
+func ParseUnit(s string) (Unit, error) {
+	if unit, ok := unitNames[strings.ToLower(s)]; ok {
+		return unit, nil
+	}
+	return 0, fmt.Errorf("unknown unit %q, expected bytes, ns, us, ms or s", s)
+}
+
+// humanize formats value in the given unit, it returns false when value
+// isn't a number.
+func humanize(value interface{}, unit Unit) (string, bool) {
+	n, ok := number(value)
+	if !ok {
+		return "", false
+	}
+	if unit == Bytes {
+		return humanBytes(n), true
+	}
+	d := time.Duration(n * float64(durationUnits[unit]))
+	if d < 0 {
+		return "-" + humanDuration(-d), true
+	}
+	return humanDuration(d), true
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// humanBytes formats a size using binary prefixes with at most one decimal,
+// ex: "1.5KiB".
+func humanBytes(n float64) string {
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	if n < 1024 {
+		return sign + strconv.FormatFloat(n, 'f', -1, 64) + "B"
+	}
+	prefixes := "KMGTPE"
+	i := -1
+	for n >= 1024 && i < len(prefixes)-1 {
+		n /= 1024
+		i++
+	}
+	text := strconv.FormatFloat(n, 'f', 1, 64)
+	text = strings.TrimSuffix(text, ".0")
+	return sign + text + prefixes[i:i+1] + "iB"
+}
+
+// unit returns the Unit configured for field, if any.
+func (f *Formatter) unit(field string) (Unit, bool) {
+	if unit, ok := f.Units[field]; ok {
+		return unit, true
+	}
+	for pattern, unit := range f.Units {
+		if matches([]string{pattern}, field) {
+			return unit, true
+		}
+	}
+	return 0, false
+}
+
+// bytesFunc is the "bytes" template helper, ex: {{bytes 1536}} is "1.5KiB".
+func bytesFunc(value interface{}) string {
+	if text, ok := humanize(value, Bytes); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+// durationFunc is the "duration" template helper, the value is read in
+// nanoseconds unless a unit is given, ex: {{duration 93 "ms"}} is "93ms".
+func durationFunc(value interface{}, unit ...string) (string, error) {
+	u := Nanoseconds
+	if len(unit) > 0 {
+		var err error
+		if u, err = ParseUnit(unit[0]); err != nil {
+			return "", err
+		}
+	}
+	if text, ok := humanize(value, u); ok {
+		return text, nil
+	}
+	return fmt.Sprint(value), nil
+}
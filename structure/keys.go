@@ -0,0 +1,130 @@
+package structure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Keys are the JSON keys read for the timestamp, severity, message, logger,
+// caller and error of entries over the usual ones, ex: "t" and "lvl" for
+// log15. Each can be a dotted path, ex: "meta.time". Empty keys aren't read.
+type Keys struct {
+	Timestamp string
+	Severity  string
+	Message   string
+	Logger    string
+	Caller    string
+	Error     string
+}
+
+// keyNames are the names of Keys set by Set.
+var keyNames = []string{"timestamp", "severity", "message", "logger", "caller", "error"}
+
+// Set sets the key named name, one of timestamp, severity, message, logger,
+// caller or error, to path.
+func (k *Keys) Set(name, path string) error {
+	switch strings.ToLower(name) {
+	case "timestamp":
+		k.Timestamp = path
+	case "severity":
+		k.Severity = path
+	case "message":
+		k.Message = path
+	case "logger":
+		k.Logger = path
+	case "caller":
+		k.Caller = path
+	case "error":
+		k.Error = path
+	default:
+		return fmt.Errorf("unknown key %q, expected one of %s", name, strings.Join(keyNames, ", "))
+	}
+	return nil
+}
+
+// read sets the timestamp, severity, message and logger of entry to the
+// values of the keys found in fields.
+func (k Keys) read(entry *Entry, fields map[string]interface{}) {
+	if value, ok := lookupKey(fields, k.Timestamp); ok {
+		entry.Timestamp, entry.RawTimestamp, entry.FloatTimestamp = nil, "", 0
+		switch v := value.(type) {
+		case string:
+			entry.RawTimestamp = v
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				entry.Timestamp = &t
+			}
+		case float64:
+			entry.FloatTimestamp = v
+		}
+	}
+	if value, ok := lookupKey(fields, k.Severity); ok {
+		entry.Severity = formatValue(value)
+	}
+	if value, ok := lookupKey(fields, k.Message); ok {
+		entry.Message = formatValue(value)
+	}
+	if value, ok := lookupKey(fields, k.Logger); ok {
+		entry.Logger = formatValue(value)
+	}
+}
+
+func lookupKey(fields map[string]interface{}, key string) (interface{}, bool) {
+	if key == "" {
+		return nil, false
+	}
+	return Lookup(fields, key)
+}
+
+// deleteKey removes the value at the dotted path key of fields, found as
+// with Lookup, along with the objects it leaves empty.
+func deleteKey(fields map[string]interface{}, key string) {
+	if _, ok := fields[key]; ok {
+		delete(fields, key)
+		return
+	}
+	for i := strings.IndexByte(key, '.'); i >= 0; {
+		if nested, ok := fields[key[:i]].(map[string]interface{}); ok {
+			if _, found := Lookup(nested, key[i+1:]); found {
+				deleteKey(nested, key[i+1:])
+				if len(nested) == 0 {
+					delete(fields, key[:i])
+				}
+				return
+			}
+		}
+		next := strings.IndexByte(key[i+1:], '.')
+		if next < 0 {
+			return
+		}
+		i += next + 1
+	}
+}
+
+// copyFields returns a deep copy of fields, of which the objects and arrays
+// can be changed without changing those of fields.
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	if fields == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		copied[key] = copyValue(value)
+	}
+	return copied
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyFields(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
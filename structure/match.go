@@ -0,0 +1,44 @@
+package structure
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var matchColor = color.New(color.FgBlack, color.BgYellow).SprintFunc()
+
+// HighlightMatches colors the substrings of text matching re, leaving the
+// rest of it as is.
+func HighlightMatches(re *regexp.Regexp, text string) string {
+	return highlightMatches(re, text, func(a ...interface{}) string { return a[0].(string) })
+}
+
+// highlightMatches colors the substrings of text matching re, the rest of
+// it in the base color.
+func highlightMatches(re *regexp.Regexp, text string, base func(a ...interface{}) string) string {
+	if re == nil {
+		return base(text)
+	}
+	matches := re.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return base(text)
+	}
+	var out strings.Builder
+	last := 0
+	for _, loc := range matches {
+		if loc[0] == loc[1] {
+			continue
+		}
+		if loc[0] > last {
+			out.WriteString(base(text[last:loc[0]]))
+		}
+		out.WriteString(matchColor(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	if last < len(text) {
+		out.WriteString(base(text[last:]))
+	}
+	return out.String()
+}
@@ -0,0 +1,517 @@
+package structure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Option configures a Formatter when it's created, ex:
+// NewFormatter(w, WithTemplate("{{.Message}}"), WithColor(true)). Options
+// report the invalid values given as errors of NewFormatter.
+type Option func(f *Formatter) error
+
+// WithTemplate formats the entries with a Go template instead of
+// DefaultTemplate, ex: "{{.Severity}} {{.Message}}".
+func WithTemplate(text string) Option {
+	return func(f *Formatter) error {
+		if text != "" {
+			f.text = text
+		}
+		return nil
+	}
+}
+
+// WithTemplates defines templates the template can include by name, ex:
+// {{template "request" .}}.
+func WithTemplates(templates map[string]string) Option {
+	return func(f *Formatter) error {
+		for name, text := range templates {
+			if f.templates == nil {
+				f.templates = map[string]string{}
+			}
+			f.templates[name] = text
+		}
+		return nil
+	}
+}
+
+// WithColor colorizes the output, or not.
+func WithColor(colorize bool) Option {
+	return func(f *Formatter) error {
+		f.Colorize = colorize
+		return nil
+	}
+}
+
+// WithExcludes hides fields, along with those hidden by default.
+func WithExcludes(fields ...string) Option {
+	return func(f *Formatter) error {
+		f.ExcludeFields = append(f.ExcludeFields, fields...)
+		return nil
+	}
+}
+
+// WithIncludes shows fields even when they're hidden otherwise, as a comma
+// separated list.
+func WithIncludes(fields string) Option {
+	return func(f *Formatter) error {
+		f.IncludeFields = fields
+		return nil
+	}
+}
+
+// WithKeys reads the timestamp, severity, message, logger, caller and error
+// of entries under keys over the usual ones.
+func WithKeys(keys Keys) Option {
+	return func(f *Formatter) error {
+		f.Keys = keys
+		return nil
+	}
+}
+
+// WithMaxFieldLength hides the fields longer than n, with their name, or
+// none when n is 0.
+func WithMaxFieldLength(n int) Option {
+	return func(f *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max field length %d", n)
+		}
+		f.MaxFieldLength = n
+		return nil
+	}
+}
+
+// WithTimeFormat shows timestamps with a layout, as TimeFormat.
+func WithTimeFormat(layout string) Option {
+	return func(f *Formatter) error {
+		if layout == "" {
+			return errors.New("invalid empty time format")
+		}
+		f.TimeFormat = layout
+		return nil
+	}
+}
+
+// WithLocation shows timestamps in a time zone.
+func WithLocation(location *time.Location) Option {
+	return func(f *Formatter) error {
+		f.Location = location
+		return nil
+	}
+}
+
+// WithFieldColors colors fields, or globs, by color spec, ex:
+// {"request_id": "cyan"}.
+func WithFieldColors(specs map[string]string) Option {
+	return func(f *Formatter) error {
+		var fields []string
+		for field := range specs {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			c, err := ParseColor(specs[field])
+			if err != nil {
+				return fmt.Errorf("invalid color of %s: %v", field, err)
+			}
+			if f.FieldColors == nil {
+				f.FieldColors = make(map[string]*color.Color)
+			}
+			f.FieldColors[field] = c
+		}
+		return nil
+	}
+}
+
+// WithColorRules colors fields, or lines, by their values, ex:
+// "status>=500:red".
+func WithColorRules(specs ...string) Option {
+	return func(f *Formatter) error {
+		for _, spec := range specs {
+			rule, err := ParseColorRule(spec)
+			if err != nil {
+				return err
+			}
+			f.ColorRules = append(f.ColorRules, rule)
+		}
+		return nil
+	}
+}
+
+// WithStrict reports the fields the template outputs which are absent from
+// entries.
+func WithStrict(mode StrictMode) Option {
+	return func(f *Formatter) error {
+		f.Strict = mode
+		return nil
+	}
+}
+
+// WithPrefix shows the text found before the JSON of a line, or not.
+func WithPrefix(show bool) Option {
+	return func(f *Formatter) error {
+		f.ShowPrefix = show
+		return nil
+	}
+}
+
+// WithSuffix shows the text found after the JSON of a line, or not.
+func WithSuffix(show bool) Option {
+	return func(f *Formatter) error {
+		f.ShowSuffix = show
+		return nil
+	}
+}
+
+// WithFields shows the fields of entries after the message, or not.
+func WithFields(show bool) Option {
+	return func(f *Formatter) error {
+		f.ShowFields = show
+		return nil
+	}
+}
+
+// WithObjFields shows objects as fields, along with those shown by
+// default.
+func WithObjFields(fields ...string) Option {
+	return func(f *Formatter) error {
+		f.ObjFields = append(f.ObjFields, fields...)
+		return nil
+	}
+}
+
+// WithFlatten shows the keys of envelope objects as top level fields,
+// instead of the default ones, resolving collisions with mode.
+func WithFlatten(mode Collision, fields ...string) Option {
+	return func(f *Formatter) error {
+		if mode < CollisionPrefix || mode > CollisionWarn {
+			return fmt.Errorf("invalid collision mode %d", mode)
+		}
+		f.FlattenCollision = mode
+		f.FlattenFields = fields
+		return nil
+	}
+}
+
+// WithWarnings writes the warnings of the formatter, ex: of CollisionWarn,
+// to w.
+func WithWarnings(w io.Writer) Option {
+	return func(f *Formatter) error {
+		f.Warnings = w
+		return nil
+	}
+}
+
+// WithFieldOrder shows fields, or globs, first in this order.
+func WithFieldOrder(fields ...string) Option {
+	return func(f *Formatter) error {
+		f.FieldOrder = fields
+		return nil
+	}
+}
+
+// WithIncludeRegexp shows the fields of which the path matches expr, even
+// when they're hidden otherwise. An empty expr matches none.
+func WithIncludeRegexp(expr string) Option {
+	return func(f *Formatter) (err error) {
+		f.IncludeFieldsRegexp, err = compileRegexp(expr)
+		return err
+	}
+}
+
+// WithExcludeRegexp hides the fields of which the path matches expr. An
+// empty expr matches none.
+func WithExcludeRegexp(expr string) Option {
+	return func(f *Formatter) (err error) {
+		f.ExcludeFieldsRegexp, err = compileRegexp(expr)
+		return err
+	}
+}
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// WithAlignFields lines up the values of fields across lines, or not.
+func WithAlignFields(align bool) Option {
+	return func(f *Formatter) error {
+		f.AlignFields = align
+		return nil
+	}
+}
+
+// WithWrapWidth wraps the fields of lines longer than n, or none when n is
+// 0.
+func WithWrapWidth(n int) Option {
+	return func(f *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("invalid wrap width %d", n)
+		}
+		f.WrapWidth = n
+		return nil
+	}
+}
+
+// WithTruncateWidth cuts lines longer than n, or none when n is 0.
+func WithTruncateWidth(n int) Option {
+	return func(f *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("invalid truncate width %d", n)
+		}
+		f.TruncateWidth = n
+		return nil
+	}
+}
+
+// WithTrailerFormat renders the objects printed beneath entries in format.
+func WithTrailerFormat(format TrailerFormat) Option {
+	return func(f *Formatter) error {
+		if format < TrailerJSON || format > TrailerYAML {
+			return fmt.Errorf("invalid trailer format %d", format)
+		}
+		f.TrailerFormat = format
+		return nil
+	}
+}
+
+// WithCombineErrors appends the error of entries to their message, or
+// shows it as a field.
+func WithCombineErrors(combine bool) Option {
+	return func(f *Formatter) error {
+		f.CombineErrors = combine
+		return nil
+	}
+}
+
+// WithHighlightSyntax colors the JSON and SQL found in messages, or not.
+func WithHighlightSyntax(highlight bool) Option {
+	return func(f *Formatter) error {
+		f.HighlightSyntax = highlight
+		return nil
+	}
+}
+
+// WithHighlight colors what re matches in messages and field values, or
+// nothing when re is nil.
+func WithHighlight(re *regexp.Regexp) Option {
+	return func(f *Formatter) error {
+		f.Highlight = re
+		return nil
+	}
+}
+
+// WithTraceIDs shortens and colors trace and span IDs, linking them to url
+// when given, which implies show.
+func WithTraceIDs(show bool, url string) Option {
+	return func(f *Formatter) error {
+		f.TraceIDs = show || url != ""
+		f.TraceURL = url
+		return nil
+	}
+}
+
+// WithCaller shows the location entries were logged from, linking it to
+// url, or to the file, with links.
+func WithCaller(show, links bool, url string) Option {
+	return func(f *Formatter) error {
+		f.ShowCaller = show
+		f.CallerLinks = links
+		f.CallerURL = url
+		return nil
+	}
+}
+
+// WithStack shows head frames at the start of stacktraces and tail at the
+// end, or all of them when both are 0.
+func WithStack(head, tail int) Option {
+	return func(f *Formatter) error {
+		if head < 0 {
+			return fmt.Errorf("invalid head of %d frames", head)
+		}
+		if tail < 0 {
+			return fmt.Errorf("invalid tail of %d frames", tail)
+		}
+		f.StackHead, f.StackTail = head, tail
+		return nil
+	}
+}
+
+// WithStackHide hides the frames of stacktraces matching globs, ex:
+// "runtime.*".
+func WithStackHide(globs ...string) Option {
+	return func(f *Formatter) error {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid glob %q: %v", glob, err)
+			}
+		}
+		f.StackHide = globs
+		return nil
+	}
+}
+
+// WithStackUserPackages highlights the frames of packages in stacktraces.
+func WithStackUserPackages(packages ...string) Option {
+	return func(f *Formatter) error {
+		f.StackUserPackages = packages
+		return nil
+	}
+}
+
+// WithMaxDepth shows the fields of objects nested up to n levels, or all
+// of them when n is 0.
+func WithMaxDepth(n int) Option {
+	return func(f *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max depth %d", n)
+		}
+		f.MaxDepth = n
+		return nil
+	}
+}
+
+// WithMaxArrayLength shows arrays of up to n elements inline.
+func WithMaxArrayLength(n int) Option {
+	return func(f *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max array length %d", n)
+		}
+		f.MaxArrayLength = n
+		return nil
+	}
+}
+
+// WithTruncateValues cuts field values longer than n, or none when n is
+// 0.
+func WithTruncateValues(n int) Option {
+	return func(f *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("invalid length %d", n)
+		}
+		f.TruncateValues = n
+		return nil
+	}
+}
+
+// WithTruncateFields cuts the values of fields longer than their own
+// length, ex: {"query": 40}.
+func WithTruncateFields(lengths map[string]int) Option {
+	return func(f *Formatter) error {
+		for field, n := range lengths {
+			if n < 0 {
+				return fmt.Errorf("invalid length of %s: %d", field, n)
+			}
+		}
+		f.TruncateFields = lengths
+		return nil
+	}
+}
+
+// WithRename shows fields under an alias, by path, ex: {"http.status":
+// "status"}.
+func WithRename(aliases map[string]string) Option {
+	return func(f *Formatter) error {
+		f.Rename = aliases
+		return nil
+	}
+}
+
+// WithUnits shows the value of fields, or globs, in human units by name,
+// ex: {"size": "bytes"}.
+func WithUnits(units map[string]string) Option {
+	return func(f *Formatter) error {
+		for field, name := range units {
+			unit, err := ParseUnit(name)
+			if err != nil {
+				return fmt.Errorf("%s: %v", field, err)
+			}
+			if f.Units == nil {
+				f.Units = make(map[string]Unit)
+			}
+			f.Units[field] = unit
+		}
+		return nil
+	}
+}
+
+// WithSeverity shows severities in a column of width, padded on the side
+// of align, cutting the longer ones with truncate.
+func WithSeverity(width int, align Alignment, truncate bool) Option {
+	return func(f *Formatter) error {
+		if width < 0 {
+			return fmt.Errorf("invalid severity width %d", width)
+		}
+		if align < AlignRight || align > AlignLeft {
+			return fmt.Errorf("invalid alignment %d", align)
+		}
+		f.SeverityWidth = width
+		f.SeverityAlign = align
+		f.SeverityTruncate = truncate
+		return nil
+	}
+}
+
+// WithIcons prefixes lines with an icon per severity, by mode.
+func WithIcons(mode IconMode) Option {
+	return func(f *Formatter) error {
+		if mode < NoIcons || mode > IconsOnly {
+			return fmt.Errorf("invalid icon mode %d", mode)
+		}
+		f.Icons = mode
+		return nil
+	}
+}
+
+// WithTimeLayouts parses timestamps with layouts, before the default ones.
+func WithTimeLayouts(layouts ...string) Option {
+	return func(f *Formatter) error {
+		f.TimeLayouts = append(append([]string(nil), layouts...), f.TimeLayouts...)
+		return nil
+	}
+}
+
+// WithRelativeTime shows timestamps relative to now or to the start, by
+// mode.
+func WithRelativeTime(mode RelativeMode) Option {
+	return func(f *Formatter) error {
+		if mode < Absolute || mode > RelativeToStart {
+			return fmt.Errorf("invalid relative mode %d", mode)
+		}
+		f.RelativeTime = mode
+		return nil
+	}
+}
+
+// WithElapsed shows the time passed since the previous entry, or not,
+// highlighting it above threshold.
+func WithElapsed(show bool, threshold time.Duration) Option {
+	return func(f *Formatter) error {
+		if threshold < 0 {
+			return fmt.Errorf("invalid threshold %v", threshold)
+		}
+		f.ShowElapsed = show
+		f.ElapsedThreshold = threshold
+		return nil
+	}
+}
+
+// WithSourceWidth pads the labels of the sources of entries to n.
+func WithSourceWidth(n int) Option {
+	return func(f *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("invalid source width %d", n)
+		}
+		f.SourceWidth = n
+		return nil
+	}
+}
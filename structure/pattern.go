@@ -0,0 +1,33 @@
+package structure
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	uuidPattern   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	ipPattern     = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`)
+	timePattern   = regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+	hexPattern    = regexp.MustCompile(`\b(0x)?[0-9a-fA-F]{6,}\b`)
+	numberPattern = regexp.MustCompile(`-?\b\d+(\.\d+)?`)
+	quotedPattern = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+)
+
+// MessagePattern normalizes a message to the pattern of the statement
+// which logged it, replacing numbers, IDs, addresses and quoted strings
+// with placeholders, ex: "user 42 logged in from 10.0.0.1" is
+// "user <n> logged in from <ip>".
+func MessagePattern(message string) string {
+	message = uuidPattern.ReplaceAllString(message, "<uuid>")
+	message = ipPattern.ReplaceAllString(message, "<ip>")
+	message = timePattern.ReplaceAllString(message, "<time>")
+	message = hexPattern.ReplaceAllStringFunc(message, func(id string) string {
+		if strings.IndexAny(id, "0123456789") < 0 {
+			return id
+		}
+		return "<id>"
+	})
+	message = numberPattern.ReplaceAllString(message, "<n>")
+	return quotedPattern.ReplaceAllString(message, "<str>")
+}
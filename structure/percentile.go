@@ -0,0 +1,189 @@
+package structure
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sketchAccuracy is the relative accuracy of the quantiles estimated.
+const sketchAccuracy = 0.01
+
+// Percentiles estimates the percentiles of a numeric field over a stream,
+// optionally per value of another field.
+type Percentiles struct {
+	Field   string
+	GroupBy string
+
+	sketches map[string]*sketch
+	order    []string
+}
+
+// NewPercentiles returns Percentiles of the field, grouped by the value of
+// groupBy unless it's empty.
+func NewPercentiles(field, groupBy string) *Percentiles {
+	return &Percentiles{Field: field, GroupBy: groupBy, sketches: make(map[string]*sketch)}
+}
+
+// Add counts the value of the field of the entry, if it has a number.
+func (p *Percentiles) Add(entry *Entry) {
+	value, ok := Lookup(entry.Fields, p.Field)
+	if !ok {
+		return
+	}
+	n, ok := number(value)
+	if !ok {
+		return
+	}
+	group := ""
+	if p.GroupBy != "" {
+		if value, ok := Lookup(entry.Fields, p.GroupBy); ok {
+			group = formatValue(value)
+		}
+	}
+	s, ok := p.sketches[group]
+	if !ok {
+		s = newSketch()
+		p.sketches[group] = s
+		p.order = append(p.order, group)
+	}
+	s.add(n)
+}
+
+// Lines returns the count, p50, p90, p99 and max of the field, per group
+// in the order they were first seen.
+func (p *Percentiles) Lines() []string {
+	if len(p.order) == 0 {
+		return []string{p.Field + ": no values"}
+	}
+	lines := make([]string, 0, len(p.order))
+	for _, group := range p.order {
+		s := p.sketches[group]
+		label := p.Field
+		if p.GroupBy != "" {
+			label += " " + p.GroupBy + "=" + quoteValue(group)
+		}
+		lines = append(lines, fmt.Sprintf("%s: n=%d p50=%s p90=%s p99=%s max=%s", label, s.count,
+			formatNumber(s.quantile(0.5)), formatNumber(s.quantile(0.9)), formatNumber(s.quantile(0.99)), formatNumber(s.max)))
+	}
+	return lines
+}
+
+// Table returns the count, p50, p90, p99 and max of the field, a row per
+// group.
+func (p *Percentiles) Table() *Table {
+	t := &Table{Name: "percentiles " + p.Field, Header: []string{"n", "p50", "p90", "p99", "max"}}
+	if p.GroupBy != "" {
+		t.Header = append([]string{p.GroupBy}, t.Header...)
+	}
+	for _, group := range p.order {
+		s := p.sketches[group]
+		row := []string{strconv.Itoa(s.count), formatNumber(s.quantile(0.5)), formatNumber(s.quantile(0.9)),
+			formatNumber(s.quantile(0.99)), formatNumber(s.max)}
+		if p.GroupBy != "" {
+			row = append([]string{group}, row...)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+// sketch estimates quantiles within sketchAccuracy of the actual values by
+// counting them in logarithmic buckets, using little memory whatever the
+// number of values.
+type sketch struct {
+	gamma    float64
+	buckets  map[int]int
+	zero     int
+	negative map[int]int
+	count    int
+	min, max float64
+}
+
+func newSketch() *sketch {
+	return &sketch{
+		gamma:    (1 + sketchAccuracy) / (1 - sketchAccuracy),
+		buckets:  make(map[int]int),
+		negative: make(map[int]int),
+		min:      math.Inf(1),
+		max:      math.Inf(-1),
+	}
+}
+
+func (s *sketch) add(n float64) {
+	s.count++
+	s.min = math.Min(s.min, n)
+	s.max = math.Max(s.max, n)
+	switch {
+	case n > 0:
+		s.buckets[s.index(n)]++
+	case n < 0:
+		s.negative[s.index(-n)]++
+	default:
+		s.zero++
+	}
+}
+
+func (s *sketch) index(n float64) int {
+	return int(math.Ceil(math.Log(n) / math.Log(s.gamma)))
+}
+
+// value returns the estimated value of the bucket.
+func (s *sketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (1 + s.gamma)
+}
+
+// quantile returns the estimated value below which the fraction q of the
+// values are, within the range of values seen.
+func (s *sketch) quantile(q float64) float64 {
+	rank := int(q * float64(s.count-1))
+	seen := 0
+	estimate := s.max
+	negative := sortedKeys(s.negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		seen += s.negative[negative[i]]
+		if seen > rank {
+			return math.Max(s.min, -s.value(negative[i]))
+		}
+	}
+	seen += s.zero
+	if seen > rank {
+		return 0
+	}
+	for _, index := range sortedKeys(s.buckets) {
+		seen += s.buckets[index]
+		if seen > rank {
+			estimate = s.value(index)
+			break
+		}
+	}
+	return math.Max(s.min, math.Min(s.max, estimate))
+}
+
+func sortedKeys(buckets map[int]int) []int {
+	keys := make([]int, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// formatNumber formats n with 3 significant digits, or as an integer when
+// it has more, the precision of the estimates.
+func formatNumber(n float64) string {
+	if n == 0 || n == math.Trunc(n) {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+	precision := 2 - int(math.Floor(math.Log10(math.Abs(n))))
+	if precision < 0 {
+		precision = 0
+	}
+	text := strconv.FormatFloat(n, 'f', precision, 64)
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	return text
+}
@@ -0,0 +1,53 @@
+package structure
+
+import "strings"
+
+// Stage processes an entry between its parsing and its formatting, given
+// its Fields, which are nil for the lines which aren't JSON. It reports
+// whether to keep the entry: filters drop entries, while enrichers add
+// fields and redactors hide some, keeping them all. Stages are chained with
+// Chain.Use, ex: to add the region of a host or hide a token.
+type Stage func(entry *Entry, fields map[string]interface{}) bool
+
+// Stage returns the filter as a Stage, which doesn't change the entries.
+func (f Filter) Stage() Stage {
+	return func(entry *Entry, fields map[string]interface{}) bool {
+		return f(entry)
+	}
+}
+
+// Redacted replaces the values hidden by Redact.
+const Redacted = "[REDACTED]"
+
+// Redact returns a Stage replacing the values of the fields at the dotted
+// paths with Redacted, ex: "password" or "request.headers.Authorization".
+func Redact(paths ...string) Stage {
+	return func(entry *Entry, fields map[string]interface{}) bool {
+		for _, path := range paths {
+			replaceKey(fields, path, Redacted)
+		}
+		return true
+	}
+}
+
+// replaceKey sets the value at the dotted path key of fields, found as with
+// Lookup, to value when there is one.
+func replaceKey(fields map[string]interface{}, key string, value interface{}) {
+	if _, ok := fields[key]; ok {
+		fields[key] = value
+		return
+	}
+	for i := strings.IndexByte(key, '.'); i >= 0; {
+		if nested, ok := fields[key[:i]].(map[string]interface{}); ok {
+			if _, found := Lookup(nested, key[i+1:]); found {
+				replaceKey(nested, key[i+1:], value)
+				return
+			}
+		}
+		next := strings.IndexByte(key[i+1:], '.')
+		if next < 0 {
+			return
+		}
+		i += next + 1
+	}
+}
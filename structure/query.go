@@ -0,0 +1,54 @@
+package structure
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParseQuery parses a quick filter typed interactively, terms separated by
+// spaces which entries have to match all of:
+//
+//	level:<severity>   entries at least as severe, ex: "level:warn"
+//	<field><op><value> a condition like --where, ex: "status>=500"
+//	<regexp>           entries of which the message or a field matches,
+//	                   regardless of case
+//
+// A term prefixed with - hides the entries matching it instead, ex:
+// "-healthcheck".
+func ParseQuery(query string) (Filter, error) {
+	var filters []Filter
+	for _, term := range strings.Fields(query) {
+		negate := false
+		if len(term) > 1 && term[0] == '-' {
+			negate, term = true, term[1:]
+		}
+		filter, err := parseTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			filter = Not(filter)
+		}
+		filters = append(filters, filter)
+	}
+	return All(filters...), nil
+}
+
+func parseTerm(term string) (Filter, error) {
+	if strings.HasPrefix(term, "level:") {
+		return MinSeverity(strings.TrimPrefix(term, "level:"))
+	}
+	if strings.IndexAny(term, "=!<>~") > 0 {
+		condition, err := ParseCondition(term)
+		if err != nil {
+			return nil, err
+		}
+		return Where(condition), nil
+	}
+	re, err := regexp.Compile("(?i)" + term)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", term, err)
+	}
+	return Grep(re, true), nil
+}
@@ -0,0 +1,75 @@
+package structure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimiter limits the number of entries shown per period, counting the
+// entries it suppresses by severity so they can be summarized.
+type RateLimiter struct {
+	Limit int
+	Per   time.Duration
+
+	window     time.Time
+	count      int
+	suppressed SeverityCounts
+}
+
+// ParseRate parses a rate like "200/s", "1000/m" or "50/10s" into a
+// RateLimiter, a plain number is per second.
+func ParseRate(rate string) (*RateLimiter, error) {
+	limit, per, found := strings.Cut(rate, "/")
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid rate %q, expected a rate like 200/s", rate)
+	}
+	r := &RateLimiter{Limit: n, Per: time.Second}
+	if found {
+		switch per {
+		case "s":
+		case "m":
+			r.Per = time.Minute
+		case "h":
+			r.Per = time.Hour
+		default:
+			r.Per, err = time.ParseDuration(per)
+			if err != nil || r.Per <= 0 {
+				return nil, fmt.Errorf("invalid rate %q, expected a rate like 200/s", rate)
+			}
+		}
+	}
+	return r, nil
+}
+
+// Allow reports whether entry can be shown at now, counting it as
+// suppressed otherwise.
+func (r *RateLimiter) Allow(entry *Entry, now time.Time) bool {
+	if now.Sub(r.window) >= r.Per {
+		r.window = now
+		r.count = 0
+	}
+	r.count++
+	if r.count <= r.Limit {
+		return true
+	}
+	if r.suppressed == nil {
+		r.suppressed = make(SeverityCounts)
+	}
+	r.suppressed.Add(entry.Severity)
+	return false
+}
+
+// Summary returns a line summarizing the entries suppressed since the last
+// summary, ex: "suppressed 1234 lines (12 ERROR, 1222 INFO)", or "" when
+// none were.
+func (r *RateLimiter) Summary() string {
+	if len(r.suppressed) == 0 {
+		return ""
+	}
+	summary := fmt.Sprintf("suppressed %d lines (%s)", r.suppressed.Total(), r.suppressed)
+	r.suppressed = nil
+	return summary
+}
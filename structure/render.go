@@ -0,0 +1,104 @@
+package structure
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// Renderer writes entries, ex: a Formatter with its template, a Converter
+// in a machine format or an HTMLWriter. The entries are normalized by
+// Formatter.Normalize, raw is their JSON and prefix and suffix the text
+// around it. The lines which aren't entries are passed as entries with
+// only a message and no JSON.
+type Renderer interface {
+	Format(entry *Entry, raw json.RawMessage, prefix, suffix []byte) error
+}
+
+// Format writes entry, normalized, for a Converter to be a Renderer.
+func (c *Converter) Format(entry *Entry, raw json.RawMessage, prefix, suffix []byte) error {
+	return c.Write(entry)
+}
+
+// htmlHeader starts the page of an HTMLWriter, with a row per entry colored
+// by severity.
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>jl</title>
+<style>
+body { font-family: monospace; }
+td { padding: 0 0.5em; vertical-align: top; white-space: pre-wrap; }
+.time, .fields { color: #888; }
+.warning .level { color: #b8860b; }
+.error .level, .critical .level, .fatal .level, .panic .level { color: #c00; font-weight: bold; }
+</style>
+</head>
+<body>
+<table>
+`
+
+// htmlFooter ends the page of an HTMLWriter.
+const htmlFooter = `</table>
+</body>
+</html>
+`
+
+// HTMLWriter writes entries as the rows of a table of an HTML page, ex: to
+// share them. Close ends the page.
+type HTMLWriter struct {
+	// Keys are the keys the timestamp, severity and message were read
+	// from, over the usual ones.
+	Keys Keys
+
+	w       io.Writer
+	started bool
+}
+
+// NewHTMLWriter returns an HTMLWriter writing to w.
+func NewHTMLWriter(w io.Writer) *HTMLWriter {
+	return &HTMLWriter{w: w}
+}
+
+// Format writes entry as a row of its time, severity, message and other
+// fields.
+func (h *HTMLWriter) Format(entry *Entry, raw json.RawMessage, prefix, suffix []byte) error {
+	var b strings.Builder
+	if !h.started {
+		h.started = true
+		b.WriteString(htmlHeader)
+	}
+	var when string
+	if entry.Timestamp != nil {
+		when = entry.Timestamp.Format(time.RFC3339Nano)
+	} else {
+		when = entry.RawTimestamp
+	}
+	severity := NormalizeSeverity(entry.Severity)
+	var fields []string
+	for _, f := range (&Converter{Keys: h.Keys}).fields(entry) {
+		if f.key != "time" && f.key != "level" && f.key != "msg" {
+			fields = append(fields, f.key+"="+quoteValue(convertedValue(f.value)))
+		}
+	}
+	fmt.Fprintf(&b, "<tr class=%q><td class=\"time\">%s</td><td class=\"level\">%s</td><td class=\"msg\">%s</td><td class=\"fields\">%s</td></tr>\n",
+		strings.ToLower(severity), html.EscapeString(when), html.EscapeString(severity),
+		html.EscapeString(entry.Message), html.EscapeString(strings.Join(fields, " ")))
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// Close ends the page, which is empty when no entry was written.
+func (h *HTMLWriter) Close() error {
+	if !h.started {
+		if _, err := io.WriteString(h.w, htmlHeader); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(h.w, htmlFooter)
+	return err
+}
@@ -0,0 +1,73 @@
+package structure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// schemaTypes are the types a field of a Schema can require.
+var schemaTypes = []string{"string", "number", "bool", "object", "array"}
+
+// SchemaField is a field entries must have, of a type unless it's empty.
+type SchemaField struct {
+	Path string
+	Type string
+}
+
+// Schema lists the fields entries must have.
+type Schema []SchemaField
+
+// ParseSchema parses the fields of a schema as a comma separated list of
+// paths, each optionally followed by its type, ex: "time,msg,status:number".
+func ParseSchema(spec string) (Schema, error) {
+	var schema Schema
+	for _, field := range strings.Split(spec, ",") {
+		path, typ := field, ""
+		if i := strings.LastIndexByte(field, ':'); i >= 0 {
+			path, typ = field[:i], field[i+1:]
+		}
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return nil, fmt.Errorf("empty field in %q", spec)
+		}
+		if typ != "" && !contains(schemaTypes, typ) {
+			return nil, fmt.Errorf("unknown type %q of %s, expected one of %s", typ, path, strings.Join(schemaTypes, ", "))
+		}
+		schema = append(schema, SchemaField{Path: path, Type: typ})
+	}
+	return schema, nil
+}
+
+// Check returns how fields violate the schema, ex: `missing "msg"`, or
+// nothing when they don't.
+func (s Schema) Check(fields map[string]interface{}) []string {
+	var violations []string
+	for _, field := range s {
+		value, ok := Lookup(fields, field.Path)
+		if !ok {
+			violations = append(violations, fmt.Sprintf("missing %q", field.Path))
+			continue
+		}
+		if typ := jsonType(value); field.Type != "" && typ != field.Type {
+			violations = append(violations, fmt.Sprintf("%q is %s, expected %s", field.Path, typ, field.Type))
+		}
+	}
+	return violations
+}
+
+// jsonType returns the type of a value decoded from JSON.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "null"
+}
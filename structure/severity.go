@@ -0,0 +1,124 @@
+package structure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// severityLevels ranks the normalized severities, so entries can be
+// filtered by a minimum severity.
+var severityLevels = map[string]int{
+	"TRACE":     10,
+	"DEBUG":     20,
+	"INFO":      30,
+	"NOTICE":    35,
+	"WARNING":   40,
+	"ERROR":     50,
+	"CRITICAL":  55,
+	"ALERT":     58,
+	"FATAL":     60,
+	"PANIC":     60,
+	"EMERGENCY": 60,
+}
+
+// NormalizeSeverity returns the common name of a severity, ex: "warn" and
+// bunyan's "40" are "WARNING".
+func NormalizeSeverity(severity string) string {
+	severity = strings.ToUpper(severity)
+	if level, ok := severityMapping[severity]; ok {
+		return level
+	}
+	return severity
+}
+
+// MapSeverity reads the severity from as to, ex: "notice" as "info" or
+// "5" as "error".
+func MapSeverity(from, to string) {
+	severityMapping[strings.ToUpper(from)] = NormalizeSeverity(to)
+}
+
+// defaultSeverityMapping is the severities read as others before any is
+// mapped, which SetSeverities starts from.
+var defaultSeverityMapping = copyMapping(severityMapping)
+
+func copyMapping(mapping map[string]string) map[string]string {
+	copied := make(map[string]string, len(mapping))
+	for from, to := range mapping {
+		copied[from] = to
+	}
+	return copied
+}
+
+// SetSeverities reads the severities of mapping as others like MapSeverity,
+// in place of all those mapped before.
+func SetSeverities(mapping map[string]string) {
+	severities := copyMapping(defaultSeverityMapping)
+	for from, to := range mapping {
+		to = strings.ToUpper(to)
+		if level, ok := defaultSeverityMapping[to]; ok {
+			to = level
+		}
+		severities[strings.ToUpper(from)] = to
+	}
+	severityMapping = severities
+}
+
+// SeverityLevel returns the rank of a severity, higher is more severe. It
+// returns false for unknown severities.
+func SeverityLevel(severity string) (int, bool) {
+	level, ok := severityLevels[NormalizeSeverity(severity)]
+	return level, ok
+}
+
+// SeverityCounts counts entries by normalized severity, entries without a
+// severity are counted as "".
+type SeverityCounts map[string]int
+
+// Add counts an entry of the severity.
+func (c SeverityCounts) Add(severity string) {
+	c[NormalizeSeverity(severity)]++
+}
+
+// Total returns the number of entries counted.
+func (c SeverityCounts) Total() int {
+	total := 0
+	for _, count := range c {
+		total += count
+	}
+	return total
+}
+
+// Severities returns the severities counted, the most severe first and the
+// unknown ones last.
+func (c SeverityCounts) Severities() []string {
+	severities := make([]string, 0, len(c))
+	for severity := range c {
+		severities = append(severities, severity)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		a, _ := SeverityLevel(severities[i])
+		b, _ := SeverityLevel(severities[j])
+		if a != b {
+			return a > b
+		}
+		if severities[i] == "" || severities[j] == "" {
+			return severities[j] == ""
+		}
+		return severities[i] < severities[j]
+	})
+	return severities
+}
+
+// String lists the counts, ex: "12 ERROR, 1222 INFO, 3 other".
+func (c SeverityCounts) String() string {
+	counts := make([]string, 0, len(c))
+	for _, severity := range c.Severities() {
+		name := severity
+		if name == "" {
+			name = "other"
+		}
+		counts = append(counts, fmt.Sprintf("%d %s", c[severity], name))
+	}
+	return strings.Join(counts, ", ")
+}
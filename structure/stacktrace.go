@@ -1,8 +1,10 @@
 package structure
 
 import (
-	"encoding/json"
+	"fmt"
 	"io"
+	"regexp"
+	"strings"
 )
 
 // StacktraceFormatter interfaces with the Formatter to format a possible
@@ -20,15 +22,289 @@ func RegisterStacktracer(tracer StacktraceFormatter) {
 	stacktracers = append(stacktracers, tracer)
 }
 
-func stacktrace(w io.Writer, raw []byte) error {
-	var root map[string]interface{}
-	_ = json.Unmarshal(raw, &root)
+// stackFields are checked for a Go, Java, Python or Node stacktrace when none
+// of the registered stacktracers detected one.
+var stackFields = []string{
+	"stacktrace", "stack_trace", "stack", "exception", "exc_info", "traceback",
+	"error.stack_trace", "error.stack", "err.stack",
+}
+
+func (f *Formatter) stacktrace(w io.Writer, root map[string]interface{}) error {
+	stack := ""
 	for _, tracer := range stacktracers {
 		if tracer.Detect(root) {
-			stack := tracer.Format(root)
-			_, err := w.Write([]byte(stack))
-			return err
+			stack = tracer.Format(root)
+			break
+		}
+	}
+	if stack == "" {
+		stack = genericStack(root)
+	}
+	if stack == "" {
+		return nil
+	}
+	_, err := io.WriteString(w, f.renderStack(stack))
+	return err
+}
+
+func genericStack(root map[string]interface{}) string {
+	for _, field := range stackFields {
+		value, _ := Lookup(root, field)
+		stack, ok := value.(string)
+		if !ok || !isStacktrace(stack) {
+			continue
+		}
+		stack = strings.TrimSpace(stack)
+		stack = strings.Replace(stack, "\t", "  ", -1)
+		return "\n    " + strings.Replace(stack, "\n", "\n    ", -1)
+	}
+	return ""
+}
+
+var (
+	goFileLine     = regexp.MustCompile(`\.(go|s):\d+`)
+	javaFrame      = regexp.MustCompile(`^at [\w$.<>/]+\(.*\)$`)
+	nodeFrame      = regexp.MustCompile(`^at .*(:\d+:\d+\)?|\(native\)|\(<anonymous>\))$`)
+	pythonFrame    = regexp.MustCompile(`^File ".*", line \d+`)
+	stackHeader    = regexp.MustCompile(`^(Caused by: |Traceback \(most recent call last\):|panic: |goroutine \d+ \[|[\w.$]*(Error|Exception)\b)`)
+	stackOmitted   = regexp.MustCompile(`^\.\.\. \d+ (more|common frames omitted)`)
+	libraryMarkers = []string{
+		"/vendor/", "/pkg/mod/", "/src/runtime/", "/usr/local/go/", "go.uber.org/zap",
+		"node_modules", "node:internal", "(internal/",
+		"site-packages", "dist-packages", "/lib/python",
+		"at java.", "at javax.", "at jdk.", "at sun.", "at kotlin.", "at scala.",
+	}
+	libraryPrefixes = []string{"runtime.", "runtime/", "testing.", "net/http.", "reflect."}
+)
+
+// isStacktrace reports whether text looks like a Go, Java, Python or Node
+// stacktrace.
+func isStacktrace(text string) bool {
+	if !strings.Contains(text, "\n") {
+		return false
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if goFileLine.MatchString(line) || javaFrame.MatchString(line) || nodeFrame.MatchString(line) ||
+			pythonFrame.MatchString(line) || strings.HasPrefix(line, "Traceback (most recent call last):") {
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// isFrame reports whether the (trimmed) line is a frame of a stacktrace.
+func isFrame(line string) bool {
+	return goFileLine.MatchString(line) || javaFrame.MatchString(line) ||
+		nodeFrame.MatchString(line) || pythonFrame.MatchString(line)
+}
+
+func isLibraryFrame(text string) bool {
+	for _, marker := range libraryMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	for _, prefix := range libraryPrefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Formatter) isUserFrame(text string) bool {
+	for _, pkg := range f.StackUserPackages {
+		if pkg != "" && strings.Contains(text, pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+// stackUnit is a line, or the two lines of a Go or Python frame, of a
+// rendered stacktrace.
+type stackUnit struct {
+	lines []string
+	text  string
+	kind  stackKind
+}
+
+type stackKind int
+
+const (
+	stackOther stackKind = iota
+	stackMessage
+	stackFrame
+	stackOmittedLine
+	stackHidden
+)
+
+// parseStack splits a rendered stacktrace into units.
+func parseStack(stack string) []stackUnit {
+	lines := strings.Split(stack, "\n")
+	units := make([]stackUnit, 0, len(lines))
+	first := true
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			units = append(units, stackUnit{lines: lines[i : i+1]})
+			continue
+		}
+
+		next := ""
+		if i+1 < len(lines) {
+			next = strings.TrimSpace(lines[i+1])
+		}
+		unit := stackUnit{lines: lines[i : i+1], text: trimmed}
+		pair := false
+		switch {
+		case !isFrame(trimmed) && goFileLine.MatchString(next):
+			unit.kind, pair = stackFrame, true // Go function followed by its file
+		case pythonFrame.MatchString(trimmed):
+			unit.kind = stackFrame // Python frame followed by its source line
+			pair = next != "" && !isFrame(next) && !stackHeader.MatchString(next)
+		case isFrame(trimmed):
+			unit.kind = stackFrame
+		case stackOmitted.MatchString(trimmed):
+			unit.kind = stackOmittedLine
+		case first || stackHeader.MatchString(trimmed):
+			unit.kind = stackMessage
+		}
+		if pair {
+			unit.lines = lines[i : i+2]
+			unit.text += "\n" + next
+			i++
+		}
+		first = false
+		units = append(units, unit)
+	}
+	return units
+}
+
+// foldStack hides the frames matching StackHide and collapses every run of
+// frames to its first StackHead and last StackTail frames. Hidden frames are
+// replaced by a marker with their count.
+func (f *Formatter) foldStack(units []stackUnit) []stackUnit {
+	hide := make([]*regexp.Regexp, 0, len(f.StackHide))
+	for _, pattern := range f.StackHide {
+		if pattern != "" {
+			hide = append(hide, globRegexp(pattern))
+		}
+	}
+
+	result := make([]stackUnit, 0, len(units))
+	var run []stackUnit // consecutive frames, hidden frames have a nil text
+	flush := func() {
+		shown := 0
+		for _, unit := range run {
+			if unit.lines != nil {
+				shown++
+			}
+		}
+		fold := f.StackHead+f.StackTail > 0 && shown > f.StackHead+f.StackTail+1
+		index := 0
+		hidden := 0
+		indent := ""
+		for _, unit := range run {
+			visible := unit.lines != nil
+			if visible {
+				index++
+				indent = unit.lines[0][:len(unit.lines[0])-len(strings.TrimLeft(unit.lines[0], " \t"))]
+				if fold && index > f.StackHead && index <= shown-f.StackTail {
+					visible = false
+				}
+			}
+			if !visible {
+				hidden++
+				continue
+			}
+			if hidden > 0 {
+				result = append(result, hiddenFrames(hidden, indent))
+				hidden = 0
+			}
+			result = append(result, unit)
+		}
+		if hidden > 0 {
+			if indent == "" {
+				indent = "      "
+			}
+			result = append(result, hiddenFrames(hidden, indent))
+		}
+		run = nil
+	}
+	for _, unit := range units {
+		switch {
+		case unit.kind != stackFrame:
+			flush()
+			result = append(result, unit)
+		case matchesFrame(hide, unit.text):
+			run = append(run, stackUnit{kind: stackFrame})
+		default:
+			run = append(run, unit)
+		}
+	}
+	flush()
+	return result
+}
+
+func hiddenFrames(count int, indent string) stackUnit {
+	text := fmt.Sprintf("… %d frames hidden", count)
+	if count == 1 {
+		text = "… 1 frame hidden"
+	}
+	return stackUnit{kind: stackHidden, text: text, lines: []string{indent + text}}
+}
+
+func matchesFrame(patterns []*regexp.Regexp, frame string) bool {
+	name := strings.TrimPrefix(frame, "at ")
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp compiles a glob in which * matches any text, including dots and
+// slashes, to a regular expression matching from the start of the text.
+func globRegexp(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, `.*`)
+	expr = strings.ReplaceAll(expr, `\?`, `.`)
+	return regexp.MustCompile("^" + expr)
+}
+
+// renderStack folds and colors a rendered stacktrace: error messages are
+// red, frames of libraries and the runtime are dimmed and frames of the
+// StackUserPackages are highlighted.
+func (f *Formatter) renderStack(stack string) string {
+	units := f.foldStack(parseStack(stack))
+	lines := make([]string, 0, len(units))
+	for _, unit := range units {
+		var paint func(a ...interface{}) string
+		switch {
+		case unit.kind == stackMessage:
+			paint = stackErrorColor
+		case unit.kind == stackOmittedLine || unit.kind == stackHidden:
+			paint = stackLibraryColor
+		case unit.kind == stackFrame && f.isUserFrame(unit.text):
+			paint = stackUserColor
+		case unit.kind == stackFrame && isLibraryFrame(unit.text):
+			paint = stackLibraryColor
+		}
+		for _, line := range unit.lines {
+			lines = append(lines, colorizeIndented(line, paint))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// colorizeIndented colors line, leaving its indentation uncolored.
+func colorizeIndented(line string, paint func(a ...interface{}) string) string {
+	if paint == nil {
+		return line
+	}
+	trimmed := strings.TrimLeft(line, " \t")
+	return line[:len(line)-len(trimmed)] + paint(trimmed)
 }
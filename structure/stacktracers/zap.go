@@ -29,13 +29,9 @@ func (b *zap) Detect(json map[string]interface{}) bool {
 		}
 	}
 
-	_, ok = json["stacktrace"].(string)
-	if !ok {
-		return true
-	}
-
-	_, ok = json["stack"].(string)
-	return !ok
+	_, stacktrace := json["stacktrace"].(string)
+	_, stack := json["stack"].(string)
+	return stacktrace || stack
 }
 
 func (b *zap) Format(json map[string]interface{}) string {
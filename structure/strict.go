@@ -0,0 +1,114 @@
+package structure
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"text/template/parse"
+)
+
+// StrictMode selects how fields referenced by the template but absent from
+// an entry are reported.
+type StrictMode int
+
+const (
+	// StrictOff prints missing fields as empty strings, this is the default.
+	StrictOff StrictMode = iota
+	// StrictFail makes Format return a *MissingFieldsError.
+	StrictFail
+	// StrictAnnotate marks the missing fields at the end of the line.
+	StrictAnnotate
+)
+
+// MissingFieldsError is returned by Format in StrictFail mode when the
+// template references fields absent from the entry.
+type MissingFieldsError struct {
+	Fields []string
+}
+
+func (e *MissingFieldsError) Error() string {
+	return "template references missing fields: " + strings.Join(e.Fields, ", ")
+}
+
+// templateFields returns the fields of the entry the template outputs
+// without checking them with an if or with first.
+func templateFields(tree *parse.Tree) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	var walk func(node parse.Node, guarded map[string]bool)
+	walkPipe := func(pipe *parse.PipeNode, guarded map[string]bool) {
+		if pipe == nil {
+			return
+		}
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				if field, ok := arg.(*parse.FieldNode); ok {
+					name := field.Ident[0]
+					if !guarded[name] && !seen[name] {
+						seen[name] = true
+						fields = append(fields, name)
+					}
+				}
+			}
+		}
+	}
+	walkBranch := func(branch *parse.BranchNode, guarded map[string]bool) {
+		inner := make(map[string]bool, len(guarded))
+		for name := range guarded {
+			inner[name] = true
+		}
+		for _, cmd := range branch.Pipe.Cmds {
+			for _, arg := range cmd.Args {
+				if field, ok := arg.(*parse.FieldNode); ok {
+					inner[field.Ident[0]] = true
+				}
+			}
+		}
+		walk(branch.List, inner)
+		if branch.ElseList != nil {
+			walk(branch.ElseList, guarded)
+		}
+	}
+	walk = func(node parse.Node, guarded map[string]bool) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			for _, n := range node.Nodes {
+				walk(n, guarded)
+			}
+		case *parse.ActionNode:
+			walkPipe(node.Pipe, guarded)
+		case *parse.IfNode:
+			walkBranch(&node.BranchNode, guarded)
+		case *parse.WithNode:
+			walkBranch(&node.BranchNode, guarded)
+		case *parse.RangeNode:
+			walkBranch(&node.BranchNode, guarded)
+		}
+	}
+	if tree != nil && tree.Root != nil {
+		walk(tree.Root, map[string]bool{})
+	}
+	return fields
+}
+
+// missingFields returns the fields referenced by the template which are
+// empty in entry, as ".Name".
+func (f *Formatter) missingFields(entry *Entry) []string {
+	var missing []string
+	value := reflect.ValueOf(entry).Elem()
+	for _, name := range f.referenced {
+		field := value.FieldByName(name)
+		if field.IsValid() && field.IsZero() {
+			missing = append(missing, "."+name)
+		}
+	}
+	return missing
+}
+
+// annotateMissing writes a marker for every missing field, in the style of
+// the "<no value>" text/template prints for missing map keys.
+func annotateMissing(line *bytes.Buffer, missing []string) {
+	for _, name := range missing {
+		line.WriteString(" " + missingColor("<missing "+name+">"))
+	}
+}
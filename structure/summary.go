@@ -0,0 +1,116 @@
+package structure
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// summaryTopErrors is the number of most frequent error messages
+// summarized.
+const summaryTopErrors = 5
+
+// Summary sums up a run: the lines read, how many could be parsed, the
+// entries per severity, the time span they cover and the most frequent
+// error messages.
+type Summary struct {
+	Lines         int            `json:"lines"`
+	Entries       int            `json:"entries"`
+	NonJSON       int            `json:"non_json"`
+	ParseFailures int            `json:"parse_failures"`
+	Severities    SeverityCounts `json:"severities"`
+	First         *time.Time     `json:"first,omitempty"`
+	Last          *time.Time     `json:"last,omitempty"`
+	TopErrors     []MessageCount `json:"top_errors"`
+
+	errors map[string]int
+}
+
+// MessageCount is the number of times a message pattern was logged.
+type MessageCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// NewSummary returns an empty Summary.
+func NewSummary() *Summary {
+	return &Summary{Severities: make(SeverityCounts), errors: make(map[string]int)}
+}
+
+// Add sums up a parsed entry.
+func (s *Summary) Add(entry *Entry) {
+	s.Lines++
+	s.Entries++
+	s.Severities.Add(entry.Severity)
+	if ts := entry.Timestamp; ts != nil {
+		if s.First == nil || ts.Before(*s.First) {
+			s.First = ts
+		}
+		if s.Last == nil || ts.After(*s.Last) {
+			s.Last = ts
+		}
+	}
+	if level, ok := SeverityLevel(entry.Severity); ok && level >= severityLevels["ERROR"] {
+		s.errors[MessagePattern(entry.Message)]++
+	}
+}
+
+// AddRaw sums up a line which isn't an entry, failed tells whether it
+// looked like JSON but couldn't be parsed.
+func (s *Summary) AddRaw(failed bool) {
+	s.Lines++
+	if failed {
+		s.ParseFailures++
+	} else {
+		s.NonJSON++
+	}
+}
+
+// finish ranks the most frequent error messages.
+func (s *Summary) finish() {
+	s.TopErrors = make([]MessageCount, 0, len(s.errors))
+	for message, count := range s.errors {
+		s.TopErrors = append(s.TopErrors, MessageCount{Message: message, Count: count})
+	}
+	sort.Slice(s.TopErrors, func(i, j int) bool {
+		if s.TopErrors[i].Count != s.TopErrors[j].Count {
+			return s.TopErrors[i].Count > s.TopErrors[j].Count
+		}
+		return s.TopErrors[i].Message < s.TopErrors[j].Message
+	})
+	if len(s.TopErrors) > summaryTopErrors {
+		s.TopErrors = s.TopErrors[:summaryTopErrors]
+	}
+}
+
+// Text renders the summary for people.
+func (s *Summary) Text() []string {
+	s.finish()
+	lines := []string{
+		fmt.Sprintf("lines read:     %d", s.Lines),
+		fmt.Sprintf("entries:        %d", s.Entries),
+		fmt.Sprintf("non-JSON lines: %d", s.NonJSON),
+		fmt.Sprintf("parse failures: %d", s.ParseFailures),
+	}
+	if len(s.Severities) > 0 {
+		lines = append(lines, fmt.Sprintf("severities:     %s", s.Severities))
+	}
+	if s.First != nil {
+		lines = append(lines, fmt.Sprintf("time span:      %s → %s (%v)",
+			s.First.Format(time.RFC3339), s.Last.Format(time.RFC3339), s.Last.Sub(*s.First)))
+	}
+	if len(s.TopErrors) > 0 {
+		lines = append(lines, "top errors:")
+		for _, e := range s.TopErrors {
+			lines = append(lines, fmt.Sprintf("%8d  %s", e.Count, e.Message))
+		}
+	}
+	return lines
+}
+
+// JSON renders the summary for machines.
+func (s *Summary) JSON() ([]byte, error) {
+	s.finish()
+	return json.Marshal(s)
+}
@@ -0,0 +1,106 @@
+package structure
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Table is the result of an aggregation, rendered as aligned columns or
+// as CSV or JSON for scripts.
+type Table struct {
+	Name   string
+	Header []string
+	Rows   [][]string
+}
+
+// CSV writes the table as CSV, with the header as first record.
+func (t *Table) CSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(t.Header); err != nil {
+		return err
+	}
+	if err := out.WriteAll(t.Rows); err != nil {
+		return err
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// MarshalJSON renders the table as its name and its rows as objects keyed
+// by the header, numbers as JSON numbers, ex:
+// {"name":"agg","rows":[{"status":200,"count":3}]}.
+func (t *Table) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`{"name":`)
+	name, _ := json.Marshal(t.Name)
+	b.Write(name)
+	b.WriteString(`,"rows":[`)
+	for i, row := range t.Rows {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('{')
+		for j, cell := range row {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := json.Marshal(t.Header[j])
+			b.Write(key)
+			b.WriteByte(':')
+			if _, err := strconv.ParseFloat(cell, 64); err == nil && json.Valid([]byte(cell)) {
+				b.WriteString(cell)
+			} else {
+				value, _ := json.Marshal(cell)
+				b.Write(value)
+			}
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString("]}")
+	return b.Bytes(), nil
+}
+
+// Lines renders the table with its columns aligned, numbers right-aligned.
+func (t *Table) Lines() []string {
+	widths := make([]int, len(t.Header))
+	numeric := make([]bool, len(t.Header))
+	for i, name := range t.Header {
+		widths[i] = utf8.RuneCountInString(name)
+		numeric[i] = len(t.Rows) > 0
+	}
+	for _, row := range t.Rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+			if _, ok := number(cell); !ok && cell != "" {
+				numeric[i] = false
+			}
+		}
+	}
+	render := func(cells []string) string {
+		var line strings.Builder
+		for i, cell := range cells {
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			if numeric[i] {
+				line.WriteString(padding + cell)
+			} else {
+				line.WriteString(cell + padding)
+			}
+		}
+		return strings.TrimRight(line.String(), " ")
+	}
+	lines := []string{render(t.Header)}
+	for _, row := range t.Rows {
+		lines = append(lines, render(row))
+	}
+	return lines
+}
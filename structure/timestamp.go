@@ -0,0 +1,115 @@
+package structure
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// parseLayouts parses raw with the first matching layout.
+func parseLayouts(raw string, layouts []string) (time.Time, bool) {
+	if raw == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range layouts {
+		if named, ok := namedLayouts[layout]; ok {
+			layout = named
+		}
+		t, err := time.Parse(layout, raw)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseEpoch tries to interpret a numeric timestamp, either as a JSON number
+// or as a string containing one, as a unix timestamp. The unit (seconds,
+// milliseconds, microseconds or nanoseconds) is guessed from the magnitude.
+func parseEpoch(number float64, raw string) (time.Time, bool) {
+	text := strings.TrimSpace(raw)
+	if number != 0 || strings.ContainsAny(text, "eE") {
+		if number == 0 {
+			v, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			number = v
+		}
+		if math.IsInf(number, 0) || math.IsNaN(number) {
+			return time.Time{}, false
+		}
+		// The shortest representation is the closest we can get to what
+		// was originally in the JSON:
+		text = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return epoch(text)
+}
+
+// epoch converts a decimal number to a time without going through a float,
+// which would lose precision. Any timestamp beyond the year 5000 when read
+// as seconds is assumed to be in a smaller unit.
+func epoch(text string) (time.Time, bool) {
+	whole, frac, _ := strings.Cut(text, ".")
+	sec, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || sec <= 0 || strings.Trim(frac, "0123456789") != "" {
+		return time.Time{}, false
+	}
+
+	// Move the decimal point three digits for every smaller unit:
+	for _, limit := range []int64{1e11, 1e14, 1e17} {
+		if sec < limit {
+			break
+		}
+		frac = whole[len(whole)-3:] + frac
+		whole = whole[:len(whole)-3]
+	}
+	sec, _ = strconv.ParseInt(whole, 10, 64)
+
+	frac += strings.Repeat("0", 9)
+	nsec, _ := strconv.ParseInt(frac[:9], 10, 64)
+	return time.Unix(sec, nsec).UTC(), true
+}
+
+// boundLayouts are accepted for --since and --until next to RFC3339 and
+// the TimeLayouts.
+var boundLayouts = []string{
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTimeBound parses a bound of a time range, which is either absolute,
+// ex: "2024-05-01T12:00:00Z" or "2024-05-01", or relative to now, ex: "15m",
+// "2h30m" or "7d". Absolute times without a time zone are read in loc.
+func ParseTimeBound(bound string, now time.Time, loc *time.Location) (time.Time, error) {
+	bound = strings.TrimSpace(bound)
+	if strings.HasSuffix(bound, "d") {
+		if n, err := strconv.ParseFloat(strings.TrimSuffix(bound, "d"), 64); err == nil {
+			return now.Add(-time.Duration(n * float64(24*time.Hour))), nil
+		}
+	}
+	if d, err := time.ParseDuration(bound); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, bound); err == nil {
+		return t, nil
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range append(defaultTimeLayouts, boundLayouts...) {
+		if t, err := time.ParseInLocation(layout, bound, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a time like 2024-05-01T12:00:00Z or a duration like 15m", bound)
+}
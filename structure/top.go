@@ -0,0 +1,87 @@
+package structure
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Top tallies the values of fields, to rank the most frequent ones.
+type Top struct {
+	Fields []string
+
+	counts  map[string]map[string]int
+	entries map[string]int
+}
+
+// NewTop returns a Top tallying the values of the fields, which can be
+// dotted paths.
+func NewTop(fields []string) *Top {
+	return &Top{Fields: fields, counts: make(map[string]map[string]int), entries: make(map[string]int)}
+}
+
+// Add tallies the values of the entry, it's skipped for the fields it
+// doesn't have.
+func (t *Top) Add(entry *Entry) {
+	for _, field := range t.Fields {
+		value, ok := Lookup(entry.Fields, field)
+		if !ok {
+			continue
+		}
+		if t.counts[field] == nil {
+			t.counts[field] = make(map[string]int)
+		}
+		t.counts[field][formatValue(value)]++
+		t.entries[field]++
+	}
+}
+
+// Tables ranks the n most frequent values of each field, a table per
+// field.
+func (t *Top) Tables(n int) []*Table {
+	tables := make([]*Table, 0, len(t.Fields))
+	for _, field := range t.Fields {
+		table := &Table{Name: "top " + field, Header: []string{field, "count", "share"}}
+		for _, value := range t.ranked(field, n) {
+			count := t.counts[field][value]
+			share := 100 * float64(count) / float64(t.entries[field])
+			table.Rows = append(table.Rows, []string{value, strconv.Itoa(count), strconv.FormatFloat(share, 'f', 1, 64)})
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// ranked returns the n most frequent values of the field.
+func (t *Top) ranked(field string, n int) []string {
+	counts := t.counts[field]
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if len(values) > n {
+		values = values[:n]
+	}
+	return values
+}
+
+// Table ranks the n most frequent values of each field with their count
+// and share of the entries having the field.
+func (t *Top) Table(n int) []string {
+	var lines []string
+	for _, field := range t.Fields {
+		counts := t.counts[field]
+		lines = append(lines, fmt.Sprintf("%s (%d entries, %d distinct):", field, t.entries[field], len(counts)))
+		for i, value := range t.ranked(field, n) {
+			share := 100 * float64(counts[value]) / float64(t.entries[field])
+			lines = append(lines, fmt.Sprintf("%4d. %8d %5.1f%%  %s", i+1, counts[value], share, quoteValue(value)))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,145 @@
+package structure
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// traceColors are assigned to trace IDs by their hash, so every entry of a
+// trace has the same color.
+var traceColors = []*color.Color{
+	color.New(color.FgHiGreen),
+	color.New(color.FgHiYellow),
+	color.New(color.FgHiBlue),
+	color.New(color.FgHiMagenta),
+	color.New(color.FgHiCyan),
+	color.New(color.FgGreen),
+	color.New(color.FgYellow),
+	color.New(color.FgBlue),
+	color.New(color.FgMagenta),
+	color.New(color.FgCyan),
+}
+
+var traceFlagsColor = color.New(color.FgHiBlack)
+
+// shortTraceID is the number of characters trace and span IDs are shown
+// with.
+const shortTraceID = 8
+
+type traceKind int
+
+const (
+	notTrace traceKind = iota
+	traceID
+	spanID
+	traceFlags
+)
+
+// traceField recognizes the trace fields of OpenTelemetry and common
+// spellings of them, ex: "trace_id", "traceId", "trace.id" or
+// "dd.trace_id".
+func traceField(key string) traceKind {
+	key = strings.ToLower(key)
+	key = strings.NewReplacer("_", "", ".", "", "-", "").Replace(key)
+	switch {
+	case strings.HasSuffix(key, "traceid"):
+		return traceID
+	case strings.HasSuffix(key, "spanid"):
+		return spanID
+	case strings.HasSuffix(key, "traceflags"):
+		return traceFlags
+	}
+	return notTrace
+}
+
+// shortenTraceID shortens the ID for display, the full ID is still used to
+// pick its color and link.
+func shortenTraceID(text string) string {
+	if len(text) > shortTraceID {
+		return text[:shortTraceID]
+	}
+	return text
+}
+
+// colorTrace colors trace and span IDs with the color of the trace of the
+// entry.
+func (f *Formatter) colorTrace(fld field, text string) (string, bool) {
+	switch traceField(fld.key) {
+	case traceID, spanID:
+		if f.trace == "" {
+			return text, false
+		}
+		return idColor(f.trace).Sprint(text), true
+	case traceFlags:
+		return traceFlagsColor.Sprint(text), true
+	}
+	return text, false
+}
+
+// traceLink returns the URL of the trace in a trace viewer, with {trace_id}
+// and {span_id} of TraceURL replaced.
+func (f *Formatter) traceLink(fld field) string {
+	if f.TraceURL == "" || traceField(fld.key) != traceID {
+		return ""
+	}
+	return strings.NewReplacer("{trace_id}", f.trace, "{span_id}", f.span).Replace(f.TraceURL)
+}
+
+// traceparent matches a W3C Trace Context traceparent header value, ex:
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+var traceparent = regexp.MustCompile(`\b([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})\b`)
+
+// expandTraceparent parses a "traceparent" field, or a traceparent found in
+// the message, into "trace_id", "span_id" and "sampled" fields so they're
+// handled like any other trace fields. Existing fields aren't replaced.
+func expandTraceparent(fields map[string]interface{}, message string) {
+	if fields == nil {
+		return
+	}
+	var match []string
+	for key, value := range fields {
+		if text, ok := value.(string); ok && strings.EqualFold(key, "traceparent") {
+			if match = parseTraceparent(text); match != nil {
+				delete(fields, key)
+				break
+			}
+		}
+	}
+	if match == nil {
+		match = parseTraceparent(message)
+	}
+	if match == nil {
+		return
+	}
+	flags, _ := strconv.ParseUint(match[4], 16, 8)
+	expanded := map[string]interface{}{
+		"trace_id": match[2],
+		"span_id":  match[3],
+		"sampled":  flags&1 == 1,
+	}
+	for key, value := range expanded {
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+}
+
+func parseTraceparent(text string) []string {
+	match := traceparent.FindStringSubmatch(text)
+	if match == nil || match[1] == "ff" ||
+		strings.Trim(match[2], "0") == "" || strings.Trim(match[3], "0") == "" {
+		return nil
+	}
+	return match
+}
+
+// idColor picks the color of a trace or request ID by its hash.
+func idColor(id string) *color.Color {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return traceColors[h.Sum32()%uint32(len(traceColors))]
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// tee copies the input read to a file as is, whole lines at once for
+// those of sources read at the same time not to be mixed.
+type tee struct {
+	mu     sync.Mutex
+	file   *os.File
+	failed bool
+}
+
+func newTee(path string) (*tee, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tee{file: file}, nil
+}
+
+// reader returns a reader of r copying what's read to the file.
+func (t *tee) reader(r io.Reader) io.Reader {
+	return &teeReader{t: t, r: r}
+}
+
+// write writes b to the file, reporting the first error.
+func (t *tee) write(b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed {
+		return
+	}
+	if _, err := t.file.Write(b); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the input to %s: %v\n", t.file.Name(), err)
+		t.failed = true
+	}
+}
+
+func (t *tee) close() {
+	if err := t.file.Close(); err != nil && !t.failed {
+		fmt.Fprintf(os.Stderr, "failed to write the input to %s: %v\n", t.file.Name(), err)
+	}
+}
+
+// teeReader holds on to the last line read until its end is, or the end
+// of the input.
+type teeReader struct {
+	t       *tee
+	r       io.Reader
+	partial []byte
+}
+
+func (r *teeReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	data := append(r.partial, b[:n]...)
+	i := bytes.LastIndexByte(data, '\n')
+	if err != nil {
+		i = len(data) - 1
+	}
+	if i >= 0 {
+		r.t.write(data[:i+1])
+	}
+	r.partial = append([]byte{}, data[i+1:]...)
+	return n, err
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+func columnsFromEnv() int {
+	columns, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return columns
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// terminalWidth returns the COLUMNS environment variable, detecting the size
+// of the terminal isn't supported on this platform.
+func terminalWidth() int {
+	return columnsFromEnv()
+}
+
+var errUnsupportedTerminal = errors.New("interactive mode isn't supported on this platform")
+
+func terminalSize(tty *os.File) (width, height int, err error) {
+	return 0, 0, errUnsupportedTerminal
+}
+
+func rawMode(tty *os.File) (restore func(), err error) {
+	return nil, errUnsupportedTerminal
+}
+
+func notifyResize(c chan<- os.Signal) {}
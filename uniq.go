@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/robfig/jl/structure"
+)
+
+// uniq keeps track of the message patterns seen, to show only the first
+// entry of each and count the others.
+type uniq struct {
+	counts map[string]int
+	order  []string
+}
+
+func newUniq() *uniq {
+	return &uniq{counts: make(map[string]int)}
+}
+
+// first counts the message pattern of the entry, reporting whether it's
+// the first entry with it.
+func (u *uniq) first(entry *structure.Entry) bool {
+	pattern := structure.MessagePattern(entry.Message)
+	u.counts[pattern]++
+	if u.counts[pattern] > 1 {
+		return false
+	}
+	u.order = append(u.order, pattern)
+	return true
+}
+
+// summary lists the message patterns seen with their counts, the most
+// frequent first.
+func (u *uniq) summary() []string {
+	patterns := append([]string{}, u.order...)
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return u.counts[patterns[i]] > u.counts[patterns[j]]
+	})
+	lines := make([]string, 0, len(patterns)+1)
+	header := fmt.Sprintf("%d distinct messages:", len(patterns))
+	if len(patterns) == 1 {
+		header = "1 distinct message:"
+	}
+	lines = append(lines, header)
+	for _, pattern := range patterns {
+		lines = append(lines, fmt.Sprintf("%8d  %s", u.counts[pattern], pattern))
+	}
+	return lines
+}